@@ -0,0 +1,75 @@
+package atomic_file
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes the data to a temporary file in the same directory, syncs it and renames it over the named
+// file, so that a crash leaves either the old or the new file and never a partially written one
+func WriteFile(fileName string, data []byte, perm os.FileMode) error {
+	return WriteFileKeepingPrevious(fileName, "", data, perm)
+}
+
+// WriteFileKeepingPrevious writes the data as WriteFile does, the replaced file is kept as previousFileName.
+// A crash between both renames leaves only the previous file, which the reader is expected to fall back to.
+func WriteFileKeepingPrevious(fileName string, previousFileName string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(fileName)
+	tmpFile, err := os.CreateTemp(dir, filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	// the temporary file is left over only if a step below fails
+	defer os.Remove(tmpName)
+
+	if _, err = tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if previousFileName != "" {
+		if err = os.Rename(fileName, previousFileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err = os.Rename(tmpName, fileName); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory so that the renames survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// TruncateIncompleteLine removes the last line of an append-only file of lines if it has no line break,
+// which is a line whose append was interrupted, it returns whether a line was removed
+func TruncateIncompleteLine(fileName string) (bool, error) {
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) || len(data) == 0 || data[len(data)-1] == '\n' {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, os.Truncate(fileName, int64(bytes.LastIndexByte(data, '\n')+1))
+}
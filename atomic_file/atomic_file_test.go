@@ -0,0 +1,113 @@
+package atomic_file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// assertContent checks that the file holds the content
+func assertContent(t *testing.T, fileName string, content string) {
+	data, err := os.ReadFile(fileName)
+	if err != nil || string(data) != content {
+		t.Fatalf("expected %s to hold %q, found %q (%v)", filepath.Base(fileName), content, data, err)
+	}
+}
+
+// assertNoTemporaryFiles checks that the directory holds only the named files
+func assertNoTemporaryFiles(t *testing.T, dir string, fileNames ...string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read the directory: %v", err)
+	}
+	if len(entries) != len(fileNames) {
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("expected the files %v, found %v", fileNames, names)
+	}
+}
+
+func TestWriteFileReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "tree.gob")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(fileName, []byte(content), 0600); err != nil {
+			t.Fatalf("write of %q failed: %v", content, err)
+		}
+		assertContent(t, fileName, content)
+	}
+	if info, err := os.Stat(fileName); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the file mode 0600, found %v (%v)", info.Mode().Perm(), err)
+	}
+	assertNoTemporaryFiles(t, dir, "tree.gob")
+}
+
+func TestWriteFileKeepingPrevious(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "tree.gob")
+	previousFileName := filepath.Join(dir, "tree.prev.gob")
+
+	if err := WriteFileKeepingPrevious(fileName, previousFileName, []byte("first"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := os.Stat(previousFileName); !os.IsNotExist(err) {
+		t.Fatalf("expected no previous file after the first write, found %v", err)
+	}
+	for _, content := range []string{"second", "third"} {
+		if err := WriteFileKeepingPrevious(fileName, previousFileName, []byte(content), 0644); err != nil {
+			t.Fatalf("write of %q failed: %v", content, err)
+		}
+	}
+	assertContent(t, fileName, "third")
+	assertContent(t, previousFileName, "second")
+	assertNoTemporaryFiles(t, dir, "tree.gob", "tree.prev.gob")
+}
+
+func TestWriteFileFailureLeavesFileUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "tree.gob")
+	if err := WriteFile(fileName, []byte("first"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// the rename over a directory fails after the temporary file is written
+	previousDir := filepath.Join(dir, "tree.prev.gob")
+	if err := os.MkdirAll(filepath.Join(previousDir, "entry"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := WriteFileKeepingPrevious(fileName, previousDir, []byte("second"), 0644); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	assertContent(t, fileName, "first")
+	assertNoTemporaryFiles(t, dir, "tree.gob", "tree.prev.gob")
+
+	if err := WriteFile(filepath.Join(dir, "missing", "tree.gob"), []byte("first"), 0644); err == nil {
+		t.Fatal("expected the write to a missing directory to fail")
+	}
+}
+
+func TestTruncateIncompleteLine(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	if truncated, err := TruncateIncompleteLine(fileName); truncated || err != nil {
+		t.Fatalf("expected a missing file to be left alone, found %v (%v)", truncated, err)
+	}
+
+	if err := os.WriteFile(fileName, []byte("line-1\nline-2\n"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if truncated, err := TruncateIncompleteLine(fileName); truncated || err != nil {
+		t.Fatalf("expected complete lines to be kept, found %v (%v)", truncated, err)
+	}
+	assertContent(t, fileName, "line-1\nline-2\n")
+
+	if err := os.WriteFile(fileName, []byte("line-1\nline-2\nline-"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if truncated, err := TruncateIncompleteLine(fileName); !truncated || err != nil {
+		t.Fatalf("expected the incomplete line to be removed, found %v (%v)", truncated, err)
+	}
+	assertContent(t, fileName, "line-1\nline-2\n")
+}
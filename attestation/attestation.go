@@ -0,0 +1,67 @@
+package attestation
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+)
+
+// QuoteMerkleRoot responds with a TPM quote over the merkle root PCR qualified by the caller's nonce,
+// together with the attestation key and the current merkle root, so that the caller can check the root
+// is the one anchored in the TPM
+func QuoteMerkleRoot(respWriter http.ResponseWriter, req *http.Request) {
+	errResponse := commonTypes.ErrorResponse{}
+
+	// the nonce is hex encoded, and guarantees the quote is fresh
+	nonce, err := hex.DecodeString(req.URL.Query().Get(constants.NonceQueryParam))
+	if err != nil || len(nonce) == 0 || len(nonce) > tpm.MaxQuoteNonceSize {
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = fmt.Sprintf("nonce must be hex encoded and between 1 and %d bytes", tpm.MaxQuoteNonceSize)
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+
+	// the active tree, a mutation between quoting and responding is detected by the caller as a root mismatch
+	mt := treeManager.Snapshot()
+
+	tpmInstance, err := tpm.GetInstance()
+	var quote *tpm.QuoteResult
+	if err == nil {
+		quote, err = tpm.Quote(tpmInstance, nonce, mt.HashAlgorithm)
+	}
+	if err != nil {
+		fmt.Println("failed to quote merkle root PCR:", err)
+		errResponse.StatusCode = http.StatusInternalServerError
+		errResponse.ErrorMsg = "Internal Server error"
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+	akPublicKey, err := x509.MarshalPKIXPublicKey(quote.AKPublicKey)
+	if err != nil {
+		errResponse.StatusCode = http.StatusInternalServerError
+		errResponse.ErrorMsg = "Internal Server error"
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+
+	utils.SendJSONResponse(respWriter, http.StatusOK, commonTypes.QuoteResponse{
+		StatusCode:    http.StatusOK,
+		Nonce:         hex.EncodeToString(nonce),
+		Quote:         hex.EncodeToString(quote.Quote),
+		Signature:     hex.EncodeToString(quote.Signature),
+		PCRIndex:      quote.PCRIndex,
+		PCRBank:       quote.PCRBank.String(),
+		PCRValue:      hex.EncodeToString(quote.PCRValue),
+		AKPublicKey:   hex.EncodeToString(akPublicKey),
+		AKPublicArea:  hex.EncodeToString(quote.AKPublicArea),
+		MerkleRoot:    hex.EncodeToString(mt.GetMerkleRoot()),
+		HashAlgorithm: string(mt.HashAlgorithm),
+	})
+	fmt.Println("merkle root quoted successfully")
+}
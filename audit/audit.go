@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	atomicFile "github.com/TruFaaS/TruFaaS/atomic_file"
+	canonicalJSON "github.com/TruFaaS/TruFaaS/canonical_json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operation represents what an audit entry records
+type Operation string
+
+const (
+	OperationCreate Operation = "create" // OperationCreate registers a function, replacing its previous spec
+	OperationUpdate Operation = "update" // OperationUpdate replaces a function by a new function
+	OperationDelete Operation = "delete" // OperationDelete removes a function
+	OperationVerify Operation = "verify" // OperationVerify is a verification, it does not change the tree
+)
+
+// ResultVerified is the result of a successful verification, failed verifications record their error code
+const ResultVerified = "VERIFIED"
+
+// Entry represents a single record of the audit log, roots, hashes and the PCR value are hex encoded.
+// Every entry is chained to the previous one by its hash, so that removing, reordering or changing an
+// entry breaks the chain of all later entries.
+type Entry struct {
+	Sequence            int       `json:"sequence"`
+	Timestamp           int64     `json:"timestamp"` // Timestamp is the recording time in unix milliseconds
+	Operation           Operation `json:"operation"`
+	Actor               string    `json:"actor"`                           // Actor is who requested the operation
+	FunctionIdentity    string    `json:"function_identity"`               // FunctionIdentity is the "namespace/name" of the function
+	OldFunctionIdentity string    `json:"old_function_identity,omitempty"` // OldFunctionIdentity is the replaced function of an update
+	SpecHash            string    `json:"spec_hash"`                       // SpecHash is the leaf hash of the function spec
+	HashAlgorithm       string    `json:"hash_algorithm"`
+	TreeMode            string    `json:"tree_mode,omitempty"`
+	Tenancy             string    `json:"tenancy,omitempty"` // Tenancy is only set for a multi-tenant tree, whose roots are the top-level roots
+	OldRoot             string    `json:"old_root"`
+	NewRoot             string    `json:"new_root"`
+	PCRValue            string    `json:"pcr_value"`
+	Result              string    `json:"result,omitempty"` // Result is the outcome of a verification
+	PreviousHash        string    `json:"previous_hash"`    // PreviousHash is the hash of the previous entry, empty for the first entry
+	Hash                string    `json:"hash"`             // Hash is the SHA-256 of the canonical JSON of all other fields
+}
+
+// ErrBrokenChain is returned when the entries of the audit log are not correctly chained
+var ErrBrokenChain = errors.New("audit log hash chain is broken")
+
+var mutex sync.Mutex
+var logFileName = ""
+
+// entries holds the recorded entries in memory, so that queries neither read the log nor wait for a record being
+// written. Entries are only appended, a query keeps the slice it read even if a later record grows it.
+var entries []Entry
+var entriesMutex sync.RWMutex
+var recordVerifications = false
+var lastSequence = -1
+var lastHash = ""
+
+// ComputeHash returns the hash of the entry, SHA-256 over the canonical JSON of all fields except the hash
+func (entry *Entry) ComputeHash() (string, error) {
+	fields := canonicalJSON.Object{
+		"sequence":              entry.Sequence,
+		"timestamp":             int(entry.Timestamp),
+		"operation":             string(entry.Operation),
+		"actor":                 entry.Actor,
+		"function_identity":     entry.FunctionIdentity,
+		"old_function_identity": entry.OldFunctionIdentity,
+		"spec_hash":             entry.SpecHash,
+		"hash_algorithm":        entry.HashAlgorithm,
+		"old_root":              entry.OldRoot,
+		"new_root":              entry.NewRoot,
+		"pcr_value":             entry.PCRValue,
+		"result":                entry.Result,
+		"previous_hash":         entry.PreviousHash,
+	}
+	// the tree mode and tenancy are only hashed when set, so that entries recorded before they existed keep their hash
+	if entry.TreeMode != "" {
+		fields["tree_mode"] = entry.TreeMode
+	}
+	if entry.Tenancy != "" {
+		fields["tenancy"] = entry.Tenancy
+	}
+	data, err := canonicalJSON.Encode(fields)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Initialize opens the audit log in the file, the chain of the existing entries is verified first.
+// Verifications are only recorded if recordVerificationResults is set.
+func Initialize(fileName string, recordVerificationResults bool) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// an entry whose write was interrupted was never acknowledged, so it is removed
+	truncated, err := atomicFile.TruncateIncompleteLine(fileName)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		fmt.Println("Audit log ends with an incomplete entry, which is removed")
+	}
+	recorded, err := ReadLog(fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err = VerifyChain(recorded); err != nil {
+		return err
+	}
+
+	logFileName, recordVerifications = fileName, recordVerificationResults
+	lastSequence, lastHash = -1, ""
+	if len(recorded) > 0 {
+		lastSequence, lastHash = recorded[len(recorded)-1].Sequence, recorded[len(recorded)-1].Hash
+	}
+	entriesMutex.Lock()
+	entries = recorded
+	entriesMutex.Unlock()
+	fmt.Println("Audit log", fileName, "opened with", len(recorded), "entries")
+	return nil
+}
+
+// RecordsVerifications returns whether verification results are recorded
+func RecordsVerifications() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return recordVerifications
+}
+
+// Record chains the entry to the last entry and appends it to the log, the sequence, timestamp
+// and hashes of the entry are set. Nothing is recorded if the log was not initialized.
+func Record(entry *Entry) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if logFileName == "" {
+		return nil
+	}
+
+	entry.Sequence = lastSequence + 1
+	entry.Timestamp = time.Now().UnixMilli()
+	entry.PreviousHash = lastHash
+	hash, err := entry.ComputeHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(logFileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	lastSequence, lastHash = entry.Sequence, entry.Hash
+	entriesMutex.Lock()
+	entries = append(entries, *entry)
+	entriesMutex.Unlock()
+	return nil
+}
+
+// Query returns the entries accepted by the filter, in the order they were recorded
+func Query(filter func(entry Entry) bool) []Entry {
+	entriesMutex.RLock()
+	recorded := entries
+	entriesMutex.RUnlock()
+
+	matching := make([]Entry, 0)
+	for _, entry := range recorded {
+		if filter(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	return matching
+}
+
+// ReadLog reads all entries of the audit log in the file, one JSON entry per line
+func ReadLog(fileName string) ([]Entry, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// VerifyChain checks that the entries are numbered consecutively from 0 and that each entry holds its own hash
+// and the hash of the entry before it
+func VerifyChain(entries []Entry) error {
+	previousHash := ""
+	for i, entry := range entries {
+		if entry.Sequence != i {
+			return fmt.Errorf("%w: entry %d has sequence %d", ErrBrokenChain, i, entry.Sequence)
+		}
+		if entry.PreviousHash != previousHash {
+			return fmt.Errorf("%w: entry %d does not follow the previous entry", ErrBrokenChain, i)
+		}
+		if hash, err := entry.ComputeHash(); err != nil || entry.Hash != hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrBrokenChain, i)
+		}
+		previousHash = entry.Hash
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// openLog initializes the audit log in a new file and returns its name
+func openLog(t *testing.T) string {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	if err := Initialize(fileName, false); err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	return fileName
+}
+
+// record records a create of the function
+func record(t *testing.T, function string) {
+	if err := Record(&Entry{Operation: OperationCreate, FunctionIdentity: function}); err != nil {
+		t.Fatalf("failed to record %s: %v", function, err)
+	}
+}
+
+func TestQueryReturnsRecordedEntries(t *testing.T) {
+	fileName := openLog(t)
+	if entries := Query(func(Entry) bool { return true }); len(entries) != 0 {
+		t.Fatalf("new log has %d entries", len(entries))
+	}
+	for _, function := range []string{"default/a", "default/b", "default/a"} {
+		record(t, function)
+	}
+
+	entries := Query(func(entry Entry) bool { return entry.FunctionIdentity == "default/a" })
+	if len(entries) != 2 || entries[0].Sequence != 0 || entries[1].Sequence != 2 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	// the entries of the log are loaded when it is opened again
+	if err := Initialize(fileName, false); err != nil {
+		t.Fatalf("failed to open audit log again: %v", err)
+	}
+	record(t, "default/c")
+	logged, err := ReadLog(fileName)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	entries = Query(func(Entry) bool { return true })
+	if len(entries) != 4 || len(logged) != 4 || entries[3] != logged[3] || entries[3].PreviousHash != entries[2].Hash {
+		t.Fatalf("queried entries %+v differ from the log %+v", entries, logged)
+	}
+}
+
+func TestQueryWhileRecording(t *testing.T) {
+	openLog(t)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := Record(&Entry{Operation: OperationCreate, FunctionIdentity: "default/concurrent"}); err != nil {
+				t.Errorf("failed to record: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		entries := Query(func(Entry) bool { return true })
+		if err := VerifyChain(entries); err != nil {
+			t.Fatalf("queried entries are not chained: %v", err)
+		}
+	}
+	wg.Wait()
+	if entries := Query(func(Entry) bool { return true }); len(entries) != 50 {
+		t.Fatalf("expected 50 entries, found %d", len(entries))
+	}
+}
+
+func TestInitializeRefusesBrokenChain(t *testing.T) {
+	fileName := openLog(t)
+	record(t, "default/a")
+	record(t, "default/b")
+	logged, _ := ReadLog(fileName)
+
+	logged[0].FunctionIdentity = "default/other"
+	data := make([]byte, 0)
+	for _, entry := range logged {
+		line, _ := json.Marshal(entry)
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatalf("failed to write audit log: %v", err)
+	}
+	if err := Initialize(fileName, false); !errors.Is(err, ErrBrokenChain) {
+		t.Fatalf("expected %v, found %v", ErrBrokenChain, err)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	openLog(t)
+	record(t, "default/a")
+	record(t, "default/b")
+	if err := Record(&Entry{Operation: OperationDelete, FunctionIdentity: "default/a"}); err != nil {
+		t.Fatalf("failed to record delete: %v", err)
+	}
+
+	tests := []struct {
+		query     string
+		code      int
+		sequences []int
+	}{
+		{"", http.StatusOK, []int{0, 1, 2}},
+		{"?function=default/a", http.StatusOK, []int{0, 2}},
+		{"?operation=delete", http.StatusOK, []int{2}},
+		{"?from=1&limit=1", http.StatusOK, []int{1}},
+		{"?from=-1", http.StatusBadRequest, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?limit=1001", http.StatusBadRequest, nil},
+		{"?limit=many", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			AuditHandler(recorder, httptest.NewRequest(http.MethodGet, "/audit"+test.query, nil))
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, found %d %s", test.code, recorder.Code, recorder.Body)
+			}
+			if test.code != http.StatusOK {
+				return
+			}
+			var response AuditResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if len(response.Entries) != len(test.sequences) {
+				t.Fatalf("expected sequences %v, found %+v", test.sequences, response.Entries)
+			}
+			for i, entry := range response.Entries {
+				if entry.Sequence != test.sequences[i] {
+					t.Fatalf("expected sequences %v, found %+v", test.sequences, response.Entries)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+)
+
+// DefaultQueryLimit is the number of entries returned when no limit is given
+const DefaultQueryLimit = 100
+
+// MaxQueryLimit is the largest number of entries returned by a single query
+const MaxQueryLimit = 1000
+
+// AuditResponse : struct that represents the entries returned by the audit endpoint
+type AuditResponse struct {
+	StatusCode int     `json:"status_code"`
+	Entries    []Entry `json:"entries"`
+}
+
+// AuditHandler responds with the audit log entries, filtered by the optional function identity, operation and first
+// sequence number query parameters, at most limit entries are returned
+func AuditHandler(respWriter http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	function := query.Get(constants.FunctionQueryParam)
+	operation := Operation(query.Get(constants.OperationQueryParam))
+
+	from, err := utils.ParseQueryInt(query.Get(constants.FromQueryParam), 0)
+	if err != nil || from < 0 {
+		utils.SendBadRequestResponse(respWriter, "from must be a non-negative sequence number")
+		return
+	}
+	limit, err := utils.ParseQueryInt(query.Get(constants.LimitQueryParam), DefaultQueryLimit)
+	if err != nil || limit < 1 || limit > MaxQueryLimit {
+		utils.SendBadRequestResponse(respWriter, fmt.Sprintf("limit must be between 1 and %d", MaxQueryLimit))
+		return
+	}
+
+	entries := Query(func(entry Entry) bool {
+		return entry.Sequence >= from &&
+			(function == "" || entry.FunctionIdentity == function || entry.OldFunctionIdentity == function) &&
+			(operation == "" || entry.Operation == operation)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	utils.SendJSONResponse(respWriter, http.StatusOK, AuditResponse{StatusCode: http.StatusOK, Entries: entries})
+}
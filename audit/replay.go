@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"encoding/hex"
+	"fmt"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"strings"
+)
+
+// Replay rebuilds the merkle tree from the mutations recorded in the entries and checks that every mutation
+// starts from the root of the previous one and results in its recorded root. The log has to start from an
+// empty tree, verification entries are skipped.
+func Replay(entries []Entry) (*merkleTree.MerkleTree, error) {
+	var mt *merkleTree.MerkleTree
+	for _, entry := range entries {
+		if entry.Operation == OperationVerify {
+			continue
+		}
+		if mt == nil {
+			if entry.OldRoot != "" {
+				return nil, fmt.Errorf("audit log does not start from an empty tree, entry %d starts from root %s", entry.Sequence, entry.OldRoot)
+			}
+			algorithm, err := merkleTree.ParseHashAlgorithm(entry.HashAlgorithm)
+			if err != nil {
+				return nil, err
+			}
+			mode, err := merkleTree.ParseTreeMode(entry.TreeMode)
+			if err != nil {
+				return nil, err
+			}
+			tenancy, err := merkleTree.ParseTenancy(entry.Tenancy)
+			if err != nil {
+				return nil, err
+			}
+			mt = merkleTree.NewTreeWithTenancy(algorithm, mode, tenancy)
+		}
+
+		if root := hex.EncodeToString(mt.GetMerkleRoot()); root != entry.OldRoot {
+			return nil, fmt.Errorf("entry %d starts from root %s instead of %s", entry.Sequence, entry.OldRoot, root)
+		}
+		specHash, err := hex.DecodeString(entry.SpecHash)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d has an invalid spec hash: %w", entry.Sequence, err)
+		}
+
+		switch entry.Operation {
+		case OperationCreate:
+			mt.AppendTenantKeyedLeafHash(tenantOf(entry.FunctionIdentity), entry.FunctionIdentity, specHash)
+		case OperationUpdate:
+			if _, err = mt.RemoveTenantKeyedContent(tenantOf(entry.OldFunctionIdentity), entry.OldFunctionIdentity); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", entry.Sequence, err)
+			}
+			mt.AppendTenantKeyedLeafHash(tenantOf(entry.FunctionIdentity), entry.FunctionIdentity, specHash)
+		case OperationDelete:
+			if _, err = mt.RemoveTenantKeyedContent(tenantOf(entry.FunctionIdentity), entry.FunctionIdentity); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", entry.Sequence, err)
+			}
+		default:
+			return nil, fmt.Errorf("entry %d has unknown operation %q", entry.Sequence, entry.Operation)
+		}
+
+		if root := hex.EncodeToString(mt.GetMerkleRoot()); root != entry.NewRoot {
+			return nil, fmt.Errorf("entry %d results in root %s instead of the recorded %s", entry.Sequence, root, entry.NewRoot)
+		}
+	}
+	if mt == nil {
+		return merkleTree.NewTree(), nil
+	}
+	return mt, nil
+}
+
+// tenantOf returns the tenant of the function identity in a multi-tenant tree, which is the namespace of "namespace/name"
+func tenantOf(identity string) string {
+	namespace, _, _ := strings.Cut(identity, "/")
+	return namespace
+}
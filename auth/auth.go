@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Principal represents the authenticated identity of a request
+type Principal struct {
+	Name   string // Name is the identity the authorization rules refer to, e.g. a service account or certificate subject
+	Method Method // Method is the authentication method that authenticated the request
+}
+
+// Authenticator authenticates the credentials of a request
+type Authenticator interface {
+	// Authenticate returns the principal of the request, ErrNoCredentials is returned if the request has
+	// no credentials of the authenticator and ErrInvalidCredentials if they are not valid
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+// Method represents a supported authentication method
+type Method string
+
+// Supported authentication methods
+const (
+	MethodMTLS        Method = "mtls"         // MethodMTLS authenticates the client certificate verified by the TLS server
+	MethodBearer      Method = "bearer"       // MethodBearer authenticates JWT bearer tokens signed by a static key set or JWKS
+	MethodTokenReview Method = "token-review" // MethodTokenReview authenticates bearer tokens by a Kubernetes TokenReview
+)
+
+// ErrNoCredentials is returned when a request has no credentials of an authenticator
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials is returned when the credentials of a request are not valid
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ParseMethods returns the authentication methods of the comma separated names, no names disables authentication
+func ParseMethods(names string) ([]Method, error) {
+	var methods []Method
+	for _, name := range strings.Split(names, ",") {
+		switch method := Method(strings.TrimSpace(name)); method {
+		case "":
+			continue
+		case MethodMTLS, MethodBearer, MethodTokenReview:
+			methods = append(methods, method)
+		default:
+			return nil, fmt.Errorf("unsupported authentication method %q", name)
+		}
+	}
+	return methods, nil
+}
+
+// NewAuthenticator returns the chain of the authenticators of the methods in their order, nil if no method is given.
+// The bearer method verifies tokens with the keys of the PEM key file and the JWKS file, and checks their issuer and
+// audience if set, the token review method reviews tokens for the audience if set.
+func NewAuthenticator(methods []Method, keysFile string, jwksFile string, issuer string, audience string) (Authenticator, error) {
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	var chain Chain
+	for _, method := range methods {
+		switch method {
+		case MethodMTLS:
+			chain = append(chain, ClientCertAuthenticator{})
+		case MethodBearer:
+			keySet := &KeySet{}
+			if keysFile != "" {
+				pemKeys, err := LoadPEMKeySet(keysFile)
+				if err != nil {
+					return nil, err
+				}
+				keySet.Keys = append(keySet.Keys, pemKeys.Keys...)
+			}
+			if jwksFile != "" {
+				jwksKeys, err := LoadJWKSKeySet(jwksFile)
+				if err != nil {
+					return nil, err
+				}
+				keySet.Keys = append(keySet.Keys, jwksKeys.Keys...)
+			}
+			if len(keySet.Keys) == 0 {
+				return nil, errors.New("bearer authentication requires a key file or a JWKS file")
+			}
+			chain = append(chain, &BearerTokenAuthenticator{Keys: keySet, Issuer: issuer, Audience: audience})
+		case MethodTokenReview:
+			var audiences []string
+			if audience != "" {
+				audiences = []string{audience}
+			}
+			reviewer, err := NewInClusterTokenReviewer(audiences)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, &TokenReviewAuthenticator{Reviewer: reviewer})
+		default:
+			return nil, fmt.Errorf("unsupported authentication method %q", method)
+		}
+	}
+	return chain, nil
+}
+
+// Chain authenticates a request by the first of its authenticators that finds valid credentials
+type Chain []Authenticator
+
+// Authenticate returns the principal of the first authenticator accepting the credentials of the request,
+// the error of the first authenticator that found invalid credentials is returned if none accepts them
+func (chain Chain) Authenticate(req *http.Request) (*Principal, error) {
+	firstErr := ErrNoCredentials
+	for _, authenticator := range chain {
+		principal, err := authenticator.Authenticate(req)
+		if err == nil {
+			return principal, nil
+		}
+		if errors.Is(firstErr, ErrNoCredentials) && !errors.Is(err, ErrNoCredentials) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// bearerToken returns the token of the Authorization header of the request
+func bearerToken(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrNoCredentials
+	}
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrNoCredentials
+	}
+	return strings.TrimSpace(token), nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context holding the authenticated principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the authenticated principal of the request context, nil if the request is not authenticated
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Actor returns who made the request for the audit log, the name of the authenticated principal
+// or the remote address of an unauthenticated request
+func Actor(req *http.Request) string {
+	if principal := PrincipalFrom(req.Context()); principal != nil {
+		return principal.Name
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeTokenReviewer reviews tokens by a fixed map of tokens to usernames instead of the Kubernetes API server
+type fakeTokenReviewer struct {
+	Usernames map[string]string // Usernames maps the authenticated tokens to the username they are authenticated as
+	Err       error             // Err is returned for every review if set, e.g. as the API server is unavailable
+}
+
+// Review returns the username of the token, ErrInvalidCredentials is returned for an unknown token
+func (reviewer *fakeTokenReviewer) Review(ctx context.Context, token string) (string, error) {
+	if reviewer.Err != nil {
+		return "", reviewer.Err
+	}
+	username, found := reviewer.Usernames[token]
+	if !found {
+		return "", ErrInvalidCredentials
+	}
+	return username, nil
+}
+
+// fakeAuthenticator authenticates every request as the principal, or fails with the error
+type fakeAuthenticator struct {
+	Principal *Principal
+	Err       error
+}
+
+func (authenticator fakeAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	return authenticator.Principal, authenticator.Err
+}
+
+// controllerToken and functionToken are tokens of the Fission controller and of a function service account
+const (
+	controllerToken = "controller-token"
+	functionToken   = "function-token"
+)
+
+// newTestAuthenticator returns a token review authenticator knowing the controller and function tokens
+func newTestAuthenticator() Authenticator {
+	return Chain{&TokenReviewAuthenticator{Reviewer: &fakeTokenReviewer{Usernames: map[string]string{
+		controllerToken: constants.DefaultMutatePrincipals,
+		functionToken:   "system:serviceaccount:default:hello",
+	}}}}
+}
+
+// serve sends a request with the bearer token, none if it is empty, through the middleware and returns the status code
+// and the principal the handler was called with
+func serve(middleware func(http.Handler) http.Handler, token string) (int, *Principal) {
+	var principal *Principal
+	handler := middleware(http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		principal = PrincipalFrom(req.Context())
+		respWriter.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/fn/create", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Code, principal
+}
+
+func TestRequireCreateOnlyAllowsController(t *testing.T) {
+	create := Require(newTestAuthenticator(), ParseRule(constants.DefaultMutatePrincipals))
+
+	code, principal := serve(create, controllerToken)
+	if code != http.StatusOK || principal == nil || principal.Name != constants.DefaultMutatePrincipals || principal.Method != MethodTokenReview {
+		t.Fatalf("controller was not allowed to create: %d %v", code, principal)
+	}
+	if code, _ = serve(create, functionToken); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a function service account, found %d", code)
+	}
+	if code, _ = serve(create, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, found %d", code)
+	}
+	if code, _ = serve(create, "unknown-token"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a token rejected by the review, found %d", code)
+	}
+}
+
+func TestRequireVerifyStaysOpen(t *testing.T) {
+	verify := Require(newTestAuthenticator(), ParseRule(""))
+
+	if code, principal := serve(verify, ""); code != http.StatusOK || principal != nil {
+		t.Fatalf("unauthenticated verification was refused: %d %v", code, principal)
+	}
+	if code, principal := serve(verify, functionToken); code != http.StatusOK || principal == nil {
+		t.Fatalf("authenticated verification was refused: %d %v", code, principal)
+	}
+	// credentials are checked even on an open route, so an invalid token is never recorded as its actor
+	if code, _ := serve(verify, "unknown-token"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a token rejected by the review, found %d", code)
+	}
+	// no authenticator disables authentication
+	if code, _ := serve(Require(nil, ParseRule(constants.DefaultMutatePrincipals)), ""); code != http.StatusOK {
+		t.Fatalf("request refused without an authenticator: %d", code)
+	}
+}
+
+func TestRequireUnavailableReviewer(t *testing.T) {
+	authenticator := &TokenReviewAuthenticator{Reviewer: &fakeTokenReviewer{Err: errors.New("connection refused")}}
+	if code, _ := serve(Require(authenticator, ParseRule("")), controllerToken); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the token review is unavailable, found %d", code)
+	}
+}
+
+func TestChainAuthenticate(t *testing.T) {
+	controller := &Principal{Name: "controller", Method: MethodMTLS}
+	invalid := errors.New("invalid")
+	tests := []struct {
+		name     string
+		chain    Chain
+		expected *Principal
+		err      error
+	}{
+		{"empty chain", Chain{}, nil, ErrNoCredentials},
+		{"no credentials", Chain{fakeAuthenticator{Err: ErrNoCredentials}, fakeAuthenticator{Err: ErrNoCredentials}}, nil, ErrNoCredentials},
+		{"first without credentials", Chain{fakeAuthenticator{Err: ErrNoCredentials}, fakeAuthenticator{Principal: controller}}, controller, nil},
+		{"first accepting", Chain{fakeAuthenticator{Principal: controller}, fakeAuthenticator{Err: invalid}}, controller, nil},
+		{"later accepting", Chain{fakeAuthenticator{Err: invalid}, fakeAuthenticator{Principal: controller}}, controller, nil},
+		{"first invalid reported", Chain{fakeAuthenticator{Err: ErrNoCredentials}, fakeAuthenticator{Err: invalid}, fakeAuthenticator{Err: ErrInvalidCredentials}}, nil, invalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := test.chain.Authenticate(httptest.NewRequest(http.MethodPost, "/fn/create", nil))
+			if principal != test.expected || !errors.Is(err, test.err) {
+				t.Fatalf("expected %v %v, found %v %v", test.expected, test.err, principal, err)
+			}
+		})
+	}
+}
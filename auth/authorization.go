@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+	"strings"
+)
+
+// AnyPrincipal allows every authenticated principal in a rule
+const AnyPrincipal = "*"
+
+// Rule represents who may use a route
+type Rule struct {
+	// Principals are the names of the principals allowed to use the route, AnyPrincipal allows every authenticated
+	// principal and no principals leave the route open to unauthenticated requests
+	Principals []string
+}
+
+// ParseRule returns the rule allowing the comma separated principal names
+func ParseRule(names string) Rule {
+	var principals []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			principals = append(principals, name)
+		}
+	}
+	return Rule{Principals: principals}
+}
+
+// IsOpen returns whether the rule allows unauthenticated requests
+func (rule Rule) IsOpen() bool {
+	return len(rule.Principals) == 0
+}
+
+// Allows returns whether the rule allows the principal
+func (rule Rule) Allows(principal *Principal) bool {
+	if rule.IsOpen() {
+		return true
+	}
+	if principal == nil {
+		return false
+	}
+	for _, name := range rule.Principals {
+		if name == AnyPrincipal || name == principal.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Require is a middleware authenticating requests by the authenticator and refusing the requests the rule does not
+// allow, with 401 if they are not authenticated and 403 otherwise. The principal of an authenticated request is added
+// to its context. Requests are neither authenticated nor refused if the authenticator is nil.
+func Require(authenticator Authenticator, rule Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authenticator == nil {
+			return next
+		}
+		return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+			principal, err := authenticator.Authenticate(req)
+			switch {
+			case err == nil:
+				req = req.WithContext(WithPrincipal(req.Context(), principal))
+			case errors.Is(err, ErrNoCredentials):
+				// unauthenticated requests are refused below unless the route is open
+			case errors.Is(err, ErrInvalidCredentials):
+				fmt.Println("authentication failed:", err)
+				sendUnauthenticatedResponse(respWriter, "Invalid credentials")
+				return
+			default:
+				fmt.Println("authentication failed:", err)
+				utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+					StatusCode: http.StatusServiceUnavailable,
+					ErrorMsg:   "Credentials could not be authenticated",
+					ErrorCode:  constants.ErrCodeAuthenticationUnavailable,
+				})
+				return
+			}
+
+			if !rule.Allows(principal) {
+				if principal == nil {
+					sendUnauthenticatedResponse(respWriter, "Authentication required")
+					return
+				}
+				fmt.Println("authorization failed, principal:", principal.Name, "path:", req.URL.Path)
+				utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+					StatusCode: http.StatusForbidden,
+					ErrorMsg:   principal.Name + " is not allowed to use " + req.URL.Path,
+					ErrorCode:  constants.ErrCodeForbidden,
+				})
+				return
+			}
+			next.ServeHTTP(respWriter, req)
+		})
+	}
+}
+
+// sendUnauthenticatedResponse sends a 401 response asking for bearer token credentials
+func sendUnauthenticatedResponse(respWriter http.ResponseWriter, errMsg string) {
+	respWriter.Header().Set("WWW-Authenticate", "Bearer")
+	utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+		StatusCode: http.StatusUnauthorized,
+		ErrorMsg:   errMsg,
+		ErrorCode:  constants.ErrCodeUnauthenticated,
+	})
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the expiry and not before times of a token may be off
+const clockSkew = time.Minute
+
+// BearerTokenAuthenticator authenticates JWT bearer tokens signed by one of the keys of the key set.
+// Tokens must expire, and must be issued by the issuer and for the audience if they are set.
+type BearerTokenAuthenticator struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+}
+
+// jwtHeader represents the members of a JWT header that are checked
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwtClaims represents the registered claims of a JWT that are checked
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// Authenticate returns the principal named by the subject of a valid bearer token
+func (authenticator *BearerTokenAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	token, err := bearerToken(req)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := authenticator.verify(token, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return &Principal{Name: claims.Subject, Method: MethodBearer}, nil
+}
+
+// verify checks the signature and the claims of the token and returns its claims
+func (authenticator *BearerTokenAuthenticator) verify(token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a signed JWT")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range authenticator.Keys.candidates(header.KeyID) {
+		if verifySignature(header.Algorithm, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("token signature is not valid for any %s key", header.Algorithm)
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("token is expired or does not expire")
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if authenticator.Issuer != "" && claims.Issuer != authenticator.Issuer {
+		return nil, fmt.Errorf("token is issued by %q", claims.Issuer)
+	}
+	if authenticator.Audience != "" && !claims.hasAudience(authenticator.Audience) {
+		return nil, fmt.Errorf("token is not issued for audience %q", authenticator.Audience)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	return &claims, nil
+}
+
+// hasAudience returns whether the audience claim, a string or an array of strings, holds the audience
+func (claims *jwtClaims) hasAudience(audience string) bool {
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var single string
+		if err = json.Unmarshal(claims.Audience, &single); err != nil {
+			return false
+		}
+		audiences = []string{single}
+	}
+	for _, value := range audiences {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// verifySignature checks the JWS signature of the signed bytes with the key, the key type must match the algorithm
+func verifySignature(algorithm string, key crypto.PublicKey, signed []byte, signature []byte) bool {
+	switch algorithm {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsaKey.N.BitLen() < 2048 {
+			return false
+		}
+		hash := hashOfAlgorithm(algorithm)
+		digest := hash.New()
+		digest.Write(signed)
+		if strings.HasPrefix(algorithm, "PS") {
+			return rsa.VerifyPSS(rsaKey, hash, digest.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest.Sum(nil), signature) == nil
+	case "ES256", "ES384", "ES512":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != curveByName(ecdsaCurveNames[algorithm]) {
+			return false
+		}
+		// the signature is the fixed size big-endian encoding of r followed by s
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		digest := hashOfAlgorithm(algorithm).New()
+		digest.Write(signed)
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(ecKey, digest.Sum(nil), r, s)
+	case "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(edKey, signed, signature)
+	default:
+		return false
+	}
+}
+
+// ecdsaCurveNames maps the ECDSA JWS algorithms to the name of their curve
+var ecdsaCurveNames = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// hashOfAlgorithm returns the hash function of an RSA or ECDSA JWS algorithm
+func hashOfAlgorithm(algorithm string) crypto.Hash {
+	switch algorithm[2:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
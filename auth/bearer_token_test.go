@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signToken returns an EdDSA JWT of the claims signed by the key, with the key ID in its header if it is set
+func signToken(t *testing.T, key ed25519.PrivateKey, keyID string, claims map[string]interface{}) string {
+	header := map[string]string{"alg": "EdDSA", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to encode claims: %v", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(signed)))
+}
+
+// newKey returns a new Ed25519 key pair
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return public, private
+}
+
+func TestBearerTokenAuthenticate(t *testing.T) {
+	public, private := newKey(t)
+	otherPublic, otherPrivate := newKey(t)
+	authenticator := &BearerTokenAuthenticator{
+		Keys:     &KeySet{Keys: []Key{{ID: "key-1", Public: public}, {ID: "key-2", Public: otherPublic}}},
+		Issuer:   "https://issuer.example.com",
+		Audience: "trufaas",
+	}
+	now := time.Now().Unix()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"iss": "https://issuer.example.com", "sub": "controller", "aud": "trufaas", "exp": now + 600}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", signToken(t, private, "key-1", claims(nil)), true},
+		{"other key of the set", signToken(t, otherPrivate, "key-2", claims(nil)), true},
+		{"no key id tries every key", signToken(t, otherPrivate, "", claims(nil)), true},
+		{"key id of another key", signToken(t, private, "key-2", claims(nil)), false},
+		{"unknown key id", signToken(t, private, "key-3", claims(nil)), false},
+		{"unknown key", signToken(t, ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)), "", claims(nil)), false},
+		{"expired", signToken(t, private, "key-1", claims(map[string]interface{}{"exp": now - 120})), false},
+		{"expired within the clock skew", signToken(t, private, "key-1", claims(map[string]interface{}{"exp": now - 30})), true},
+		{"no expiry", signToken(t, private, "key-1", claims(map[string]interface{}{"exp": nil})), false},
+		{"not valid yet", signToken(t, private, "key-1", claims(map[string]interface{}{"nbf": now + 120})), false},
+		{"audience array", signToken(t, private, "key-1", claims(map[string]interface{}{"aud": []string{"other", "trufaas"}})), true},
+		{"other audience", signToken(t, private, "key-1", claims(map[string]interface{}{"aud": "other"})), false},
+		{"no audience", signToken(t, private, "key-1", claims(map[string]interface{}{"aud": nil})), false},
+		{"other issuer", signToken(t, private, "key-1", claims(map[string]interface{}{"iss": "https://other.example.com"})), false},
+		{"no subject", signToken(t, private, "key-1", claims(map[string]interface{}{"sub": nil})), false},
+		{"not a JWT", "not-a-jwt", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/fn/create", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			principal, err := authenticator.Authenticate(req)
+			if test.valid && (err != nil || principal.Name != "controller" || principal.Method != MethodBearer) {
+				t.Fatalf("valid token refused: %v %v", principal, err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected ErrInvalidCredentials, found %v %v", principal, err)
+			}
+		})
+	}
+
+	// a request without a bearer token is left to the next authenticator of a chain
+	if _, err := authenticator.Authenticate(httptest.NewRequest(http.MethodPost, "/fn/create", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without a token, found %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ClientCertAuthenticator authenticates the client certificate of a mutual TLS connection, the certificate is
+// verified against the client CA bundle by the TLS server before the request is handled
+type ClientCertAuthenticator struct{}
+
+// Authenticate returns the principal named by the first URI SAN of the verified client certificate,
+// e.g. a SPIFFE ID, or by its subject common name if it has no URI SAN
+func (ClientCertAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return &Principal{Name: cert.URIs[0].String(), Method: MethodMTLS}, nil
+	}
+	if cert.Subject.CommonName != "" {
+		return &Principal{Name: cert.Subject.CommonName, Method: MethodMTLS}, nil
+	}
+	return nil, fmt.Errorf("%w: client certificate has neither a URI SAN nor a common name", ErrInvalidCredentials)
+}
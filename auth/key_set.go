@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// KeySet holds the public keys bearer tokens may be signed with
+type KeySet struct {
+	Keys []Key
+}
+
+// Key represents a public key of a key set, keys without an ID are tried for every token
+type Key struct {
+	ID     string
+	Public crypto.PublicKey
+}
+
+// candidates returns the keys a token with the given key ID may be signed with
+func (keySet *KeySet) candidates(keyID string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for _, key := range keySet.Keys {
+		if key.ID == "" || keyID == "" || key.ID == keyID {
+			keys = append(keys, key.Public)
+		}
+	}
+	return keys
+}
+
+// LoadPEMKeySet reads a static key set from a file of PEM encoded PKIX public keys or certificates
+func LoadPEMKeySet(fileName string) (*KeySet, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &KeySet{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var public crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				public = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in %s: %w", fileName, err)
+		}
+		keySet.Keys = append(keySet.Keys, Key{Public: public})
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", fileName)
+	}
+	return keySet, nil
+}
+
+// jsonWebKey represents the members of a JSON Web Key (RFC 7517) of an RSA, EC or Ed25519 public key
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// LoadJWKSKeySet reads a key set from a JSON Web Key Set file, keys that are not signature keys are skipped
+func LoadJWKSKeySet(fileName string) (*KeySet, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %w", fileName, err)
+	}
+
+	keySet := &KeySet{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in %s: %w", jwk.KeyID, fileName, err)
+		}
+		keySet.Keys = append(keySet.Keys, Key{ID: jwk.KeyID, Public: public})
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("no signature keys found in %s", fileName)
+	}
+	return keySet, nil
+}
+
+// publicKey returns the public key of the JSON Web Key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve := curveByName(jwk.Curve)
+		if curve == nil {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+// curveByName returns the curve of the JWK curve name, nil if it is not supported
+func curveByName(name string) elliptic.Curve {
+	switch name {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	default:
+		return nil
+	}
+}
+
+// decodeBigInt decodes an unsigned big-endian integer encoded in unpadded base64url
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenReviewer reviews bearer tokens, e.g. by the Kubernetes TokenReview API, so that it can be replaced by a fake in tests
+type TokenReviewer interface {
+	// Review returns the username the token is authenticated as, ErrInvalidCredentials is returned if it is not authenticated
+	Review(ctx context.Context, token string) (string, error)
+}
+
+// TokenReviewAuthenticator authenticates bearer tokens, e.g. Kubernetes service account tokens, by a token reviewer
+type TokenReviewAuthenticator struct {
+	Reviewer TokenReviewer
+}
+
+// Authenticate returns the principal named by the username the bearer token is authenticated as,
+// e.g. system:serviceaccount:<namespace>:<name> for a Kubernetes service account
+func (authenticator *TokenReviewAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	token, err := bearerToken(req)
+	if err != nil {
+		return nil, err
+	}
+	username, err := authenticator.Reviewer.Review(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Name: username, Method: MethodTokenReview}, nil
+}
+
+// in-cluster locations of the Kubernetes API server credentials of the pod
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	tokenReviewPath         = "/apis/authentication.k8s.io/v1/tokenreviews"
+	tokenReviewTimeout      = 5 * time.Second
+)
+
+// KubernetesTokenReviewer reviews tokens by creating a TokenReview in the Kubernetes API server, with the service account
+// of the pod, which needs permission to create tokenreviews
+type KubernetesTokenReviewer struct {
+	URL       string   // URL is the base URL of the API server
+	TokenFile string   // TokenFile holds the bearer token of the component, read for every review as it is rotated
+	Audiences []string // Audiences the reviewed tokens must be issued for, empty for the audience of the API server
+	Client    *http.Client
+}
+
+// NewInClusterTokenReviewer returns a token reviewer using the API server and service account credentials of the pod
+func NewInClusterTokenReviewer(audiences []string) (*KubernetesTokenReviewer, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("token review requires running in a Kubernetes cluster")
+	}
+	caCert, err := os.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", serviceAccountCAFile)
+	}
+
+	return &KubernetesTokenReviewer{
+		URL:       "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountTokenFile,
+		Audiences: audiences,
+		Client: &http.Client{
+			Timeout:   tokenReviewTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caPool, MinVersion: tls.VersionTLS12}},
+		},
+	}, nil
+}
+
+// tokenReview represents the members of an authentication.k8s.io/v1 TokenReview that are used
+type tokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool `json:"authenticated"`
+		User          struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		Error string `json:"error"`
+	} `json:"status"`
+}
+
+// Review creates a TokenReview of the token and returns the username it is authenticated as
+func (reviewer *KubernetesTokenReviewer) Review(ctx context.Context, token string) (string, error) {
+	ownToken, err := os.ReadFile(reviewer.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	review := tokenReview{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"}
+	review.Spec.Token, review.Spec.Audiences = token, reviewer.Audiences
+	body, err := json.Marshal(review)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reviewer.URL+tokenReviewPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(ownToken)))
+	resp, err := reviewer.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token review failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token review failed with status %s", resp.Status)
+	}
+
+	var result tokenReview
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid token review response: %w", err)
+	}
+	if !result.Status.Authenticated || result.Status.User.Username == "" {
+		return "", fmt.Errorf("%w: token review rejected the token %s", ErrInvalidCredentials, result.Status.Error)
+	}
+	return result.Status.User.Username, nil
+}
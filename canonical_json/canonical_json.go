@@ -0,0 +1,84 @@
+package canonical_json
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Object is a JSON object whose values are strings, integers or nested Objects
+type Object map[string]interface{}
+
+// Encode encodes the object following the RFC 8785 JSON canonicalization scheme,
+// keys are sorted, no whitespace is written and strings are only escaped where required.
+// An error is returned if a value is not a string, an integer or an Object
+func Encode(object Object) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeObject(&buf, object); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeObject(buf *bytes.Buffer, object Object) error {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	// keys are compared by their UTF-16 code units, which matches byte order for the ASCII keys used here
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeCanonicalString(buf, key)
+		buf.WriteByte(':')
+		switch value := object[key].(type) {
+		case string:
+			writeCanonicalString(buf, value)
+		case int:
+			buf.WriteString(strconv.Itoa(value))
+		case Object:
+			if err := writeObject(buf, value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported canonical JSON value of type %T for key %q", value, key)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				// invalid UTF-8 is ranged over as utf8.RuneError, so it is written as U+FFFD
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,18 @@
+package canonical_json
+
+import (
+	"testing"
+)
+
+func TestEncodeRejectsUnsupportedValues(t *testing.T) {
+	for _, value := range []interface{}{1.5, true, nil, []string{"a"}, map[string]interface{}{"a": "b"}} {
+		if _, err := Encode(Object{"outer": Object{"value": value}}); err == nil {
+			t.Errorf("expected an error for a value of type %T", value)
+		}
+	}
+
+	data, err := Encode(Object{"b": 1, "a": Object{"c": "d"}})
+	if err != nil || string(data) != `{"a":{"c":"d"},"b":1}` {
+		t.Fatalf("unexpected canonical JSON %s (%v)", data, err)
+	}
+}
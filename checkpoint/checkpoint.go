@@ -0,0 +1,91 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
+	"time"
+)
+
+// Checkpoint represents a merkle root signed by the component, it authenticates the stored tree
+// when the root cannot be read back from the TPM, e.g. after the simulator is restarted
+type Checkpoint struct {
+	TreeSize      int    `json:"tree_size"`
+	RootHash      []byte `json:"root_hash"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Timestamp     int64  `json:"timestamp"` // Timestamp is the signing time in unix milliseconds
+	Signature     []byte `json:"signature"`
+}
+
+// New creates a checkpoint of the tree signed with the identity signing key
+func New(mt *merkleTree.MerkleTree) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		TreeSize:      mt.LeafCount,
+		RootHash:      mt.GetMerkleRoot(),
+		HashAlgorithm: string(mt.HashAlgorithm),
+		Timestamp:     time.Now().UnixMilli(),
+	}
+
+	signature, err := identity.Sign(cp.signedBytes())
+	if err != nil {
+		return nil, err
+	}
+	cp.Signature = signature
+	return cp, nil
+}
+
+// signedBytes returns the bytes covered by the signature
+func (cp *Checkpoint) signedBytes() []byte {
+	return []byte(fmt.Sprintf("trufaas-checkpoint\n%d\n%s\n%s\n%d\n",
+		cp.TreeSize, cp.HashAlgorithm, hex.EncodeToString(cp.RootHash), cp.Timestamp))
+}
+
+// Verify checks the signature of the checkpoint against the public key
+func (cp *Checkpoint) Verify(publicKey crypto.PublicKey) bool {
+	return identity.Verify(publicKey, cp.signedBytes(), cp.Signature)
+}
+
+// VerifyTrusted checks the signature of the checkpoint against the signing key and the keys of the other replicas
+// sharing the tree store, so that a tree stored by another replica is authenticated as well
+func (cp *Checkpoint) VerifyTrusted() bool {
+	for _, publicKey := range identity.TrustedKeys() {
+		if cp.Verify(publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks that the checkpoint was signed for the given tree
+func (cp *Checkpoint) Matches(mt *merkleTree.MerkleTree) bool {
+	return cp.TreeSize == mt.LeafCount &&
+		cp.HashAlgorithm == string(mt.HashAlgorithm) &&
+		bytes.Equal(cp.RootHash, mt.GetMerkleRoot())
+}
+
+// Store writes the checkpoint to the tree store
+func Store(cp *Checkpoint, treeStore store.TreeStore) error {
+	cpBytes, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return treeStore.StoreCheckpoint(cpBytes)
+}
+
+// Load reads the checkpoint from the tree store
+func Load(treeStore store.TreeStore) (*Checkpoint, error) {
+	cpBytes, err := treeStore.LoadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err = json.Unmarshal(cpBytes, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
@@ -0,0 +1,79 @@
+package checkpoint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useNewSigningKey initializes the identity with a new signing key and returns it
+func useNewSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err = identity.InitializeWithSigner(key); err != nil {
+		t.Fatalf("failed to initialize signing key: %v", err)
+	}
+	return key
+}
+
+// writeReplicaKeys writes the public keys as a PEM file and returns its name
+func writeReplicaKeys(t *testing.T, keys ...*ecdsa.PrivateKey) string {
+	var data []byte
+	for _, key := range keys {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatalf("failed to encode key: %v", err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	fileName := filepath.Join(t.TempDir(), "replicas.pem")
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatalf("failed to write replica keys: %v", err)
+	}
+	return fileName
+}
+
+func TestVerifyTrustedAcceptsReplicaKeys(t *testing.T) {
+	mt := merkleTree.NewTree().AppendKeyedContent("default/hello", []byte("hello"))
+
+	// a checkpoint signed by another replica
+	other := useNewSigningKey(t)
+	cp, err := New(mt)
+	if err != nil {
+		t.Fatalf("failed to sign checkpoint: %v", err)
+	}
+	if !cp.VerifyTrusted() || !cp.Matches(mt) {
+		t.Fatalf("checkpoint of the signing key not trusted")
+	}
+
+	useNewSigningKey(t)
+	if cp.VerifyTrusted() {
+		t.Fatalf("checkpoint of an unknown replica trusted")
+	}
+	third := useNewSigningKey(t)
+	if err = identity.LoadReplicaKeys(writeReplicaKeys(t, third, other)); err != nil {
+		t.Fatalf("failed to load replica keys: %v", err)
+	}
+	if !cp.VerifyTrusted() {
+		t.Fatalf("checkpoint of a listed replica not trusted")
+	}
+	cp.TreeSize++
+	if cp.VerifyTrusted() {
+		t.Fatalf("modified checkpoint trusted")
+	}
+
+	// only ECDSA P-256 keys sign checkpoints
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err = identity.LoadReplicaKeys(writeReplicaKeys(t, p384)); err == nil {
+		t.Fatalf("P-384 replica key loaded")
+	}
+}
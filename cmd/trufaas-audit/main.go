@@ -0,0 +1,62 @@
+// Command trufaas-audit validates an audit log offline: it checks the hash chain of the entries, replays the
+// recorded mutations to recompute the merkle root and compares it with the root of a stored tree or a given root.
+//
+//	trufaas-audit -log audit.log -tree tree.gob
+//	trufaas-audit -log audit.log -root <hex merkle root>
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"os"
+)
+
+func main() {
+	logFile := flag.String("log", constants.AuditLogFileName, "audit log to validate")
+	treeFile := flag.String("tree", "", "stored merkle tree whose root the replayed root must match")
+	expectedRoot := flag.String("root", "", "hex encoded merkle root the replayed root must match")
+	flag.Parse()
+
+	entries, err := audit.ReadLog(*logFile)
+	if err != nil {
+		fail("failed to read audit log: %v", err)
+	}
+	if err = audit.VerifyChain(entries); err != nil {
+		fail("%v", err)
+	}
+	fmt.Println("Hash chain of", len(entries), "entries is valid")
+
+	mt, err := audit.Replay(entries)
+	if err != nil {
+		fail("replay failed: %v", err)
+	}
+	replayedRoot := hex.EncodeToString(mt.GetMerkleRoot())
+	fmt.Println("Replayed merkle root:", replayedRoot, "with", mt.KeyCount(), "functions")
+
+	if *treeFile != "" {
+		data, err := os.ReadFile(*treeFile)
+		if err != nil {
+			fail("failed to read stored tree: %v", err)
+		}
+		storedTree, err := utils.DecodeMerkleTree(data)
+		if err != nil {
+			fail("failed to decode stored tree: %v", err)
+		}
+		*expectedRoot = hex.EncodeToString(storedTree.GetMerkleRoot())
+	}
+	if *expectedRoot != "" {
+		if *expectedRoot != replayedRoot {
+			fail("replayed merkle root does not match the current root %s", *expectedRoot)
+		}
+		fmt.Println("Replayed merkle root matches the current root")
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
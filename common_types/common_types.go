@@ -2,16 +2,90 @@ package common_types
 
 // SuccessResponse : struct that represents success response of all requests
 type SuccessResponse struct {
-	StatusCode    int    `json:"status_code"`
-	Msg           string `json:"msg"`
-	FnName        string `json:"fn_name"`
-	TrustVerified bool   `json:"trust_verified,omitempty"`
+	StatusCode     int             `json:"status_code"`
+	Msg            string          `json:"msg"`
+	FnName         string          `json:"fn_name"`
+	TrustVerified  bool            `json:"trust_verified,omitempty"`
+	InclusionProof *InclusionProof `json:"inclusion_proof,omitempty"`
 }
 
 // ErrorResponse : struct that represents error response of all requests
 type ErrorResponse struct {
 	StatusCode    int    `json:"status_code"`
 	ErrorMsg      string `json:"error_msg"`
+	ErrorCode     string `json:"error_code,omitempty"`
 	FnName        string `json:"fn_name,omitempty"`
 	TrustVerified *bool  `json:"trust_verified,omitempty"`
 }
+
+// InclusionProof : struct that represents the merkle inclusion proof of a function, hashes are hex encoded
+type InclusionProof struct {
+	HashAlgorithm string      `json:"hash_algorithm"`
+	LeafIndex     int         `json:"leaf_index"`
+	LeafHash      string      `json:"leaf_hash"`
+	Path          []ProofStep `json:"path"`
+	MerkleRoot    string      `json:"merkle_root"`
+	// Namespace and NamespaceProof are set in a multi-tenant tree, where MerkleRoot is the root of the namespace tree
+	// and NamespaceProof is the inclusion proof of the namespace leaf committing to it in the top-level tree
+	Namespace      string          `json:"namespace,omitempty"`
+	NamespaceProof *InclusionProof `json:"namespace_proof,omitempty"`
+}
+
+// NamespaceResponse : struct that represents the functions registered in a namespace, hashes are hex encoded
+type NamespaceResponse struct {
+	StatusCode     int                  `json:"status_code"`
+	Namespace      string               `json:"namespace"`
+	HashAlgorithm  string               `json:"hash_algorithm"`
+	MerkleRoot     string               `json:"merkle_root"`
+	Functions      []FunctionTrustValue `json:"functions"`
+	NamespaceProof *InclusionProof      `json:"namespace_proof,omitempty"`
+}
+
+// FunctionTrustValue : struct that represents a registered function and the leaf hash of its spec
+type FunctionTrustValue struct {
+	FnName   string `json:"fn_name"`
+	Identity string `json:"identity"`
+	SpecHash string `json:"spec_hash"`
+}
+
+// ProofStep : struct that represents a sibling hash of the inclusion proof, position is either "left" or "right"
+type ProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+// ConsistencyProofResponse : struct that represents the RFC 6962 consistency proof between two tree sizes, hashes are hex encoded
+type ConsistencyProofResponse struct {
+	StatusCode    int      `json:"status_code"`
+	HashAlgorithm string   `json:"hash_algorithm"`
+	From          int      `json:"from"`
+	To            int      `json:"to"`
+	FromRoot      string   `json:"from_root"`
+	ToRoot        string   `json:"to_root"`
+	Path          []string `json:"path"`
+}
+
+// QuoteResponse : struct that represents the TPM quote over the merkle root PCR, binary values are hex encoded
+type QuoteResponse struct {
+	StatusCode    int    `json:"status_code"`
+	Nonce         string `json:"nonce"`
+	Quote         string `json:"quote"`
+	Signature     string `json:"signature"`
+	PCRIndex      int    `json:"pcr_index"`
+	PCRBank       string `json:"pcr_bank"`
+	PCRValue      string `json:"pcr_value"`
+	AKPublicKey   string `json:"ak_public_key"`
+	AKPublicArea  string `json:"ak_public_area"`
+	MerkleRoot    string `json:"merkle_root"`
+	HashAlgorithm string `json:"hash_algorithm"`
+}
+
+// IdentityKeyResponse : struct that represents the long-term identity key of the component, which signs the tree heads
+// and the ephemeral public keys of the trust protocol
+type IdentityKeyResponse struct {
+	StatusCode         int    `json:"status_code"`
+	KeyID              string `json:"key_id"`
+	SignatureAlgorithm string `json:"signature_algorithm"`
+	PublicKey          string `json:"public_key"`
+	PublicKeyPEM       string `json:"public_key_pem"`
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/auth"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	serverTLS "github.com/TruFaaS/TruFaaS/server_tls"
+	"github.com/TruFaaS/TruFaaS/store"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds the configuration of the external component, read from the environment
+type Config struct {
+	HashAlgorithm merkleTree.HashAlgorithm // HashAlgorithm is used when a new merkle tree is created
+	TreeMode      merkleTree.TreeMode      // TreeMode is used when a new merkle tree is created
+	Tenancy       merkleTree.Tenancy       // Tenancy is used when a new merkle tree is created
+	TPMBackend    tpm.BackendType          // TPMBackend is the kind of TPM the merkle root is anchored in
+	TPMDevicePath string                   // TPMDevicePath is the TPM device of the device backend
+	TPMAddress    string                   // TPMAddress is the host:port of the swtpm backend
+	SigningKey    string                   // SigningKey is the PEM file of the key signing checkpoints and ephemeral keys
+	KeySource     identity.KeySource       // KeySource is whether the signing key is kept in its file or in the TPM
+	StoreBackend  store.BackendType        // StoreBackend is the kind of store the merkle tree is persisted in
+	StorePath     string                   // StorePath is the directory of the file store or the database of the bolt store
+	EtcdEndpoints []string                 // EtcdEndpoints are the client URLs of the etcd store
+	EtcdPrefix    string                   // EtcdPrefix is the key prefix of the etcd store
+	ReplicaKeys   string                   // ReplicaKeys is the PEM file of the public keys of the other replicas sharing the store
+	AuditLog      string                   // AuditLog is the file of the audit log
+	AuditVerify   bool                     // AuditVerify records verification results in the audit log
+	TreeHeadLog   string                   // TreeHeadLog is the file of the signed tree head history
+	DiscardTree   bool                     // DiscardTree replaces a stored tree whose functions are not keyed by an empty tree
+	AuthMethods   []auth.Method            // AuthMethods authenticate requests in their order, none disables authentication
+	AllowNoAuth   bool                     // AllowNoAuth allows serving without authentication when no methods are set
+	AuthKeys      string                   // AuthKeys is the PEM file of the static keys bearer tokens are signed with
+	AuthJWKS      string                   // AuthJWKS is the JWKS file of the keys bearer tokens are signed with
+	AuthIssuer    string                   // AuthIssuer is the issuer bearer tokens must be issued by
+	AuthAudience  string                   // AuthAudience is the audience bearer tokens must be issued for
+	MutateRule    auth.Rule                // MutateRule is who may create, update and delete trust values
+	VerifyRule    auth.Rule                // VerifyRule is who may verify and list trust values
+	AuditRule     auth.Rule                // AuditRule is who may read the audit log
+	TLSMode       serverTLS.Mode           // TLSMode is whether the API is served over HTTPS
+	TLSCert       string                   // TLSCert is the PEM file of the server certificate chain
+	TLSKey        string                   // TLSKey is the PEM file of the server key
+	TLSClientCA   string                   // TLSClientCA is the PEM bundle client certificates are verified against
+	TLSClientAuth serverTLS.ClientAuth     // TLSClientAuth is whether client certificates are required
+}
+
+// Load reads the configuration from the environment variables, unset variables take their default values
+func Load() (*Config, error) {
+	hashAlgorithm, err := merkleTree.ParseHashAlgorithm(os.Getenv(constants.HashAlgorithmEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	treeMode, err := merkleTree.ParseTreeMode(os.Getenv(constants.TreeModeEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	tenancy, err := merkleTree.ParseTenancy(os.Getenv(constants.TenancyEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	keySource, err := identity.ParseKeySource(os.Getenv(constants.SigningKeySourceEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	tpmBackend, err := tpm.ParseBackendType(os.Getenv(constants.TPMBackendEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	storeBackend, err := store.ParseBackendType(os.Getenv(constants.StoreBackendEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	authMethods, err := auth.ParseMethods(os.Getenv(constants.AuthMethodsEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsMode, err := serverTLS.ParseMode(os.Getenv(constants.TLSModeEnv))
+	if err != nil {
+		return nil, err
+	}
+	tlsClientAuth, err := serverTLS.ParseClientAuth(os.Getenv(constants.TLSClientAuthEnv))
+	if err != nil {
+		return nil, err
+	}
+	tlsCert, tlsKey := os.Getenv(constants.TLSCertEnv), os.Getenv(constants.TLSKeyEnv)
+	if tlsMode == serverTLS.ModeSelfSigned {
+		tlsCert = getEnvOrDefault(constants.TLSCertEnv, serverTLS.DefaultCertFile)
+		tlsKey = getEnvOrDefault(constants.TLSKeyEnv, serverTLS.DefaultKeyFile)
+	}
+
+	var etcdEndpoints []string
+	if endpoints := os.Getenv(constants.EtcdEndpointsEnv); endpoints != "" {
+		etcdEndpoints = strings.Split(endpoints, ",")
+	}
+
+	auditVerify, err := getBoolEnv(constants.AuditVerifyEnv)
+	if err != nil {
+		return nil, err
+	}
+	discardTree, err := getBoolEnv(constants.DiscardUnkeyedEnv)
+	if err != nil {
+		return nil, err
+	}
+	allowNoAuth, err := getBoolEnv(constants.AllowNoAuthEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		HashAlgorithm: hashAlgorithm,
+		TreeMode:      treeMode,
+		Tenancy:       tenancy,
+		TPMBackend:    tpmBackend,
+		TPMDevicePath: os.Getenv(constants.TPMDevicePathEnv),
+		TPMAddress:    os.Getenv(constants.TPMAddressEnv),
+		SigningKey:    getEnvOrDefault(constants.SigningKeyEnv, constants.SigningKeyFileName),
+		KeySource:     keySource,
+		StoreBackend:  storeBackend,
+		StorePath:     os.Getenv(constants.StorePathEnv),
+		EtcdEndpoints: etcdEndpoints,
+		EtcdPrefix:    os.Getenv(constants.EtcdPrefixEnv),
+		ReplicaKeys:   os.Getenv(constants.ReplicaKeysEnv),
+		AuditLog:      getEnvOrDefault(constants.AuditLogEnv, constants.AuditLogFileName),
+		AuditVerify:   auditVerify,
+		TreeHeadLog:   getEnvOrDefault(constants.TreeHeadLogEnv, constants.TreeHeadLogFileName),
+		DiscardTree:   discardTree,
+		AuthMethods:   authMethods,
+		AllowNoAuth:   allowNoAuth,
+		AuthKeys:      os.Getenv(constants.AuthKeysEnv),
+		AuthJWKS:      os.Getenv(constants.AuthJWKSEnv),
+		AuthIssuer:    os.Getenv(constants.AuthIssuerEnv),
+		AuthAudience:  os.Getenv(constants.AuthAudienceEnv),
+		MutateRule:    auth.ParseRule(getEnvOrDefault(constants.MutatePrincipalsEnv, constants.DefaultMutatePrincipals)),
+		VerifyRule:    auth.ParseRule(os.Getenv(constants.VerifyPrincipalsEnv)),
+		AuditRule:     auth.ParseRule(getEnvOrDefault(constants.AuditPrincipalsEnv, auth.AnyPrincipal)),
+		TLSMode:       tlsMode,
+		TLSCert:       tlsCert,
+		TLSKey:        tlsKey,
+		TLSClientCA:   os.Getenv(constants.TLSClientCAEnv),
+		TLSClientAuth: tlsClientAuth,
+	}, nil
+}
+
+// getBoolEnv returns the boolean value of the variable, false if it is not set
+func getBoolEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+func getEnvOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
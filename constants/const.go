@@ -11,6 +11,14 @@ const (
 
 const ContentTypeJSON = "application/json"
 const TreeStoreFileName = "tree.gob"
+const PreviousTreeStoreFileName = "tree.gob.prev"
+const CheckpointFileName = "tree.checkpoint"
+const SigningKeyFileName = "server_key.pem"
+const AuditLogFileName = "audit.log"
+const TreeHeadLogFileName = "tree_heads.log"
+
+// DefaultMutatePrincipals is the service account of the Fission controller in the default Fission installation
+const DefaultMutatePrincipals = "system:serviceaccount:fission:fission-svc"
 
 // headers
 const (
@@ -18,4 +26,82 @@ const (
 	MACHeader                        = "x-trufaas-mac"
 	ExternalComponentPublicKeyHeader = "x-trufaas-public-key"
 	InvokerPublicKeyHeader           = "x-invoker-public-key"
+	InvokerNonceHeader               = "x-invoker-nonce"
+	InvokerSuitesHeader              = "x-invoker-suites"
+	SuiteHeader                      = "x-trufaas-suite"
+	TimestampHeader                  = "x-trufaas-timestamp"
+	SpecHashHeader                   = "x-trufaas-spec-hash"
+	MerkleRootHeader                 = "x-trufaas-merkle-root"
+	KeySignatureHeader               = "x-trufaas-key-signature"
+	KeyIDHeader                      = "x-trufaas-key-id"
+)
+
+// path variables
+const (
+	NamespacePathVar = "namespace"
+)
+
+// query parameters
+const (
+	InclusionProofQueryParam = "proof"
+	NonceQueryParam          = "nonce"
+	FunctionQueryParam       = "function"
+	OperationQueryParam      = "operation"
+	FromQueryParam           = "from"
+	ToQueryParam             = "to"
+	LimitQueryParam          = "limit"
+	NamespaceQueryParam      = "namespace"
+)
+
+// error codes
+const (
+	ErrCodeUnknownFunction           = "UNKNOWN_FUNCTION"
+	ErrCodeSpecChanged               = "FUNCTION_SPEC_CHANGED"
+	ErrCodeMerkleRootMismatch        = "MERKLE_ROOT_MISMATCH"
+	ErrCodeTrustStateUnavailable     = "TRUST_STATE_UNAVAILABLE"
+	ErrCodeNotAppendOnly             = "TREE_NOT_APPEND_ONLY"
+	ErrCodeNamespaceMismatch         = "NAMESPACE_MISMATCH"
+	ErrCodeNotMultiTenant            = "TREE_NOT_MULTI_TENANT"
+	ErrCodeUnauthenticated           = "UNAUTHENTICATED"
+	ErrCodeForbidden                 = "FORBIDDEN"
+	ErrCodeAuthenticationUnavailable = "AUTHENTICATION_UNAVAILABLE"
+	ErrCodeInvalidNonce              = "INVALID_NONCE"
+	ErrCodeInvalidPublicKey          = "INVALID_PUBLIC_KEY"
+	ErrCodeUnsupportedSuite          = "UNSUPPORTED_SUITE"
+	ErrCodeUnkeyedTree               = "TREE_PREDATES_FUNCTION_KEYS"
+)
+
+// environment variables
+const (
+	HashAlgorithmEnv    = "TRUFAAS_HASH_ALGORITHM"
+	TPMBackendEnv       = "TRUFAAS_TPM_BACKEND"
+	TPMDevicePathEnv    = "TRUFAAS_TPM_DEVICE"
+	TPMAddressEnv       = "TRUFAAS_TPM_ADDRESS"
+	SigningKeyEnv       = "TRUFAAS_SIGNING_KEY_FILE"
+	SigningKeySourceEnv = "TRUFAAS_SIGNING_KEY_SOURCE"
+	StoreBackendEnv     = "TRUFAAS_STORE_BACKEND"
+	StorePathEnv        = "TRUFAAS_STORE_PATH"
+	EtcdEndpointsEnv    = "TRUFAAS_ETCD_ENDPOINTS"
+	EtcdPrefixEnv       = "TRUFAAS_ETCD_PREFIX"
+	ReplicaKeysEnv      = "TRUFAAS_REPLICA_KEYS_FILE"
+	AuditLogEnv         = "TRUFAAS_AUDIT_LOG"
+	AuditVerifyEnv      = "TRUFAAS_AUDIT_VERIFICATIONS"
+	TreeHeadLogEnv      = "TRUFAAS_TREE_HEAD_LOG"
+	DiscardUnkeyedEnv   = "TRUFAAS_DISCARD_UNKEYED_TREE"
+	TreeModeEnv         = "TRUFAAS_TREE_MODE"
+	TenancyEnv          = "TRUFAAS_TENANCY"
+	AuthMethodsEnv      = "TRUFAAS_AUTH_METHODS"
+	AuthKeysEnv         = "TRUFAAS_AUTH_KEYS_FILE"
+	AuthJWKSEnv         = "TRUFAAS_AUTH_JWKS_FILE"
+	AuthIssuerEnv       = "TRUFAAS_AUTH_ISSUER"
+	AuthAudienceEnv     = "TRUFAAS_AUTH_AUDIENCE"
+	MutatePrincipalsEnv = "TRUFAAS_MUTATE_PRINCIPALS"
+	VerifyPrincipalsEnv = "TRUFAAS_VERIFY_PRINCIPALS"
+	AuditPrincipalsEnv  = "TRUFAAS_AUDIT_PRINCIPALS"
+	AllowNoAuthEnv      = "TRUFAAS_ALLOW_UNAUTHENTICATED"
+	TLSModeEnv          = "TRUFAAS_TLS_MODE"
+	TLSCertEnv          = "TRUFAAS_TLS_CERT_FILE"
+	TLSKeyEnv           = "TRUFAAS_TLS_KEY_FILE"
+	TLSClientCAEnv      = "TRUFAAS_TLS_CLIENT_CA_FILE"
+	TLSClientAuthEnv    = "TRUFAAS_TLS_CLIENT_AUTH"
 )
@@ -1,20 +1,28 @@
 package fission
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/auth"
 	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
 	"github.com/TruFaaS/TruFaaS/constants"
 	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
-	"github.com/TruFaaS/TruFaaS/tpm"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	trustProtocol "github.com/TruFaaS/TruFaaS/trust_protocol"
 	"github.com/TruFaaS/TruFaaS/utils"
+	"github.com/gorilla/mux"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 func CreateFnTrustValue(respWriter http.ResponseWriter, req *http.Request) {
 
 	var function Function
-	var mt *merkleTree.MerkleTree
 	errResponse := commonTypes.ErrorResponse{}
 
 	// get the json value and convert to struct
@@ -25,100 +33,391 @@ func CreateFnTrustValue(respWriter http.ResponseWriter, req *http.Request) {
 		utils.SendErrorResponse(respWriter, errResponse)
 		return
 	}
+	if !inRequestedNamespace(respWriter, req, function) {
+		return
+	}
+
+	// convert the function to its canonical byte[]
+	fnByteArr, ok := canonicalBytes(respWriter, function)
+	if !ok {
+		return
+	}
 
-	// retrieves already existing merkle tree
-	mt, err = utils.RetrieveMerkleTree()
+	// replaces the previous leaf of the function if it was already registered
+	entry := &audit.Entry{Operation: audit.OperationCreate, Actor: auth.Actor(req), FunctionIdentity: function.Identity()}
+	_, err = treeManager.Mutate(entry, func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+		mt = mt.AppendTenantKeyedContent(function.Tenant(), function.Identity(), fnByteArr)
+		entry.SpecHash = keyedLeafHash(mt, function)
+		return mt, nil
+	})
 	if err != nil {
-		errResponse.StatusCode = http.StatusInternalServerError
-		errResponse.ErrorMsg = "Internal Server error"
-		utils.SendErrorResponse(respWriter, errResponse)
+		sendMutationErrorResponse(respWriter, err, function.FunctionInformation.Name)
 		return
 	}
-	// convert the function to byte[]
-	fnByteArr, err := json.Marshal(function)
+
+	// response body
+	responseBody := commonTypes.SuccessResponse{StatusCode: http.StatusCreated, Msg: "Function trust value created successfully", FnName: function.FunctionInformation.Name}
+	//send a json response back
+	utils.SendSuccessResponse(respWriter, responseBody)
+	// logs
+	fmt.Println("function created successfully, function Name: ", function.FunctionInformation.Name)
+
+}
+
+func UpdateFnTrustValue(respWriter http.ResponseWriter, req *http.Request) {
+
+	var fnUpdate FunctionUpdate
+	errResponse := commonTypes.ErrorResponse{}
+
+	// get the json value and convert to struct
+	err := json.NewDecoder(req.Body).Decode(&fnUpdate)
 	if err != nil {
-		errResponse.StatusCode = http.StatusInternalServerError
-		errResponse.ErrorMsg = "Internal Server error"
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = err.Error()
 		utils.SendErrorResponse(respWriter, errResponse)
 		return
 	}
+	fnName := fnUpdate.NewFunction.FunctionInformation.Name
+	if !inRequestedNamespace(respWriter, req, fnUpdate.OldFunction, fnUpdate.NewFunction) {
+		return
+	}
 
-	mt = mt.AppendNewContent(fnByteArr)
+	// convert the function to its canonical byte[]
+	newFnByteArr, ok := canonicalBytes(respWriter, fnUpdate.NewFunction)
+	if !ok {
+		return
+	}
 
-	err = utils.StoreMerkleTree(mt)
+	// the leaf of the old function is located by its identity, so its spec does not need to match
+	entry := &audit.Entry{
+		Operation:           audit.OperationUpdate,
+		Actor:               auth.Actor(req),
+		FunctionIdentity:    fnUpdate.NewFunction.Identity(),
+		OldFunctionIdentity: fnUpdate.OldFunction.Identity(),
+	}
+	_, err = treeManager.Mutate(entry, func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+		mt, removeErr := mt.RemoveTenantKeyedContent(fnUpdate.OldFunction.Tenant(), fnUpdate.OldFunction.Identity())
+		if removeErr != nil {
+			return nil, removeErr
+		}
+		mt = mt.AppendTenantKeyedContent(fnUpdate.NewFunction.Tenant(), fnUpdate.NewFunction.Identity(), newFnByteArr)
+		entry.SpecHash = keyedLeafHash(mt, fnUpdate.NewFunction)
+		return mt, nil
+	})
+	if errors.Is(err, merkleTree.ErrKeyNotFound) {
+		errResponse.StatusCode = http.StatusNotFound
+		errResponse.ErrorMsg = "Function trust value not found"
+		errResponse.ErrorCode = constants.ErrCodeUnknownFunction
+		errResponse.FnName = fnUpdate.OldFunction.FunctionInformation.Name
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
 	if err != nil {
-		println(err)
+		sendMutationErrorResponse(respWriter, err, fnName)
 		return
 	}
-	sim := tpm.GetInstance()
-	err = tpm.SaveToTPM(sim, mt.GetMerkleRoot())
+
+	// response body
+	responseBody := commonTypes.SuccessResponse{StatusCode: http.StatusOK, Msg: "Function trust value updated successfully", FnName: fnName}
+	//send a json response back
+	utils.SendSuccessResponse(respWriter, responseBody)
+	// logs
+	fmt.Println("function updated successfully, function Name: ", fnName)
+
+}
+
+func DeleteFnTrustValue(respWriter http.ResponseWriter, req *http.Request) {
+
+	var function Function
+	errResponse := commonTypes.ErrorResponse{}
+
+	// get the json value and convert to struct
+	err := json.NewDecoder(req.Body).Decode(&function)
 	if err != nil {
-		println(err)
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = err.Error()
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+	fnName := function.FunctionInformation.Name
+	if !inRequestedNamespace(respWriter, req, function) {
+		return
+	}
+
+	entry := &audit.Entry{Operation: audit.OperationDelete, Actor: auth.Actor(req), FunctionIdentity: function.Identity()}
+	_, err = treeManager.Mutate(entry, func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+		// the spec hash of a deletion is the hash of the removed leaf
+		entry.SpecHash = keyedLeafHash(mt, function)
+		return mt.RemoveTenantKeyedContent(function.Tenant(), function.Identity())
+	})
+	if errors.Is(err, merkleTree.ErrKeyNotFound) {
+		errResponse.StatusCode = http.StatusNotFound
+		errResponse.ErrorMsg = "Function trust value not found"
+		errResponse.ErrorCode = constants.ErrCodeUnknownFunction
+		errResponse.FnName = fnName
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+	if err != nil {
+		sendMutationErrorResponse(respWriter, err, fnName)
 		return
 	}
 
 	// response body
-	responseBody := commonTypes.SuccessResponse{StatusCode: http.StatusCreated, Msg: "Function trust value created successfully", FnName: function.FunctionInformation.Name}
+	responseBody := commonTypes.SuccessResponse{StatusCode: http.StatusOK, Msg: "Function trust value deleted successfully", FnName: fnName}
 	//send a json response back
 	utils.SendSuccessResponse(respWriter, responseBody)
 	// logs
-	fmt.Println("function created successfully, function Name: ", function.FunctionInformation.Name)
+	fmt.Println("function deleted successfully, function Name: ", fnName)
 
 }
 
+// keyedLeafHash returns the hex encoded active leaf hash of the function, empty if there is none
+func keyedLeafHash(mt *merkleTree.MerkleTree, function Function) string {
+	leafHash, _ := mt.GetTenantKeyedLeafHash(function.Tenant(), function.Identity())
+	return hex.EncodeToString(leafHash)
+}
+
+// inRequestedNamespace checks that the functions belong to the namespace of a namespace-scoped route,
+// a bad request is sent if they do not. Functions of the unscoped routes may belong to any namespace.
+func inRequestedNamespace(respWriter http.ResponseWriter, req *http.Request, functions ...Function) bool {
+	namespace, scoped := mux.Vars(req)[constants.NamespacePathVar]
+	if !scoped {
+		return true
+	}
+	for _, function := range functions {
+		if function.FunctionInformation.Namespace != namespace {
+			utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+				StatusCode: http.StatusBadRequest,
+				ErrorMsg:   fmt.Sprintf("Function is not in namespace %s", namespace),
+				ErrorCode:  constants.ErrCodeNamespaceMismatch,
+				FnName:     function.FunctionInformation.Name,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalBytes returns the canonical bytes of the function, an internal server error is sent if it cannot be encoded
+func canonicalBytes(respWriter http.ResponseWriter, function Function) ([]byte, bool) {
+	fnByteArr, err := function.CanonicalBytes()
+	if err != nil {
+		fmt.Println("failed to encode canonical bytes, function Name: ", function.FunctionInformation.Name, err)
+		utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+			StatusCode: http.StatusInternalServerError,
+			ErrorMsg:   "Internal Server error",
+			FnName:     function.FunctionInformation.Name,
+		})
+		return nil, false
+	}
+	return fnByteArr, true
+}
+
+// sendMutationErrorResponse sends an internal server error for a mutation that could not be stored or anchored
+func sendMutationErrorResponse(respWriter http.ResponseWriter, err error, fnName string) {
+	fmt.Println("failed to mutate merkle tree, function Name: ", fnName, err)
+	utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+		StatusCode: http.StatusInternalServerError,
+		ErrorMsg:   "Internal Server error",
+		FnName:     fnName,
+	})
+}
+
 func VerifyFnTrustValue(respWriter http.ResponseWriter, req *http.Request) {
 	var function Function
-	var mt *merkleTree.MerkleTree
 	errResponse := commonTypes.ErrorResponse{}
 
-	// check and set client public key value
-	clientPubKeyHeader := req.Header.Get(constants.InvokerPublicKeyHeader)
+	// set up the trust protocol with the key of the invoker, a malformed key is refused before verifying the function
+	tp, ok := trustProtocolInstance(respWriter, req)
+	if !ok {
+		return
+	}
+	nonce, err := trustProtocol.ParseNonce(req.Header.Get(constants.InvokerNonceHeader))
+	if err != nil {
+		utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			ErrorMsg:   err.Error(),
+			ErrorCode:  constants.ErrCodeInvalidNonce,
+		})
+		return
+	}
 
 	// get the json value and convert to struct
-	err := json.NewDecoder(req.Body).Decode(&function)
+	err = json.NewDecoder(req.Body).Decode(&function)
 	if err != nil {
 		errResponse.StatusCode = http.StatusBadRequest
 		errResponse.ErrorMsg = err.Error()
 		utils.SendErrorResponse(respWriter, errResponse)
 		return
 	}
+	if !inRequestedNamespace(respWriter, req, function) {
+		return
+	}
 
-	// retrieves already existing merkle tree
-	mt, err = utils.RetrieveMerkleTree()
+	// the snapshot is immutable, so the proof is generated from the same tree whose root was checked
+	mt, merkleTreeVerifiedWithTpm, err := treeManager.AnchoredSnapshot()
 	if err != nil {
+		fmt.Println("failed to verify merkle root with TPM:", err)
 		errResponse.StatusCode = http.StatusInternalServerError
 		errResponse.ErrorMsg = "Internal Server error"
 		utils.SendErrorResponse(respWriter, errResponse)
 		return
 	}
-
-	rootHash := mt.GetMerkleRoot()
-
-	sim := tpm.GetInstance()
-	merkleTreeVerifiedWithTpm, merkleRoot := tpm.VerifyMerkleRoot(sim, rootHash)
+	// convert the function to its canonical byte[]
+	fnByteArr, ok := canonicalBytes(respWriter, function)
+	if !ok {
+		return
+	}
+	transcript := verificationTranscript(mt, function, fnByteArr, nonce)
 	if !merkleTreeVerifiedWithTpm {
-		utils.SendVerificationFailureErrorResponse(respWriter, function.FunctionInformation.Name, clientPubKeyHeader)
+		utils.SendVerificationFailureErrorResponse(respWriter, function.FunctionInformation.Name, tp, transcript, constants.ErrCodeMerkleRootMismatch)
 		fmt.Println("verification failed", function.FunctionInformation.Name)
+		recordVerification(req, function, fnByteArr, mt, constants.ErrCodeMerkleRootMismatch)
 		return
 	}
+	merkleRoot := mt.GetMerkleRoot()
+
+	// in a multi-tenant tree the function is proven in its namespace tree, whose root is proven in the anchored tree
+	proof, namespaceProof, err := mt.GenerateTenantInclusionProof(function.Tenant(), function.Identity(), fnByteArr)
+	verified := err == nil && merkleTree.VerifyInclusionProof(proof.LeafHash, proof, merkleRoot)
+	var namespaceRoot []byte
+	if err == nil && namespaceProof != nil {
+		namespaceTree, _ := mt.GetTenant(function.Tenant())
+		namespaceRoot = namespaceTree.GetMerkleRoot()
+		verified = merkleTree.VerifyTenantInclusionProof(proof.LeafHash, proof, function.Tenant(), namespaceRoot, namespaceProof, merkleRoot)
+	}
+	if verified {
+		// only return the proof if the invoker asked for it
+		var proofResponse *commonTypes.InclusionProof
+		if req.URL.Query().Get(constants.InclusionProofQueryParam) == "true" {
+			proofResponse = utils.ConvertInclusionProof(proof, merkleRoot)
+			if namespaceProof != nil {
+				proofResponse = utils.ConvertInclusionProof(proof, namespaceRoot)
+				proofResponse.Namespace = function.Tenant()
+				proofResponse.NamespaceProof = utils.ConvertInclusionProof(namespaceProof, merkleRoot)
+			}
+		}
+		utils.SendVerificationSuccessResponse(respWriter, function.FunctionInformation.Name, tp, transcript, proofResponse)
+		fmt.Println("verification successful, function name: ", function.FunctionInformation.Name)
+		recordVerification(req, function, fnByteArr, mt, audit.ResultVerified)
+		return
+	}
+
+	// distinguish functions that were never registered from registered functions whose spec changed
+	errCode := constants.ErrCodeMerkleRootMismatch
+	if errors.Is(err, merkleTree.ErrKeyNotFound) {
+		errCode = constants.ErrCodeUnknownFunction
+	} else if errors.Is(err, merkleTree.ErrContentMismatch) {
+		errCode = constants.ErrCodeSpecChanged
+	}
+	utils.SendVerificationFailureErrorResponse(respWriter, function.FunctionInformation.Name, tp, transcript, errCode)
+	fmt.Println("verification failed", function.FunctionInformation.Name, errCode)
+	recordVerification(req, function, fnByteArr, mt, errCode)
 
-	fnByteArr, err := json.Marshal(function)
+}
+
+// trustProtocolInstance sets up the trust protocol of a verification with the suite negotiated with the invoker and its
+// public key, nil if the invoker did not send a key. A bad request is sent if no shared secret can be agreed on
+func trustProtocolInstance(respWriter http.ResponseWriter, req *http.Request) (*trustProtocol.TrustProtocol, bool) {
+	clientPubKeyHeader := req.Header.Get(constants.InvokerPublicKeyHeader)
+	if clientPubKeyHeader == "" {
+		return nil, true
+	}
+	errResponse := commonTypes.ErrorResponse{StatusCode: http.StatusBadRequest}
+
+	suite, err := trustProtocol.NegotiateSuite(req.Header.Get(constants.InvokerSuitesHeader))
 	if err != nil {
-		errResponse.StatusCode = http.StatusInternalServerError
-		errResponse.ErrorMsg = "Internal Server error"
+		errResponse.ErrorMsg, errResponse.ErrorCode = err.Error(), constants.ErrCodeUnsupportedSuite
 		utils.SendErrorResponse(respWriter, errResponse)
-		return
+		return nil, false
+	}
+	errResponse.ErrorCode = constants.ErrCodeInvalidPublicKey
+	clientPubKey, err := trustProtocol.ParsePublicKey(clientPubKeyHeader, suite.KeyAgreement)
+	if err != nil {
+		errResponse.ErrorMsg = err.Error()
+		utils.SendErrorResponse(respWriter, errResponse)
+		return nil, false
+	}
+	tp, err := (&trustProtocol.TrustProtocol{}).GetProtocolInstance(suite, clientPubKey)
+	if err != nil {
+		errResponse.ErrorMsg = err.Error()
+		utils.SendErrorResponse(respWriter, errResponse)
+		return nil, false
 	}
+	return tp, true
+}
 
-	contentHashVerified := mt.VerifyContentHash(fnByteArr, merkleRoot)
-	if contentHashVerified {
-		utils.SendVerificationSuccessResponse(respWriter, function.FunctionInformation.Name, clientPubKeyHeader)
-		fmt.Println("verification successful, function name: ", function.FunctionInformation.Name)
+// verificationTranscript returns the transcript the MAC of the verification response authenticates, with the leaf hash
+// of the requested spec and the anchored merkle root, the verdict is set when the response is sent
+func verificationTranscript(mt *merkleTree.MerkleTree, function Function, fnByteArr []byte, nonce []byte) *trustProtocol.Transcript {
+	return &trustProtocol.Transcript{
+		Function:   function.Identity(),
+		SpecHash:   merkleTree.HashLeaf(mt.HashAlgorithm, fnByteArr),
+		MerkleRoot: mt.GetMerkleRoot(),
+		Nonce:      nonce,
+		Timestamp:  time.Now().UnixMilli(),
+	}
+}
 
-	} else {
-		utils.SendVerificationFailureErrorResponse(respWriter, function.FunctionInformation.Name, clientPubKeyHeader)
-		fmt.Println("verification failed", function.FunctionInformation.Name)
+// recordVerification records the verification result in the audit log if verifications are audited
+func recordVerification(req *http.Request, function Function, fnByteArr []byte, mt *merkleTree.MerkleTree, result string) {
+	if !audit.RecordsVerifications() {
+		return
+	}
+	root := hex.EncodeToString(mt.GetMerkleRoot())
+	err := audit.Record(&audit.Entry{
+		Operation:        audit.OperationVerify,
+		Actor:            auth.Actor(req),
+		FunctionIdentity: function.Identity(),
+		SpecHash:         hex.EncodeToString(merkleTree.HashLeaf(mt.HashAlgorithm, fnByteArr)),
+		HashAlgorithm:    string(mt.HashAlgorithm),
+		OldRoot:          root,
+		NewRoot:          root,
+		Result:           result,
+	})
+	if err != nil {
+		fmt.Println("failed to record verification in the audit log:", err)
+	}
+}
 
+// ListFnTrustValues sends the functions registered in the namespace of the route with the leaf hashes of their specs,
+// and the root of the namespace tree together with its inclusion proof in the anchored tree if the tree is multi-tenant
+func ListFnTrustValues(respWriter http.ResponseWriter, req *http.Request) {
+	namespace := mux.Vars(req)[constants.NamespacePathVar]
+	mt := treeManager.Snapshot()
+
+	response := commonTypes.NamespaceResponse{
+		StatusCode:    http.StatusOK,
+		Namespace:     namespace,
+		HashAlgorithm: string(mt.HashAlgorithm),
+		Functions:     make([]commonTypes.FunctionTrustValue, 0),
 	}
+	namespaceTree, found := mt.GetTenant(namespace)
+	if !found {
+		utils.SendJSONResponse(respWriter, http.StatusOK, response)
+		return
+	}
+	response.MerkleRoot = hex.EncodeToString(namespaceTree.GetMerkleRoot())
+	if namespaceProof, err := mt.GenerateTenantProof(namespace); err == nil {
+		response.NamespaceProof = utils.ConvertInclusionProof(namespaceProof, mt.GetMerkleRoot())
+	}
+
+	// a single tenant tree holds the functions of all namespaces
+	prefix := namespace + "/"
+	namespaceTree.ForEachKey(func(identity string, leafHash []byte) {
+		if !strings.HasPrefix(identity, prefix) {
+			return
+		}
+		response.Functions = append(response.Functions, commonTypes.FunctionTrustValue{
+			FnName:   strings.TrimPrefix(identity, prefix),
+			Identity: identity,
+			SpecHash: hex.EncodeToString(leafHash),
+		})
+	})
+	sort.Slice(response.Functions, func(i, j int) bool {
+		return response.Functions[i].Identity < response.Functions[j].Identity
+	})
 
+	utils.SendJSONResponse(respWriter, http.StatusOK, response)
 }
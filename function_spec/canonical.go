@@ -0,0 +1,62 @@
+package function_spec
+
+import (
+	"encoding/base64"
+	canonicalJSON "github.com/TruFaaS/TruFaaS/canonical_json"
+)
+
+// CanonicalBytes returns the bytes of the function that are hashed into the merkle tree.
+//
+// Only trust-relevant fields are included, these are the fields that decide which code runs and in
+// which environment: the function and package identities, the environments, the package reference,
+// the source and deployment archives and the build command. Operational fields (invoke strategy,
+// timeouts, concurrency, requests per pod) and the package reference resource version, which changes
+// on every write to the package, are excluded. Every included field is always written, empty or not.
+//
+// The fields are encoded as RFC 8785 canonical JSON, e.g. a function with only a name and namespace is
+//
+//	{"function":{"environment":{"name":"","namespace":""},"name":"hello","namespace":"default","package_ref":{"name":"","namespace":""}},"package":{...}}
+func (function Function) CanonicalBytes() ([]byte, error) {
+	fnInfo := function.FunctionInformation
+	pkgInfo := function.PackageInformation
+
+	return canonicalJSON.Encode(canonicalJSON.Object{
+		"function": canonicalJSON.Object{
+			"name":        fnInfo.Name,
+			"namespace":   fnInfo.Namespace,
+			"environment": canonicalEnvironment(fnInfo.Spec.Environment),
+			"package_ref": canonicalJSON.Object{
+				"name":      fnInfo.Spec.PackageRef.Name,
+				"namespace": fnInfo.Spec.PackageRef.Namespace,
+			},
+		},
+		"package": canonicalJSON.Object{
+			"name":        pkgInfo.Name,
+			"namespace":   pkgInfo.Namespace,
+			"environment": canonicalEnvironment(pkgInfo.Spec.Environment),
+			"source":      canonicalArchive(pkgInfo.Spec.Source),
+			"deployment":  canonicalArchive(pkgInfo.Spec.Deployment),
+			"buildcmd":    pkgInfo.Spec.Buildcmd,
+		},
+	})
+}
+
+func canonicalEnvironment(environment Environment) canonicalJSON.Object {
+	return canonicalJSON.Object{
+		"name":      environment.Name,
+		"namespace": environment.Namespace,
+	}
+}
+
+func canonicalArchive(archive Archive) canonicalJSON.Object {
+	return canonicalJSON.Object{
+		"type": archive.Type,
+		// the literal is encoded as standard base64 with padding, as in the request body
+		"literal": base64.StdEncoding.EncodeToString(archive.Literal),
+		"url":     archive.URL,
+		"checksum": canonicalJSON.Object{
+			"type": archive.Checksum.Type,
+			"sum":  archive.Checksum.Sum,
+		},
+	}
+}
@@ -0,0 +1,133 @@
+package function_spec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"testing"
+)
+
+// minimalFunction is a request body of a function with only a name and namespace
+const minimalFunction = `{"function_information":{"function_name":"hello","function_namespace":"default"}}`
+
+// fullFunction is a request body of a function with every field set
+const fullFunction = `{
+	"function_information": {
+		"function_name": "hello",
+		"function_namespace": "default",
+		"function_spec": {
+			"environment": {"namespace": "default", "name": "nodejs"},
+			"package_ref": {"namespace": "default", "name": "hello-pkg", "resource_version": "1234"},
+			"invoke_strategy": {
+				"execution_strategy": {"executor-type": "poolmgr", "min_scale": 1, "max_scale": 3, "target_cpu_percent": 80, "specialization_timeout": 120},
+				"strategy_type": "execution"
+			},
+			"function_timeout": 60,
+			"idle_timeout": 120,
+			"concurrency": 500,
+			"requests_per_pod": 1
+		}
+	},
+	"package_information": {
+		"package_name": "hello-pkg",
+		"package_namespace": "default",
+		"package_spec": {
+			"environment": {"namespace": "default", "name": "nodejs"},
+			"source": {"type": "url", "url": "https://example.com/src.zip", "checksum": {"type": "sha256", "sum": "ab12"}},
+			"deployment": {"type": "literal", "literal": "aGVsbG8=", "checksum": {"type": "sha256", "sum": "cd34"}},
+			"buildcmd": "./build.sh"
+		}
+	}
+}`
+
+// fullFunctionReordered is fullFunction with its fields in another order, without whitespace and with unknown fields
+const fullFunctionReordered = `{"package_information":{"package_spec":{"buildcmd":"./build.sh",` +
+	`"deployment":{"checksum":{"sum":"cd34","type":"sha256"},"literal":"aGVsbG8=","type":"literal"},` +
+	`"source":{"checksum":{"sum":"ab12","type":"sha256"},"url":"https://example.com/src.zip","type":"url"},` +
+	`"environment":{"name":"nodejs","namespace":"default"}},"package_namespace":"default","package_name":"hello-pkg","labels":{"team":"a"}},` +
+	`"function_information":{"function_spec":{"requests_per_pod":1,"concurrency":500,"idle_timeout":120,"function_timeout":60,` +
+	`"invoke_strategy":{"strategy_type":"execution","execution_strategy":{"executor-type":"poolmgr"}},` +
+	`"package_ref":{"resource_version":"5678","name":"hello-pkg","namespace":"default"},` +
+	`"environment":{"name":"nodejs","namespace":"default"}},"function_namespace":"default","function_name":"hello"}}`
+
+const (
+	minimalBytes = `{"function":{"environment":{"name":"","namespace":""},"name":"hello","namespace":"default","package_ref":{"name":"","namespace":""}},` +
+		`"package":{"buildcmd":"","deployment":{"checksum":{"sum":"","type":""},"literal":"","type":"","url":""},"environment":{"name":"","namespace":""},` +
+		`"name":"","namespace":"","source":{"checksum":{"sum":"","type":""},"literal":"","type":"","url":""}}}`
+	minimalLeafHash = "b6002d8670fd060150fa896d1d2213c5dc8889e0cf984e79f95df25d47ef726f"
+
+	fullBytes = `{"function":{"environment":{"name":"nodejs","namespace":"default"},"name":"hello","namespace":"default","package_ref":{"name":"hello-pkg","namespace":"default"}},` +
+		`"package":{"buildcmd":"./build.sh","deployment":{"checksum":{"sum":"cd34","type":"sha256"},"literal":"aGVsbG8=","type":"literal","url":""},` +
+		`"environment":{"name":"nodejs","namespace":"default"},"name":"hello-pkg","namespace":"default",` +
+		`"source":{"checksum":{"sum":"ab12","type":"sha256"},"literal":"","type":"url","url":"https://example.com/src.zip"}}}`
+	fullLeafHash = "16a283aa5518ba51a75b4426fc7e8e0d3afb6548f38a06f56edd4954b9c534a6"
+
+	escapedBytes = `{"function":{"environment":{"name":"","namespace":""},"name":"say \"hi\"\\\n\u0001é","namespace":"default","package_ref":{"name":"","namespace":""}},` +
+		`"package":{"buildcmd":"","deployment":{"checksum":{"sum":"","type":""},"literal":"","type":"","url":""},"environment":{"name":"","namespace":""},` +
+		`"name":"","namespace":"","source":{"checksum":{"sum":"","type":""},"literal":"","type":"","url":""}}}`
+	escapedLeafHash = "e4d13ef6eebaed674e28db32fb2228d5033b983db1052ccea5817504eed53313"
+)
+
+// decodeFunction decodes the request body of a function
+func decodeFunction(t *testing.T, body string) Function {
+	var function Function
+	if err := json.Unmarshal([]byte(body), &function); err != nil {
+		t.Fatalf("failed to decode function: %v", err)
+	}
+	return function
+}
+
+// assertCanonical checks the canonical bytes of the function and their SHA-256 leaf hash against the golden values
+func assertCanonical(t *testing.T, function Function, expectedBytes string, expectedLeafHash string) {
+	fnByteArr, err := function.CanonicalBytes()
+	if err != nil {
+		t.Fatalf("failed to encode canonical bytes: %v", err)
+	}
+	if string(fnByteArr) != expectedBytes {
+		t.Fatalf("canonical bytes differ\nexpected %s\nfound    %s", expectedBytes, fnByteArr)
+	}
+	if leafHash := hex.EncodeToString(merkleTree.HashLeaf(merkleTree.SHA256, fnByteArr)); leafHash != expectedLeafHash {
+		t.Fatalf("leaf hash differs, expected %s, found %s", expectedLeafHash, leafHash)
+	}
+}
+
+func TestCanonicalBytesGolden(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedBytes string
+		expectedHash  string
+	}{
+		{"minimal function", minimalFunction, minimalBytes, minimalLeafHash},
+		{"full function", fullFunction, fullBytes, fullLeafHash},
+		// the order of the fields, whitespace and fields that are not trust-relevant or unknown do not change the bytes
+		{"reordered fields", fullFunctionReordered, fullBytes, fullLeafHash},
+		{"escaped name", `{"function_information":{"function_name":"say \"hi\"\\\n\u0001é","function_namespace":"default"}}`, escapedBytes, escapedLeafHash},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertCanonical(t, decodeFunction(t, test.body), test.expectedBytes, test.expectedHash)
+		})
+	}
+}
+
+func TestCanonicalBytesOptionalFields(t *testing.T) {
+	// an optional field that was not set is written empty, so setting it changes the bytes
+	function := decodeFunction(t, minimalFunction)
+	function.PackageInformation.Spec.Buildcmd = "./build.sh"
+	fnByteArr, err := function.CanonicalBytes()
+	if err != nil {
+		t.Fatalf("failed to encode canonical bytes: %v", err)
+	}
+	if string(fnByteArr) == minimalBytes {
+		t.Fatalf("canonical bytes unchanged by setting the build command")
+	}
+
+	// operational fields and the package resource version are not trust-relevant
+	function = decodeFunction(t, fullFunction)
+	function.FunctionInformation.Spec.FunctionTimeout = 1
+	function.FunctionInformation.Spec.Concurrency = 1
+	function.FunctionInformation.Spec.InvokeStrategy = InvokeStrategy{StrategyType: "other"}
+	function.FunctionInformation.Spec.PackageRef.ResourceVersion = "9999"
+	assertCanonical(t, function, fullBytes, fullLeafHash)
+}
@@ -0,0 +1,122 @@
+package health
+
+import (
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+	"sync"
+)
+
+// Status represents whether the stored trust state can be served
+type Status string
+
+const (
+	StatusStarting     Status = "starting"     // StatusStarting is set until the startup reconciliation is done
+	StatusHealthy      Status = "healthy"      // StatusHealthy means the stored tree is anchored in the TPM
+	StatusInconsistent Status = "inconsistent" // StatusInconsistent means the stored tree could not be authenticated
+	StatusDegraded     Status = "degraded"     // StatusDegraded means the tree is anchored but a tree head is missing
+)
+
+var mutex sync.RWMutex
+var status = StatusStarting
+var reason = ""
+var errorCode = ""
+
+// Set sets the current status, the reason describes why the state is not healthy
+func Set(newStatus Status, newReason string) {
+	SetWithCode(newStatus, newReason, "")
+}
+
+// SetWithCode sets the current status with the error code refused requests are answered with, so that clients can
+// tell a state that needs an operator from one that is only unavailable for a while
+func SetWithCode(newStatus Status, newReason string, newErrorCode string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	status, reason, errorCode = newStatus, newReason, newErrorCode
+}
+
+// Degrade sets the degraded status unless the state is already not healthy, the trust state is still served
+func Degrade(newReason string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if status == StatusHealthy {
+		status, reason, errorCode = StatusDegraded, newReason, ""
+	}
+}
+
+// Recover sets the healthy status if the status is inconsistent for one of the reasons, so that a failure that is
+// resolved, e.g. a TPM that could not be written temporarily, no longer refuses the trust state
+func Recover(reasons ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if status != StatusInconsistent {
+		return
+	}
+	for _, failedReason := range reasons {
+		if reason == failedReason {
+			status, reason, errorCode = StatusHealthy, "", ""
+			return
+		}
+	}
+}
+
+// Get returns the current status and its reason
+func Get() (Status, string) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return status, reason
+}
+
+// getErrorCode returns the error code requests are refused with in the current status
+func getErrorCode() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if errorCode == "" {
+		return constants.ErrCodeTrustStateUnavailable
+	}
+	return errorCode
+}
+
+// HealthResponse : struct that represents the response of the health endpoint
+type HealthResponse struct {
+	Status    Status `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// serving reports whether the trust state is served in the status
+func serving(currentStatus Status) bool {
+	return currentStatus == StatusHealthy || currentStatus == StatusDegraded
+}
+
+// HealthHandler responds with the current status, 200 if the trust state is served and 503 otherwise
+func HealthHandler(respWriter http.ResponseWriter, req *http.Request) {
+	currentStatus, currentReason := Get()
+	response := HealthResponse{Status: currentStatus, Reason: currentReason}
+	statusCode := http.StatusOK
+	if !serving(currentStatus) {
+		statusCode, response.ErrorCode = http.StatusServiceUnavailable, getErrorCode()
+	}
+	utils.SendJSONResponse(respWriter, statusCode, response)
+}
+
+// RequireHealthy is a middleware refusing requests with 503 while the trust state is not served
+func RequireHealthy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		currentStatus, currentReason := Get()
+		if !serving(currentStatus) {
+			errMsg := "Trust state is " + string(currentStatus)
+			if currentReason != "" {
+				errMsg += ", " + currentReason
+			}
+			utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{
+				StatusCode: http.StatusServiceUnavailable,
+				ErrorMsg:   errMsg,
+				ErrorCode:  getErrorCode(),
+			})
+			return
+		}
+		next.ServeHTTP(respWriter, req)
+	})
+}
@@ -0,0 +1,181 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SignatureAlgorithm describes how the signing key signs, ECDSA P-256 signatures over SHA-256 digests in ASN.1 encoding
+const SignatureAlgorithm = "ECDSA-P256-SHA256"
+
+// KeySource represents where the signing key is kept
+type KeySource string
+
+// Supported key sources
+const (
+	FileKeySource KeySource = "file" // FileKeySource keeps the signing key in a PEM file
+	TPMKeySource  KeySource = "tpm"  // TPMKeySource keeps the signing key in the TPM, it never leaves it
+)
+
+// ParseKeySource returns the key source with the given name, an empty name returns FileKeySource
+func ParseKeySource(name string) (KeySource, error) {
+	switch source := KeySource(name); source {
+	case "":
+		return FileKeySource, nil
+	case FileKeySource, TPMKeySource:
+		return source, nil
+	default:
+		return "", fmt.Errorf("unsupported signing key source %q", name)
+	}
+}
+
+// signer is the long-term signing key of the component
+var signer crypto.Signer
+
+// replicaKeys are the public keys of the signing keys of the other replicas sharing the tree store
+var replicaKeys []crypto.PublicKey
+
+// Initialize loads the ECDSA P-256 signing key from the PEM file, a new key is generated and stored if the file does not exist
+func Initialize(keyFile string) error {
+	pemBytes, err := os.ReadFile(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No signing key found, generating a new one in", keyFile)
+		return generateKey(keyFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("signing key in %s is not an ECDSA key", keyFile)
+	}
+	signer = ecKey
+	return nil
+}
+
+func generateKey(keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	// only the component itself may read the key
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	signer = key
+	return nil
+}
+
+// InitializeWithSigner uses the signer as the signing key, e.g. a key resident in the TPM, which must be an
+// ECDSA P-256 key producing ASN.1 signatures
+func InitializeWithSigner(keySigner crypto.Signer) error {
+	publicKey, ok := keySigner.Public().(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return errors.New("signing key is not an ECDSA P-256 key")
+	}
+	signer = keySigner
+	return nil
+}
+
+// LoadReplicaKeys reads the public keys of the other replicas sharing the tree store, whose checkpoints are trusted,
+// from a file of PEM encoded PKIX ECDSA P-256 public keys
+func LoadReplicaKeys(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var keys []crypto.PublicKey
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid replica key in %s: %w", fileName, err)
+		}
+		if ecKey, ok := key.(*ecdsa.PublicKey); !ok || ecKey.Curve != elliptic.P256() {
+			return fmt.Errorf("replica key in %s is not an ECDSA P-256 key", fileName)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no public keys found in %s", fileName)
+	}
+	replicaKeys = keys
+	return nil
+}
+
+// TrustedKeys returns the public key of the signing key followed by the keys of the other replicas
+func TrustedKeys() []crypto.PublicKey {
+	keys := make([]crypto.PublicKey, 0, len(replicaKeys)+1)
+	if signer != nil {
+		keys = append(keys, signer.Public())
+	}
+	return append(keys, replicaKeys...)
+}
+
+// GetSigner returns the signing key, nil if Initialize was not called
+func GetSigner() crypto.Signer {
+	return signer
+}
+
+// PublicKeyDER returns the PKIX encoding of the public key of the signing key
+func PublicKeyDER() ([]byte, error) {
+	if signer == nil {
+		return nil, errors.New("signing key is not initialized")
+	}
+	return x509.MarshalPKIXPublicKey(signer.Public())
+}
+
+// KeyID returns the hex encoded SHA-256 of the PKIX encoded public key, which identifies the signing key
+func KeyID() (string, error) {
+	der, err := PublicKeyDER()
+	if err != nil {
+		return "", err
+	}
+	keyID := sha256.Sum256(der)
+	return hex.EncodeToString(keyID[:]), nil
+}
+
+// Sign signs the SHA-256 digest of the message with the signing key, the signature is ASN.1 encoded
+func Sign(message []byte) ([]byte, error) {
+	if signer == nil {
+		return nil, errors.New("signing key is not initialized")
+	}
+	digest := sha256.Sum256(message)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Verify checks the ASN.1 encoded signature of the message against the public key
+func Verify(publicKey crypto.PublicKey, message []byte, signature []byte) bool {
+	ecPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	digest := sha256.Sum256(message)
+	return ecdsa.VerifyASN1(ecPublicKey, digest[:], signature)
+}
@@ -0,0 +1,31 @@
+package identity_key
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/identity"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+)
+
+// KeyHandler responds with the public identity key, invokers pin it, or its key id, to authenticate the
+// x-trufaas-key-signature header of verification responses
+func KeyHandler(respWriter http.ResponseWriter, req *http.Request) {
+	der, err := identity.PublicKeyDER()
+	if err != nil {
+		fmt.Println("failed to serve identity key:", err)
+		utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{StatusCode: http.StatusInternalServerError, ErrorMsg: "Internal Server error"})
+		return
+	}
+	keyID, _ := identity.KeyID()
+
+	utils.SendJSONResponse(respWriter, http.StatusOK, commonTypes.IdentityKeyResponse{
+		StatusCode:         http.StatusOK,
+		KeyID:              keyID,
+		SignatureAlgorithm: identity.SignatureAlgorithm,
+		PublicKey:          hex.EncodeToString(der),
+		PublicKeyPEM:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+}
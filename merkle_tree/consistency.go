@@ -0,0 +1,130 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrNotAppendOnly is returned when a consistency proof is requested from a tree that is not append-only
+var ErrNotAppendOnly = errors.New("consistency proofs require an append-only merkle tree")
+
+// ErrInvalidTreeSize is returned when the tree sizes of a consistency proof are out of range
+var ErrInvalidTreeSize = errors.New("tree sizes must satisfy 0 < from <= to <= tree size")
+
+// ConsistencyProof represents the RFC 6962 proof that the tree of size To extends the tree of size From
+type ConsistencyProof struct {
+	HashAlgorithm HashAlgorithm // HashAlgorithm is the hash function of the tree the proof is generated from
+	From          int           // From is the size of the earlier tree
+	To            int           // To is the size of the later tree
+	FromRoot      []byte        // FromRoot is the root of the first From leafs
+	ToRoot        []byte        // ToRoot is the root of the first To leafs
+	Path          [][]byte      // Path holds the node hashes of the proof
+}
+
+// GenerateConsistencyProof returns the proof that the first to leafs of the tree extend its first from leafs
+func (t *MerkleTree) GenerateConsistencyProof(from int, to int) (*ConsistencyProof, error) {
+	if !t.IsAppendOnly() {
+		return nil, ErrNotAppendOnly
+	}
+	if from < 1 || from > to || to > t.LeafCount {
+		return nil, ErrInvalidTreeSize
+	}
+
+	return &ConsistencyProof{
+		HashAlgorithm: t.HashAlgorithm,
+		From:          from,
+		To:            to,
+		FromRoot:      t.subtreeHash(0, from),
+		ToRoot:        t.subtreeHash(0, to),
+		Path:          t.subProof(from, 0, to, true),
+	}, nil
+}
+
+// subProof is SUBPROOF(m, D[start:end], b) of RFC 6962 section 2.1.2
+func (t *MerkleTree) subProof(m int, start int, end int, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{t.subtreeHash(start, end)}
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return append(t.subProof(m, start, start+k, complete), t.subtreeHash(start+k, end))
+	}
+	return append(t.subProof(m-k, start+k, end, false), t.subtreeHash(start, start+k))
+}
+
+// subtreeHash returns the RFC 6962 root of the leafs in [start, end), perfect subtrees are read from the levels
+func (t *MerkleTree) subtreeHash(start int, end int) []byte {
+	n := end - start
+	if n == 1 {
+		return t.node(0, start)
+	}
+	if n&(n-1) == 0 && start%n == 0 {
+		level := 0
+		for size := n; size > 1; size >>= 1 {
+			level++
+		}
+		return t.node(level, start/n)
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	return hashNode(t.newHashFunc(), t.subtreeHash(start, start+k), t.subtreeHash(start+k, end))
+}
+
+// largestPowerOfTwoBelow returns the largest power of two smaller than n, n must be greater than 1
+func largestPowerOfTwoBelow(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// VerifyConsistencyProof checks that the proof shows the tree with root toRoot extends the tree with root fromRoot,
+// following the verification algorithm of RFC 9162 section 2.1.4.2
+func VerifyConsistencyProof(proof *ConsistencyProof, fromRoot []byte, toRoot []byte) bool {
+	if proof == nil || proof.From < 1 || proof.From > proof.To {
+		return false
+	}
+	if proof.From == proof.To {
+		return len(proof.Path) == 0 && bytes.Equal(fromRoot, toRoot)
+	}
+	if len(proof.Path) == 0 {
+		return false
+	}
+
+	path := proof.Path
+	// the root of a perfect earlier tree is a node of the later tree, it starts the path
+	if proof.From&(proof.From-1) == 0 {
+		path = append([][]byte{fromRoot}, path...)
+	}
+
+	h := NewHashFunc(proof.HashAlgorithm)
+	fn, sn := proof.From-1, proof.To-1
+	for fn&1 == 1 {
+		fn, sn = fn>>1, sn>>1
+	}
+
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashNode(h, c, fr)
+			sr = hashNode(h, c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			sr = hashNode(h, sr, c)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+
+	return bytes.Equal(fr, fromRoot) && bytes.Equal(sr, toRoot) && sn == 0
+}
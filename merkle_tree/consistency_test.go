@@ -0,0 +1,123 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestConsistencyProofRoundTrip(t *testing.T) {
+	const size = 33
+	mt := newKeyedTree(AppendOnlyMode, size)
+	roots := make([][]byte, size+1)
+	for n := 1; n <= size; n++ {
+		roots[n] = newKeyedTree(AppendOnlyMode, n).GetMerkleRoot()
+	}
+
+	for from := 1; from <= size; from++ {
+		for to := from; to <= size; to++ {
+			proof, err := mt.GenerateConsistencyProof(from, to)
+			if err != nil {
+				t.Fatalf("proof from %d to %d failed: %v", from, to, err)
+			}
+			// the roots of the proof are those of the trees that held the first leafs
+			if !bytes.Equal(proof.FromRoot, roots[from]) || !bytes.Equal(proof.ToRoot, roots[to]) {
+				t.Fatalf("proof from %d to %d has roots other than the trees of those sizes", from, to)
+			}
+			if !VerifyConsistencyProof(proof, roots[from], roots[to]) {
+				t.Fatalf("proof from %d to %d is not verified", from, to)
+			}
+		}
+	}
+}
+
+func TestConsistencyProofRefusesTampering(t *testing.T) {
+	mt := newKeyedTree(AppendOnlyMode, 21)
+	fromRoot := newKeyedTree(AppendOnlyMode, 6).GetMerkleRoot()
+	toRoot := mt.GetMerkleRoot()
+	proof, err := mt.GenerateConsistencyProof(6, 21)
+	if err != nil {
+		t.Fatalf("proof failed: %v", err)
+	}
+
+	// copyProof returns a copy of the proof whose path can be changed
+	copyProof := func() *ConsistencyProof {
+		copied := *proof
+		copied.Path = make([][]byte, len(proof.Path))
+		for i, hash := range proof.Path {
+			copied.Path[i] = append([]byte{}, hash...)
+		}
+		return &copied
+	}
+	tampered := map[string]func() bool{
+		"flipped path byte": func() bool {
+			p := copyProof()
+			p.Path[1][0] ^= 0x01
+			return VerifyConsistencyProof(p, fromRoot, toRoot)
+		},
+		"dropped path hash": func() bool {
+			p := copyProof()
+			p.Path = p.Path[:len(p.Path)-1]
+			return VerifyConsistencyProof(p, fromRoot, toRoot)
+		},
+		"extra path hash": func() bool {
+			p := copyProof()
+			p.Path = append(p.Path, toRoot)
+			return VerifyConsistencyProof(p, fromRoot, toRoot)
+		},
+		"wrong from size": func() bool {
+			p := copyProof()
+			p.From = 7
+			return VerifyConsistencyProof(p, fromRoot, toRoot)
+		},
+		"swapped sizes": func() bool {
+			p := copyProof()
+			p.From, p.To = p.To, p.From
+			return VerifyConsistencyProof(p, toRoot, fromRoot)
+		},
+		"wrong from root": func() bool {
+			return VerifyConsistencyProof(proof, newKeyedTree(AppendOnlyMode, 5).GetMerkleRoot(), toRoot)
+		},
+		"wrong to root": func() bool {
+			return VerifyConsistencyProof(proof, fromRoot, newKeyedTree(AppendOnlyMode, 20).GetMerkleRoot())
+		},
+		"no proof": func() bool {
+			return VerifyConsistencyProof(nil, fromRoot, toRoot)
+		},
+	}
+	for name, verify := range tampered {
+		if verify() {
+			t.Errorf("%s: expected the proof to be refused", name)
+		}
+	}
+}
+
+func TestConsistencyProofAcrossRemoval(t *testing.T) {
+	mt := newKeyedTree(AppendOnlyMode, 10)
+	fromRoot := mt.GetMerkleRoot()
+
+	// the removal appends a tombstone, so the later tree still extends the earlier one
+	removed, err := mt.Clone().RemoveKeyedContent("key-3")
+	if err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if removed.LeafCount != 11 || removed.KeyCount() != 9 {
+		t.Fatalf("expected 11 leafs and 9 keys, found %d and %d", removed.LeafCount, removed.KeyCount())
+	}
+	proof, err := removed.GenerateConsistencyProof(10, 11)
+	if err != nil || !VerifyConsistencyProof(proof, fromRoot, removed.GetMerkleRoot()) {
+		t.Fatalf("expected the tree after the removal to extend the earlier tree (%v)", err)
+	}
+}
+
+func TestConsistencyProofRequiresAppendOnlyTree(t *testing.T) {
+	if _, err := newKeyedTree(MutableMode, 4).GenerateConsistencyProof(1, 4); !errors.Is(err, ErrNotAppendOnly) {
+		t.Fatalf("expected %v, found %v", ErrNotAppendOnly, err)
+	}
+	mt := newKeyedTree(AppendOnlyMode, 4)
+	for _, sizes := range [][2]int{{0, 4}, {3, 2}, {1, 5}} {
+		if _, err := mt.GenerateConsistencyProof(sizes[0], sizes[1]); !errors.Is(err, ErrInvalidTreeSize) {
+			t.Fatalf("expected %v for sizes %v, found %v", ErrInvalidTreeSize, sizes, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package merkle_tree
+
+import (
+	"hash/fnv"
+)
+
+// pageSize is the number of node hashes held by a page of a level
+const pageSize = 128
+
+// indexShardCount is the number of shards of an index, indexes stored with another number of shards are resharded on load
+const indexShardCount = 1024
+
+// Level holds the node hashes of a level of the tree in pages. Copies of a tree share the pages and a copy only
+// copies a page before changing one of its hashes, so that a mutation copies the pages on the paths it recomputes
+type Level struct {
+	Pages  [][][]byte // Pages holds the node hashes, every page but the last holds pageSize hashes
+	Length int        // Length is the number of node hashes of the level
+
+	ownsPages  bool   // ownsPages is whether the page slice is not shared with another copy
+	ownedPages []bool // ownedPages holds whether each page is not shared with another copy
+}
+
+// newLevel returns a level holding the node hashes
+func newLevel(nodes [][]byte) Level {
+	level := Level{}
+	for index, node := range nodes {
+		level.set(index, node)
+	}
+	return level
+}
+
+// share returns a copy of the level sharing all its pages, the level no longer owns the pages either
+func (level *Level) share() Level {
+	level.ownsPages, level.ownedPages = false, nil
+	return Level{Pages: level.Pages, Length: level.Length}
+}
+
+// node returns the node hash at the index
+func (level *Level) node(index int) []byte {
+	return level.Pages[index/pageSize][index%pageSize]
+}
+
+// set replaces the node hash at the index, or appends it if the index is the length of the level
+func (level *Level) set(index int, node []byte) {
+	page, offset := index/pageSize, index%pageSize
+	level.ownPages()
+	if page == len(level.Pages) {
+		level.Pages = append(level.Pages, make([][]byte, 0, pageSize))
+		level.ownedPages = append(level.ownedPages, true)
+	}
+	if !level.ownedPages[page] {
+		level.Pages[page] = append(make([][]byte, 0, pageSize), level.Pages[page]...)
+		level.ownedPages[page] = true
+	}
+	if offset == len(level.Pages[page]) {
+		level.Pages[page] = append(level.Pages[page], node)
+		level.Length++
+		return
+	}
+	level.Pages[page][offset] = node
+}
+
+// resize drops the node hashes from the length on, or appends empty node hashes up to the length
+func (level *Level) resize(length int) {
+	for level.Length < length {
+		level.set(level.Length, nil)
+	}
+	if level.Length == length {
+		return
+	}
+	level.ownPages()
+	pageCount := (length + pageSize - 1) / pageSize
+	level.Pages, level.ownedPages = level.Pages[:pageCount], level.ownedPages[:pageCount]
+	if pageCount > 0 {
+		// a shorter slice of a shared page leaves the page of the other copies unchanged
+		level.Pages[pageCount-1] = level.Pages[pageCount-1][:length-(pageCount-1)*pageSize]
+	}
+	level.Length = length
+}
+
+// nodes returns the node hashes of the level
+func (level *Level) nodes() [][]byte {
+	nodes := make([][]byte, 0, level.Length)
+	for _, page := range level.Pages {
+		nodes = append(nodes, page...)
+	}
+	return nodes
+}
+
+// ownPages copies the page slice if it is shared with another copy
+func (level *Level) ownPages() {
+	if level.ownsPages {
+		return
+	}
+	level.Pages = append(make([][][]byte, 0, len(level.Pages)+1), level.Pages...)
+	level.ownedPages = make([]bool, len(level.Pages))
+	level.ownsPages = true
+}
+
+// Index maps keys to values in shards chosen by the FNV-1a hash of the key. Copies of a tree share the shards and a
+// copy only copies a shard before changing one of its entries, so that a mutation copies the shards of the keys it changes
+type Index[V any] struct {
+	Shards []map[string]V // Shards holds the entries, indexShardCount shards once the first entry is set
+	Count  int            // Count is the number of entries
+
+	ownsShards  bool   // ownsShards is whether the shard slice is not shared with another copy
+	ownedShards []bool // ownedShards holds whether each shard is not shared with another copy
+}
+
+// share returns a copy of the index sharing all its shards, the index no longer owns the shards either
+func (index *Index[V]) share() Index[V] {
+	index.ownsShards, index.ownedShards = false, nil
+	return Index[V]{Shards: index.Shards, Count: index.Count}
+}
+
+// get returns the value of the key
+func (index *Index[V]) get(key string) (V, bool) {
+	var value V
+	if len(index.Shards) == 0 {
+		return value, false
+	}
+	value, found := index.Shards[shardOf(key)][key]
+	return value, found
+}
+
+// set sets the value of the key
+func (index *Index[V]) set(key string, value V) {
+	shard := index.ownShard(key)
+	if _, found := shard[key]; !found {
+		index.Count++
+	}
+	shard[key] = value
+}
+
+// delete removes the key
+func (index *Index[V]) delete(key string) {
+	if _, found := index.get(key); !found {
+		return
+	}
+	delete(index.ownShard(key), key)
+	index.Count--
+}
+
+// forEach calls fn with every key and its value, in no particular order
+func (index *Index[V]) forEach(fn func(key string, value V)) {
+	for _, shard := range index.Shards {
+		for key, value := range shard {
+			fn(key, value)
+		}
+	}
+}
+
+// reshard splits the index into indexShardCount shards if it was stored with another number of shards
+func (index *Index[V]) reshard() {
+	if len(index.Shards) == 0 || len(index.Shards) == indexShardCount {
+		return
+	}
+	shards := index.Shards
+	*index = Index[V]{}
+	for _, shard := range shards {
+		for key, value := range shard {
+			index.set(key, value)
+		}
+	}
+}
+
+// ownShard returns the shard of the key, which is copied first if it is shared with another copy
+func (index *Index[V]) ownShard(key string) map[string]V {
+	if !index.ownsShards {
+		shards := make([]map[string]V, indexShardCount)
+		copy(shards, index.Shards)
+		index.Shards, index.ownedShards, index.ownsShards = shards, make([]bool, indexShardCount), true
+	}
+	shard := shardOf(key)
+	if !index.ownedShards[shard] {
+		entries := make(map[string]V, len(index.Shards[shard])+1)
+		for key, value := range index.Shards[shard] {
+			entries[key] = value
+		}
+		index.Shards[shard], index.ownedShards[shard] = entries, true
+	}
+	return index.Shards[shard]
+}
+
+// shardOf returns the shard of the key
+func shardOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % indexShardCount)
+}
@@ -0,0 +1,63 @@
+package merkle_tree
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+	"hash"
+)
+
+// HashAlgorithm represents the hash function used for the leafs and nodes of a Merkle tree
+type HashAlgorithm string
+
+// Supported hash algorithms
+const (
+	SHA256     HashAlgorithm = "SHA-256"
+	SHA384     HashAlgorithm = "SHA-384"
+	SHA512     HashAlgorithm = "SHA-512"
+	SHA3_256   HashAlgorithm = "SHA3-256"
+	BLAKE2b256 HashAlgorithm = "BLAKE2b-256"
+)
+
+// HashAlgorithms are the supported hash algorithms
+var HashAlgorithms = []HashAlgorithm{SHA256, SHA384, SHA512, SHA3_256, BLAKE2b256}
+
+// DefaultHashAlgorithm is used for new trees when no algorithm is configured and for trees stored without one
+const DefaultHashAlgorithm = SHA256
+
+// ParseHashAlgorithm returns the hash algorithm with the given name, an empty name returns the default
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	if name == "" {
+		return DefaultHashAlgorithm, nil
+	}
+	switch algorithm := HashAlgorithm(name); algorithm {
+	case SHA256, SHA384, SHA512, SHA3_256, BLAKE2b256:
+		return algorithm, nil
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm %q", name)
+	}
+}
+
+// Size returns the digest size of the hash algorithm in bytes
+func (algorithm HashAlgorithm) Size() int {
+	return NewHashFunc(algorithm).Size()
+}
+
+// NewHashFunc Returns the hash function of the given algorithm, the default is used for unknown algorithms
+func NewHashFunc(algorithm HashAlgorithm) hash.Hash {
+	switch algorithm {
+	case SHA384:
+		return sha512.New384()
+	case SHA512:
+		return sha512.New()
+	case SHA3_256:
+		return sha3.New256()
+	case BLAKE2b256:
+		h, _ := blake2b.New256(nil) // only fails for keys longer than 64 bytes
+		return h
+	default:
+		return sha256.New()
+	}
+}
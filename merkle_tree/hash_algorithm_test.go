@@ -0,0 +1,67 @@
+package merkle_tree
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// hashVectors are known answers of the hash algorithms without a hash function of the standard library, the leafs
+// and the node are those of the append-only tree holding fn-a and fn-b
+var hashVectors = []struct {
+	algorithm HashAlgorithm
+	abc       string // abc is the digest of "abc" from the specification of the hash function
+	leafA     string // leafA is H(0x00 | H("fn-a"))
+	leafB     string // leafB is H(0x00 | H("fn-b"))
+	root      string // root is H(0x01 | leafA | leafB)
+}{
+	{
+		algorithm: SHA3_256,
+		abc:       "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+		leafA:     "40163d73ec55072c11a9ba60484e7dab8e855809cbdf99defbff978d32f68928",
+		leafB:     "d307bba561c2d19a0d23f7ee2e34c6c81b72a60c43c58ef3dee964f5a69dc8af",
+		root:      "8a4f381f85f514474aa81d8adf43fe8dffe649bb32a860ee1af0e0c9cd3cad8e",
+	},
+	{
+		algorithm: BLAKE2b256,
+		abc:       "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+		leafA:     "9e49745508dc7ce0323ff5a7a0ad875ed3200239331f3ef02304f4aa96070132",
+		leafB:     "67b329e1c84e200b09d360df7598748aa6741c0fe0806881f8d2d626af5eed31",
+		root:      "76885c48099e9b0ade13628f0f35543dc2aeafbdb01bf219f947753f9cb6f4b0",
+	},
+	{
+		algorithm: SHA384,
+		abc:       "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7",
+		leafA:     "ec54e88ac8be5d1acb047a9f12988a413e75c9e9c9ed0b229e7c3d320c9a29af3d921c5c44c9bb4aa76474d43a5f8b11",
+		leafB:     "dee4216509cfe6a95fbc9420a44535bb31e9ab45887c9928eb8d40f501202278ddfb1648b9ad82c876976164450ab6c2",
+		root:      "f2594b9e6ffc61e2e6e2e5f3a334a6c0e0a32f634ca9cfe7940142263c3b5254178378306d1e99ee3f1521189243cb3e",
+	},
+}
+
+// assertDigest checks that the digest is the hex encoded expected digest
+func assertDigest(t *testing.T, name string, digest []byte, expected string) {
+	if hex.EncodeToString(digest) != expected {
+		t.Fatalf("expected %s %s, found %x", name, expected, digest)
+	}
+}
+
+func TestHashAlgorithmKnownAnswers(t *testing.T) {
+	for _, vector := range hashVectors {
+		t.Run(string(vector.algorithm), func(t *testing.T) {
+			h := NewHashFunc(vector.algorithm)
+			h.Write([]byte("abc"))
+			assertDigest(t, "digest", h.Sum(nil), vector.abc)
+			if vector.algorithm.Size() != len(vector.abc)/2 {
+				t.Fatalf("expected a digest size of %d, found %d", len(vector.abc)/2, vector.algorithm.Size())
+			}
+
+			assertDigest(t, "leaf", HashLeaf(vector.algorithm, []byte("fn-a")), vector.leafA)
+			assertDigest(t, "leaf", HashLeaf(vector.algorithm, []byte("fn-b")), vector.leafB)
+			leafA, _ := hex.DecodeString(vector.leafA)
+			leafB, _ := hex.DecodeString(vector.leafB)
+			assertDigest(t, "node", hashNode(NewHashFunc(vector.algorithm), leafA, leafB), vector.root)
+
+			mt := NewTreeWithMode(vector.algorithm, AppendOnlyMode).AppendNewContent([]byte("fn-a")).AppendNewContent([]byte("fn-b"))
+			assertDigest(t, "root", mt.GetMerkleRoot(), vector.root)
+		})
+	}
+}
@@ -2,21 +2,58 @@ package merkle_tree
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash"
-	"sort"
+)
+
+// Tree format versions, the version is stored with the tree so that older trees can be migrated on load
+const (
+	FormatUnprefixed      = 1 // FormatUnprefixed hashes leafs and nodes without domain separation
+	FormatDomainSeparated = 2 // FormatDomainSeparated prefixes leaf hashes with 0x00 and node hashes with 0x01
+	CurrentFormatVersion  = FormatDomainSeparated
+)
+
+// RFC 6962 style prefixes, so that an intermediate node hash can never be presented as a leaf hash
+const (
+	leafHashPrefix byte = 0x00
+	nodeHashPrefix byte = 0x01
 )
 
 // MerkleTree represents a Merkle tree
 type MerkleTree struct {
-	Nodes          []*Node // Nodes in the Merkle tree
-	RootIndex      int     // RootIndex is the index of the root node in the nodes slice
-	LeafCount      int     // LeafCount holds the number of leafs
-	MerkleRootHash []byte  // MerkleRootHash is the hash of the Merkle tree root
+	Version        int           // Version is the format of the tree, trees stored without a version are FormatUnprefixed
+	HashAlgorithm  HashAlgorithm // HashAlgorithm is the hash function used for the leafs and nodes
+	Mode           TreeMode      // Mode is how the leafs change, trees stored without a mode are MutableMode
+	Tenancy        Tenancy       // Tenancy is how the leafs are split between tenants, trees stored without one are SingleTenancy
+	PagedLevels    []Level       // PagedLevels holds the node hashes per level, PagedLevels[0] are the leafs and the last level is the root
+	LeafCount      int           // LeafCount holds the number of leafs
+	MerkleRootHash []byte        // MerkleRootHash is the hash of the Merkle tree root
+
+	// KeyIndex maps the identity key of a content to the hash of its active leaf
+	KeyIndex Index[[]byte]
+	// LeafIndex maps the hex encoded hash of a leaf to its position in PagedLevels[0] and the keys it was appended for
+	LeafIndex Index[LeafEntry]
+
+	// Tenants maps a tenant to its tree in a multi-tenant tree, whose leafs are keyed by tenant and commit to the tenant roots
+	Tenants map[string]*MerkleTree
+
+	// Levels, LeafKeys and LeafPositions are only populated in trees stored before the paged layout, and Nodes and
+	// RootIndex in trees stored before the level based layout, Upgrade converts them
+	Levels        [][][]byte
+	LeafKeys      map[string][]byte
+	LeafPositions map[string]int
+	Nodes         []*Node
+	RootIndex     int
 }
 
-// Node represents a node in the Merkle tree
+// LeafEntry is the position of a leaf and the identity keys it was appended for, a key may since point to another leaf
+type LeafEntry struct {
+	Position int
+	Keys     []string
+}
+
+// Node represents a node in a Merkle tree stored in the legacy node slice layout
 type Node struct {
 	Parent int    // Index of the parent node in the nodes slice, -1 if nil
 	Left   int    // Index of the left child node in the nodes slice, -1 if nil
@@ -26,202 +63,451 @@ type Node struct {
 	Hash   []byte // Hash value of the node
 }
 
-// NewTree creates a new Merkle Tree
+// NewTree creates a new Merkle Tree using the default hash algorithm
 func NewTree() *MerkleTree {
-	t := &MerkleTree{Nodes: make([]*Node, 0)}
+	return NewTreeWithHashAlgorithm(DefaultHashAlgorithm)
+}
+
+// NewTreeWithHashAlgorithm creates a new mutable Merkle Tree using the given hash algorithm
+func NewTreeWithHashAlgorithm(algorithm HashAlgorithm) *MerkleTree {
+	return NewTreeWithMode(algorithm, MutableMode)
+}
+
+// NewTreeWithMode creates a new Merkle Tree using the given hash algorithm and mode
+func NewTreeWithMode(algorithm HashAlgorithm, mode TreeMode) *MerkleTree {
+	t := &MerkleTree{
+		Version:       CurrentFormatVersion,
+		HashAlgorithm: algorithm,
+		Mode:          mode,
+	}
+	return t
+}
+
+// NeedsUpgrade returns whether the tree is stored in an older layout or format, which Upgrade converts
+func (t *MerkleTree) NeedsUpgrade() bool {
+	if t.Version != CurrentFormatVersion || len(t.Nodes) > 0 || t.Levels != nil || t.LeafKeys != nil || t.LeafPositions != nil {
+		return true
+	}
+	if shardCount := len(t.KeyIndex.Shards); shardCount != 0 && shardCount != indexShardCount {
+		return true
+	}
+	if shardCount := len(t.LeafIndex.Shards); shardCount != 0 && shardCount != indexShardCount {
+		return true
+	}
+	for _, tenantTree := range t.Tenants {
+		if tenantTree.NeedsUpgrade() {
+			return true
+		}
+	}
+	return false
+}
+
+// PredatesKeys returns whether the tree was stored before its leafs were keyed by the identity of their content and
+// holds leafs, Upgrade cannot key them so none of their contents is found by its key
+func (t *MerkleTree) PredatesKeys() bool {
+	// append-only trees were introduced with the keys and keep their leafs when every key is removed
+	return (len(t.Nodes) > 0 || t.Levels != nil) && t.LeafKeys == nil && t.LeafCount > 0 && !t.IsAppendOnly()
+}
+
+// Upgrade converts a tree stored in an older layout or format into the current one, the root changes
+// when the tree is converted to another format and has to be anchored again
+func (t *MerkleTree) Upgrade() *MerkleTree {
+	// Trees stored before the hash algorithm was configurable always used the default
+	if t.HashAlgorithm == "" {
+		t.HashAlgorithm = DefaultHashAlgorithm
+	}
+	if t.Version == 0 {
+		t.Version = FormatUnprefixed
+	}
+	if t.Mode == "" {
+		t.Mode = MutableMode
+	}
+	if t.Tenancy == "" {
+		t.Tenancy = SingleTenancy
+	}
+	if t.IsMultiTenant() && t.Tenants == nil {
+		t.Tenants = make(map[string]*MerkleTree)
+	}
+	// Tenant trees were introduced with the current format, so upgrading them never changes their roots
+	for tenant, tenantTree := range t.Tenants {
+		t.Tenants[tenant] = tenantTree.Upgrade()
+	}
+	t.KeyIndex.reshard()
+	t.LeafIndex.reshard()
+	if len(t.Nodes) == 0 && t.Levels == nil && t.LeafKeys == nil && t.LeafPositions == nil {
+		return t
+	}
+
+	// Trees stored in the legacy node slice layout keep the sorted order of their leafs
+	var leafs [][]byte
+	if len(t.Nodes) > 0 {
+		for _, leaf := range t.Nodes[:t.LeafCount] {
+			if !leaf.Dup {
+				leafs = append(leafs, leaf.Hash)
+			}
+		}
+	} else if len(t.Levels) > 0 {
+		leafs = t.Levels[0]
+	}
+
+	if len(t.Nodes) == 0 && t.Version == CurrentFormatVersion {
+		// Trees stored before the paged layout keep their hashes, only the layout changes
+		t.PagedLevels = make([]Level, 0, len(t.Levels))
+		for _, nodes := range t.Levels {
+			t.PagedLevels = append(t.PagedLevels, newLevel(nodes))
+		}
+		t.LeafIndex = Index[LeafEntry]{}
+		for position, leafHash := range leafs {
+			entry, _ := t.LeafIndex.get(hex.EncodeToString(leafHash))
+			entry.Position = position
+			t.LeafIndex.set(hex.EncodeToString(leafHash), entry)
+		}
+		t.indexKeys(t.LeafKeys)
+		t.Levels, t.LeafKeys, t.LeafPositions = nil, nil, nil
+		return t
+	}
+
+	// Unprefixed leaf hashes are H(content), so the domain separated leaf hash H(0x00 | H(content))
+	// can be derived from them without the content
+	if t.Version == FormatUnprefixed {
+		for i, leafHash := range leafs {
+			leafs[i] = t.prefixedHash(leafHashPrefix, leafHash)
+		}
+		for key, leafHash := range t.LeafKeys {
+			t.LeafKeys[key] = t.prefixedHash(leafHashPrefix, leafHash)
+		}
+		t.Version = FormatDomainSeparated
+	}
+
+	t.Nodes, t.RootIndex, t.Levels = nil, 0, nil
+	t.PagedLevels, t.LeafCount, t.MerkleRootHash = nil, 0, nil
+	t.LeafIndex = Index[LeafEntry]{}
+	for _, leafHash := range leafs {
+		t.appendLeafHash(leafHash)
+	}
+	t.indexKeys(t.LeafKeys)
+	t.LeafKeys, t.LeafPositions = nil, nil
 	return t
 }
 
+// indexKeys sets the active leafs of the identity keys of a tree stored before the paged layout
+func (t *MerkleTree) indexKeys(leafKeys map[string][]byte) {
+	t.KeyIndex = Index[[]byte]{}
+	for key, leafHash := range leafKeys {
+		t.setKey(key, leafHash)
+	}
+}
+
+// Clone returns a copy of the tree, the copy and the tree share their pages, shards and tenant trees and copy
+// only what a mutation changes, so that either can be mutated without affecting the other
+func (t *MerkleTree) Clone() *MerkleTree {
+	clone := *t
+	clone.PagedLevels = make([]Level, len(t.PagedLevels))
+	for level := range t.PagedLevels {
+		clone.PagedLevels[level] = t.PagedLevels[level].share()
+	}
+	clone.KeyIndex = t.KeyIndex.share()
+	clone.LeafIndex = t.LeafIndex.share()
+	if t.Tenants != nil {
+		// The tenant trees are shared as they are cloned before they are mutated
+		clone.Tenants = make(map[string]*MerkleTree, len(t.Tenants))
+		for tenant, tenantTree := range t.Tenants {
+			clone.Tenants[tenant] = tenantTree
+		}
+	}
+	clone.Nodes = append([]*Node(nil), t.Nodes...)
+	return &clone
+}
+
 // GetMerkleRoot returns the root hash of the Merkle tree
 func (t *MerkleTree) GetMerkleRoot() []byte {
 	return t.MerkleRootHash
 }
 
-// hashByteSlice returns the hash of a byte slice using the hash function
-func (t *MerkleTree) hashByteSlice(data []byte) []byte {
-	h := NewHashFunc()
-	h.Write(data)
-	return h.Sum(nil)[:]
+// newHashFunc returns the hash function of the tree
+func (t *MerkleTree) newHashFunc() hash.Hash {
+	return NewHashFunc(t.HashAlgorithm)
 }
 
-// AppendNewContent builds a new tree with the new content and return the tree
-func (t *MerkleTree) AppendNewContent(content []byte) *MerkleTree {
-
-	// Create new leaf
-	leaf := &Node{
-		Parent: -1, // Parent not set
-		Left:   -1, // Left not set
-		Right:  -1, // Right not set
-		Leaf:   true,
-		Dup:    false,
-		Hash:   t.hashByteSlice(content), // Hash value by hashing the content
+// prefixedHash returns the hash of the prefix followed by the given byte slices using the hash function
+func (t *MerkleTree) prefixedHash(prefix byte, data ...[]byte) []byte {
+	h := t.newHashFunc()
+	h.Write([]byte{prefix})
+	for _, d := range data {
+		h.Write(d)
 	}
+	return h.Sum(nil)
+}
 
-	// Update the leaf count and nodes of tree
-	t.LeafCount, t.Nodes = updateLeafsAndNodes(t.LeafCount, t.Nodes, leaf)
+// hashLeaf returns the leaf hash of the content, H(0x00 | H(content))
+func (t *MerkleTree) hashLeaf(content []byte) []byte {
+	return HashLeaf(t.HashAlgorithm, content)
+}
 
-	// Leaf indices from [0,1..,t.leafCount]
-	leafIndices := make([]int, t.LeafCount)
-	for i := range leafIndices {
-		leafIndices[i] = i
-	}
-	// Recursively build intermediate nodes until the root node is reached
-	t.RootIndex, _ = buildIntermediate(leafIndices, t)
-	t.MerkleRootHash = t.Nodes[t.RootIndex].Hash
+// HashLeaf returns the leaf hash of the content for a tree of the given hash algorithm, H(0x00 | H(content))
+func HashLeaf(algorithm HashAlgorithm, content []byte) []byte {
+	h := NewHashFunc(algorithm)
+	h.Write(content)
+	contentHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write([]byte{leafHashPrefix})
+	h.Write(contentHash)
+	return h.Sum(nil)
+}
+
+// hashNode returns the hash of an intermediate node, H(0x01 | left | right)
+func hashNode(h hash.Hash, left []byte, right []byte) []byte {
+	h.Reset()
+	h.Write([]byte{nodeHashPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// AppendNewContent appends a leaf for the new content, recomputing only the path up to the root, and return the tree
+func (t *MerkleTree) AppendNewContent(content []byte) *MerkleTree {
+	t.appendLeafHash(t.hashLeaf(content))
 
 	// Return the tree
 	return t
 }
 
-func updateLeafsAndNodes(leafCount int, nodes []*Node, leaf *Node) (int, []*Node) {
+// RemoveContent removes the leaf of the given content and return the tree, ErrAppendOnly is returned for append-only trees
+func (t *MerkleTree) RemoveContent(content []byte) (*MerkleTree, error) {
+	if t.IsAppendOnly() {
+		return t, ErrAppendOnly
+	}
+	removedHash := t.hashLeaf(content)
+	entry, found := t.LeafIndex.get(hex.EncodeToString(removedHash))
+	if err := t.removeLeafHash(removedHash); err != nil {
+		return t, err
+	}
 
-	// This list stores list of leaf objects
-	var newLeafNodes []*Node
+	// Drop any identity key still pointing to the removed leaf
+	if found {
+		for _, key := range entry.Keys {
+			if leafHash, _ := t.KeyIndex.get(key); bytes.Equal(leafHash, removedHash) {
+				t.KeyIndex.delete(key)
+			}
+		}
+	}
+	return t, nil
+}
 
-	// If there are leafs, check if the last one is a duplicate and remove it
-	if leafCount > 0 && nodes[leafCount-1].Dup {
-		leafCount = leafCount - 1
+// ReplaceContent replaces the leaf of the old content by the new content and return the tree
+func (t *MerkleTree) ReplaceContent(oldContent []byte, newContent []byte) (*MerkleTree, error) {
+	if _, err := t.RemoveContent(oldContent); err != nil {
+		return t, err
 	}
+	return t.AppendNewContent(newContent), nil
+}
+
+// AppendKeyedContent appends the content as the only active leaf of the given identity key,
+// the previous leaf of the key is removed if it exists, and return the tree
+func (t *MerkleTree) AppendKeyedContent(key string, content []byte) *MerkleTree {
+	return t.AppendKeyedLeafHash(key, t.hashLeaf(content))
+}
 
-	// Add all the leafs to newLeafNodes from the previous nodes list
-	for i := 0; i < leafCount; i++ {
-		newLeafNodes = append(newLeafNodes, nodes[i])
+// AppendKeyedLeafHash appends the leaf hash as the only active leaf of the given identity key, as AppendKeyedContent
+// does for the content, so that a tree can be rebuilt from leaf hashes alone, and return the tree.
+// The previous leaf of the key stays in an append-only tree, where only the key points to the new leaf.
+func (t *MerkleTree) AppendKeyedLeafHash(key string, leafHash []byte) *MerkleTree {
+	previousHash, found := t.KeyIndex.get(key)
+	if found && bytes.Equal(previousHash, leafHash) {
+		return t
+	}
+	if found && !t.IsAppendOnly() {
+		// The previous leaf might already be gone, in which case there is nothing to remove
+		_ = t.removeLeafHash(previousHash)
 	}
 
-	// Add the new leaf as a leaf
-	newLeafNodes = append(newLeafNodes, leaf)
-	leafCount += 1
+	t.appendLeafHash(leafHash)
+	t.setKey(key, leafHash)
+	return t
+}
 
-	// If an odd number of leafIndices is present, duplicate the last leaf
-	if leafCount%2 != 0 {
-		lastLeaf := newLeafNodes[leafCount-1]
-		newLeaf := &Node{
-			Parent: -1,
-			Left:   -1,
-			Right:  -1,
-			Leaf:   true,
-			Dup:    true,          // Duplicate
-			Hash:   lastLeaf.Hash, // Same hash as it is a duplicate
+// setKey points the identity key to the leaf hash and records the key in the entry of the leaf
+func (t *MerkleTree) setKey(key string, leafHash []byte) {
+	t.KeyIndex.set(key, leafHash)
+	leafKey := hex.EncodeToString(leafHash)
+	entry, found := t.LeafIndex.get(leafKey)
+	if !found {
+		return
+	}
+	for _, entryKey := range entry.Keys {
+		if entryKey == key {
+			return
 		}
-		newLeafNodes = append(newLeafNodes, newLeaf)
-		leafCount += 1
 	}
+	// the keys of the entry are shared with other copies of the tree, so they are copied before appending
+	entry.Keys = append(append(make([]string, 0, len(entry.Keys)+1), entry.Keys...), key)
+	t.LeafIndex.set(leafKey, entry)
+}
+
+// RemoveKeyedContent removes the active leaf of the given identity key and return the tree,
+// in an append-only tree the leaf stays and a tombstone leaf of the key is appended instead
+func (t *MerkleTree) RemoveKeyedContent(key string) (*MerkleTree, error) {
+	leafHash, found := t.KeyIndex.get(key)
+	if !found {
+		return t, ErrKeyNotFound
+	}
+	t.KeyIndex.delete(key)
+	if t.IsAppendOnly() {
+		t.appendLeafHash(t.hashLeaf(tombstoneContent(key, leafHash)))
+		return t, nil
+	}
+	return t, t.removeLeafHash(leafHash)
+}
 
-	// Sort the newLeafNodes by hash
-	sort.SliceStable(newLeafNodes, func(i, j int) bool {
-		return bytes.Compare(newLeafNodes[i].Hash, newLeafNodes[j].Hash) < 0
-	})
+// GetKeyedLeafHash returns the hash of the active leaf of the given identity key
+func (t *MerkleTree) GetKeyedLeafHash(key string) ([]byte, bool) {
+	return t.KeyIndex.get(key)
+}
 
-	return leafCount, newLeafNodes
+// ForEachKey calls fn with every identity key and the hash of its active leaf, in no particular order
+func (t *MerkleTree) ForEachKey(fn func(key string, leafHash []byte)) {
+	t.KeyIndex.forEach(fn)
 }
 
-// buildIntermediate recursively builds intermediate nodes until the root node is reached
-func buildIntermediate(nodesIndexSlice []int, t *MerkleTree) (int, error) {
+// appendLeafHash adds the leaf hash after the last leaf, a leaf hash already in a mutable tree is not added twice,
+// an append-only tree records every append and the position of a repeated leaf hash is its last position
+func (t *MerkleTree) appendLeafHash(leafHash []byte) {
+	leafKey := hex.EncodeToString(leafHash)
+	entry, found := t.LeafIndex.get(leafKey)
+	if found && !t.IsAppendOnly() {
+		return
+	}
+	if len(t.PagedLevels) == 0 {
+		t.PagedLevels = append(t.PagedLevels, Level{})
+	}
+
+	leafs := &t.PagedLevels[0]
+	leafs.set(leafs.Length, leafHash)
+	t.LeafCount = leafs.Length
+	entry.Position = t.LeafCount - 1
+	t.LeafIndex.set(leafKey, entry)
+	t.updatePaths(t.LeafCount - 1)
+}
 
-	// Hash start
-	h := NewHashFunc()
+// removeLeafHash moves the last leaf into the position of the removed leaf and drops the last position
+func (t *MerkleTree) removeLeafHash(removedHash []byte) error {
+	removedKey := hex.EncodeToString(removedHash)
+	removedEntry, found := t.LeafIndex.get(removedKey)
+	if !found {
+		return ErrContentNotFound
+	}
 
-	// If node slice have odd length make it even to loop through
-	if len(nodesIndexSlice)%2 == 1 {
-		nodesIndexSlice = append(nodesIndexSlice, nodesIndexSlice[len(nodesIndexSlice)-1])
+	position, lastPosition := removedEntry.Position, t.LeafCount-1
+	leafs := &t.PagedLevels[0]
+	lastHash := leafs.node(lastPosition)
+	leafs.set(position, lastHash)
+	lastKey := hex.EncodeToString(lastHash)
+	lastEntry, _ := t.LeafIndex.get(lastKey)
+	lastEntry.Position = position
+	t.LeafIndex.set(lastKey, lastEntry)
+	t.LeafIndex.delete(removedKey)
+
+	leafs.resize(lastPosition)
+	t.LeafCount = lastPosition
+	if position < lastPosition {
+		t.updatePaths(position)
+	} else {
+		t.updatePaths()
 	}
+	return nil
+}
+
+// findLeaf returns the position of the leaf with the given hash
+func (t *MerkleTree) findLeaf(leafHash []byte) (int, bool) {
+	entry, found := t.LeafIndex.get(hex.EncodeToString(leafHash))
+	return entry.Position, found
+}
 
-	var parentIndices []int
+// node returns the hash of the node at the index of the level
+func (t *MerkleTree) node(level int, index int) []byte {
+	return t.PagedLevels[level].node(index)
+}
 
-	// Attempt to create parent for pairs of leafs
-	for i := 0; i < len(nodesIndexSlice); i += 2 {
-		left := nodesIndexSlice[i]    // Get the left child index
-		right := nodesIndexSlice[i+1] // Get the right child index
+// levelLength returns the number of nodes of the level
+func (t *MerkleTree) levelLength(level int) int {
+	return t.PagedLevels[level].Length
+}
 
-		h.Reset()
-		h.Write(t.Nodes[left].Hash)  // Get the hash of left child
-		h.Write(t.Nodes[right].Hash) // Get the hash of right child
-		parent := &Node{
-			Parent: -1,
-			Left:   left,
-			Right:  right,
-			Leaf:   false,
-			Dup:    false,
-			Hash:   h.Sum(nil), // Hash of hashes
+// updatePaths recomputes the parents of the changed leaf positions and of the last leaf up to the root,
+// levels that are no longer needed are discarded
+func (t *MerkleTree) updatePaths(changed ...int) {
+	if t.LeafCount == 0 {
+		t.PagedLevels = make([]Level, 0)
+		t.MerkleRootHash = nil
+		return
+	}
+
+	h := t.newHashFunc()
+	level := 0
+	// The root of a mutable tree is always an intermediate node, even when there is a single leaf,
+	// the root of an append-only tree with a single leaf is the leaf as in RFC 6962
+	for (level == 0 && !t.IsAppendOnly()) || t.levelLength(level) > 1 {
+		if len(t.PagedLevels) == level+1 {
+			t.PagedLevels = append(t.PagedLevels, Level{})
 		}
-		parentIndex := len(t.Nodes)
-		t.Nodes = append(t.Nodes, parent)                  // append the created node to tree
-		t.Nodes[left].Parent = parentIndex                 // update the parent of left child
-		t.Nodes[right].Parent = parentIndex                // update the parent of right child
-		parentIndices = append(parentIndices, parentIndex) // add the parent index
-	}
-	if len(parentIndices) == 1 { // Root is reached
-		return parentIndices[0], nil // return root index
-	} else {
-		return buildIntermediate(parentIndices, t) // build the next level
+		nodes, parents := &t.PagedLevels[level], &t.PagedLevels[level+1]
+
+		// Resize the parent level, new parents are computed below
+		parents.resize((nodes.Length + 1) / 2)
+
+		// The last node is recomputed as it might have lost or gained its sibling
+		changed = append(changed, nodes.Length-1)
+		var changedParents []int
+		for _, index := range changed {
+			if index >= nodes.Length {
+				continue
+			}
+			left := index - index%2
+			right := left + 1
+			if right >= nodes.Length && t.IsAppendOnly() {
+				// If a node of an append-only tree has no sibling it is promoted to the next level
+				parents.set(left/2, nodes.node(left))
+				changedParents = append(changedParents, left/2)
+				continue
+			}
+			if right >= nodes.Length {
+				// If a node has no sibling it is paired with itself
+				right = left
+			}
+
+			parents.set(left/2, hashNode(h, nodes.node(left), nodes.node(right))) // Hash of the left and right child
+			changedParents = append(changedParents, left/2)
+		}
+
+		changed = changedParents
+		level++
 	}
+
+	// Discard the levels above the root which are left over from a bigger tree
+	t.PagedLevels = t.PagedLevels[:level+1]
+	t.MerkleRootHash = t.node(level, 0)
 }
 
 // VerifyContentHash verifies the hash of a given content against the Merkle tree
 func (t *MerkleTree) VerifyContentHash(content []byte, rootHash []byte) bool {
 
-	// Find the leaf node that contains the matching hash
-	leafNodeIndex, found := binarySearch(t.Nodes[:t.LeafCount], t.hashByteSlice(content))
-	if !found {
+	// Generate the audit path of the leaf containing the matching hash
+	proof, err := t.GenerateInclusionProof(content)
+	if err != nil {
 		return false
 	}
 
-	// Traverse the tree from the leaf node up to the root node
-	nodeIndex := leafNodeIndex
-	for t.Nodes[nodeIndex].Parent != -1 { // Till root is reached
-		parentIndex := t.Nodes[nodeIndex].Parent
-		leftIndex := t.Nodes[parentIndex].Left
-		rightIndex := t.Nodes[parentIndex].Right
-
-		// Hash the hashes of the left and right child nodes
-		h := NewHashFunc()
-		h.Write(t.Nodes[leftIndex].Hash)
-		h.Write(t.Nodes[rightIndex].Hash)
-		hashValue := h.Sum(nil)[:]
-
-		// If the computed hash matches the parent node's hash, continue up the tree
-		if bytes.Equal(hashValue, t.Nodes[parentIndex].Hash) {
-			nodeIndex = parentIndex
-		} else {
-			// If the computed hash does not match the parent node's hash, the content has been tampered with
-			return false
-		}
-	}
-
-	// If we've reached the root node and its hash matches the expected root hash, the content has not been tampered with
+	// If the leaf and its audit path hash up to the expected root hash, the content has not been tampered with
 	// We ultimately check the root hash with the passed hash to this method
-	return bytes.Equal(t.Nodes[nodeIndex].Hash, rootHash)
+	return VerifyInclusionProof(proof.LeafHash, proof, rootHash)
 }
 
 // PrintTreeNodes returns a string representation of the Merkle tree
 func (t *MerkleTree) PrintTreeNodes() {
 	s := ""
-	for _, n := range t.Nodes {
-		s += fmt.Sprintf("%v\n", n)
+	for level := range t.PagedLevels {
+		s += fmt.Sprintf("level %d: %x\n", level, t.PagedLevels[level].nodes())
 	}
 	fmt.Println(s)
 }
-
-// NewHashFunc Returns the hash function, this is the only place to be changed to change the hash func
-func NewHashFunc() hash.Hash {
-	return sha256.New()
-}
-
-// Binary search for sorted hash list of leafs
-func binarySearch(nodes []*Node, hashVal []byte) (int, bool) {
-	low := 0
-	high := len(nodes) - 1
-
-	for low <= high {
-		mid := (low + high) / 2
-		if bytes.Equal(nodes[mid].Hash, hashVal) {
-			return mid, true // Found the hash at index mid
-		} else if bytes.Compare(nodes[mid].Hash, hashVal) < 0 {
-			low = mid + 1
-		} else {
-			high = mid - 1
-		}
-	}
-
-	return -1, false // Hash not found
-}
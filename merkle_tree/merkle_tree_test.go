@@ -0,0 +1,141 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// newKeyedTree returns a tree of the mode holding count keyed leafs, key-<i> registered with content-<i>
+func newKeyedTree(mode TreeMode, count int) *MerkleTree {
+	mt := NewTreeWithMode(DefaultHashAlgorithm, mode)
+	for i := 0; i < count; i++ {
+		mt.AppendKeyedContent(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("content-%d", i)))
+	}
+	return mt
+}
+
+// mutateKeys updates, removes and appends keys spread over several pages of the leaf level
+func mutateKeys(t *testing.T, mt *MerkleTree) {
+	for i := 0; i < 3*pageSize; i += 7 {
+		mt.AppendKeyedContent(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("updated-%d", i)))
+	}
+	for i := 1; i < 3*pageSize; i += 11 {
+		if _, err := mt.RemoveKeyedContent(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Fatalf("remove of key-%d failed: %v", i, err)
+		}
+	}
+	for i := 0; i < pageSize; i++ {
+		mt.AppendKeyedContent(fmt.Sprintf("new-%d", i), []byte(fmt.Sprintf("new-%d", i)))
+	}
+}
+
+// assertKeysProven checks that every key of the tree has an inclusion proof of its leaf against the root
+func assertKeysProven(t *testing.T, mt *MerkleTree, root []byte) {
+	mt.ForEachKey(func(key string, leafHash []byte) {
+		position, found := mt.findLeaf(leafHash)
+		if !found {
+			t.Fatalf("leaf of %s not found", key)
+		}
+		proof, _ := mt.generateLeafInclusionProof(leafHash, position)
+		if !VerifyInclusionProof(leafHash, proof, root) {
+			t.Fatalf("leaf of %s is not proven against the root", key)
+		}
+	})
+}
+
+func TestCloneLeavesOriginalUnchanged(t *testing.T) {
+	for _, mode := range []TreeMode{MutableMode, AppendOnlyMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			original := newKeyedTree(mode, 4*pageSize+3)
+			root := original.GetMerkleRoot()
+
+			clone := original.Clone()
+			mutateKeys(t, clone)
+
+			// the same mutations applied without copying give the same tree
+			expected := newKeyedTree(mode, 4*pageSize+3)
+			mutateKeys(t, expected)
+			if !bytes.Equal(clone.GetMerkleRoot(), expected.GetMerkleRoot()) || clone.KeyCount() != expected.KeyCount() {
+				t.Fatalf("root of the mutated copy differs from the tree mutated in place")
+			}
+			assertKeysProven(t, clone, clone.GetMerkleRoot())
+
+			if !bytes.Equal(original.GetMerkleRoot(), root) || original.KeyCount() != 4*pageSize+3 {
+				t.Fatalf("original changed by mutating its copy")
+			}
+			assertKeysProven(t, original, root)
+
+			// the original can be mutated as well without changing its copy
+			cloneRoot := clone.GetMerkleRoot()
+			mutateKeys(t, original)
+			if !bytes.Equal(clone.GetMerkleRoot(), cloneRoot) {
+				t.Fatalf("copy changed by mutating the original")
+			}
+			assertKeysProven(t, clone, cloneRoot)
+		})
+	}
+}
+
+func TestRemoveContentDropsKeys(t *testing.T) {
+	mt := newKeyedTree(MutableMode, 10)
+	if _, err := mt.RemoveContent([]byte("content-3")); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, found := mt.GetKeyedLeafHash("key-3"); found {
+		t.Fatalf("key of the removed content is still registered")
+	}
+	if mt.KeyCount() != 9 || mt.LeafCount != 9 {
+		t.Fatalf("expected 9 keys and leafs, found %d and %d", mt.KeyCount(), mt.LeafCount)
+	}
+	assertKeysProven(t, mt, mt.GetMerkleRoot())
+}
+
+func TestUpgradeConvertsLevelLayout(t *testing.T) {
+	mt := newKeyedTree(MutableMode, 2*pageSize+5)
+
+	// a tree stored before the paged layout holds its levels and indexes as plain slices and maps
+	legacy := &MerkleTree{
+		Version:        mt.Version,
+		HashAlgorithm:  mt.HashAlgorithm,
+		Mode:           mt.Mode,
+		Tenancy:        SingleTenancy,
+		LeafCount:      mt.LeafCount,
+		MerkleRootHash: mt.GetMerkleRoot(),
+		LeafKeys:       make(map[string][]byte),
+		LeafPositions:  make(map[string]int),
+	}
+	for level := range mt.PagedLevels {
+		legacy.Levels = append(legacy.Levels, mt.PagedLevels[level].nodes())
+	}
+	mt.ForEachKey(func(key string, leafHash []byte) {
+		legacy.LeafKeys[key] = leafHash
+	})
+
+	if !legacy.NeedsUpgrade() {
+		t.Fatalf("tree in the level layout is not upgraded")
+	}
+	upgraded := legacy.Upgrade()
+	if upgraded.NeedsUpgrade() || upgraded.Levels != nil || upgraded.LeafKeys != nil {
+		t.Fatalf("legacy layout left after the upgrade")
+	}
+	if !bytes.Equal(upgraded.GetMerkleRoot(), mt.GetMerkleRoot()) || upgraded.KeyCount() != mt.KeyCount() {
+		t.Fatalf("upgrade changed the tree")
+	}
+	assertKeysProven(t, upgraded, mt.GetMerkleRoot())
+}
+
+// BenchmarkAppend measures the in-memory part of a create, appending a key to a copy of the active tree, storing
+// and anchoring the tree are measured by BenchmarkMutate of the tree manager
+func BenchmarkAppend(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("leafs=%d", size), func(b *testing.B) {
+			active := newKeyedTree(MutableMode, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				active.Clone().AppendKeyedContent(fmt.Sprintf("appended-%d", i), []byte(fmt.Sprintf("appended-%d", i)))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrContentNotFound is returned when the hash of the content is not a leaf of the tree
+var ErrContentNotFound = errors.New("content not found in merkle tree")
+
+// ErrKeyNotFound is returned when no active leaf is registered for an identity key
+var ErrKeyNotFound = errors.New("identity key not found in merkle tree")
+
+// ErrContentMismatch is returned when the content differs from the active leaf of its identity key
+var ErrContentMismatch = errors.New("content does not match the active leaf of the identity key")
+
+// InclusionProof represents the audit path from a leaf up to the Merkle root
+type InclusionProof struct {
+	HashAlgorithm HashAlgorithm // HashAlgorithm is the hash function of the tree the proof is generated from
+	LeafIndex     int           // LeafIndex is the position of the leaf among the leafs of the tree
+	LeafHash      []byte        // LeafHash is the hash of the leaf the proof is generated for
+	Path          []ProofStep   // Path holds the sibling hashes from the leaf level up to the root
+}
+
+// ProofStep represents a single sibling hash in an inclusion proof
+type ProofStep struct {
+	Hash []byte // Hash of the sibling node
+	Left bool   // Indicates whether the sibling is the left child of the parent
+}
+
+// GenerateInclusionProof returns the inclusion proof of the given content in the Merkle tree
+func (t *MerkleTree) GenerateInclusionProof(content []byte) (*InclusionProof, error) {
+
+	// Find the leaf that contains the matching hash
+	leafHash := t.hashLeaf(content)
+	position, found := t.findLeaf(leafHash)
+	if !found {
+		return nil, ErrContentNotFound
+	}
+	return t.generateLeafInclusionProof(leafHash, position)
+}
+
+// generateLeafInclusionProof returns the inclusion proof of the leaf hash at the given position
+func (t *MerkleTree) generateLeafInclusionProof(leafHash []byte, position int) (*InclusionProof, error) {
+	proof := &InclusionProof{
+		HashAlgorithm: t.HashAlgorithm,
+		LeafIndex:     position,
+		LeafHash:      leafHash,
+		Path:          make([]ProofStep, 0),
+	}
+
+	// Traverse the levels from the leaf up to the root collecting the siblings
+	index := position
+	for level := 0; level < len(t.PagedLevels)-1; level++ {
+		if index%2 == 0 {
+			sibling := index + 1
+			if sibling >= t.levelLength(level) && t.IsAppendOnly() {
+				// A node without sibling is promoted, so there is no hash to add at this level
+				index = index / 2
+				continue
+			}
+			if sibling >= t.levelLength(level) {
+				// A node without sibling is paired with itself
+				sibling = index
+			}
+			proof.Path = append(proof.Path, ProofStep{Hash: t.node(level, sibling), Left: false})
+		} else {
+			proof.Path = append(proof.Path, ProofStep{Hash: t.node(level, index-1), Left: true})
+		}
+		index = index / 2
+	}
+
+	return proof, nil
+}
+
+// GenerateKeyedInclusionProof returns the inclusion proof of the content registered under the given identity key
+func (t *MerkleTree) GenerateKeyedInclusionProof(key string, content []byte) (*InclusionProof, error) {
+	leafHash, found := t.KeyIndex.get(key)
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	if !bytes.Equal(leafHash, t.hashLeaf(content)) {
+		return nil, ErrContentMismatch
+	}
+	return t.GenerateInclusionProof(content)
+}
+
+// VerifyInclusionProof checks that the leaf hash together with the proof path hashes up to the given root and that
+// the sides of the siblings in the path are those of the leaf index
+func VerifyInclusionProof(leafHash []byte, proof *InclusionProof, root []byte) bool {
+	if proof == nil || len(leafHash) == 0 || len(root) == 0 || !pathMatchesIndex(proof) {
+		return false
+	}
+
+	h := NewHashFunc(proof.HashAlgorithm)
+	computedHash := leafHash
+	for _, step := range proof.Path {
+		if step.Left {
+			computedHash = hashNode(h, step.Hash, computedHash)
+		} else {
+			computedHash = hashNode(h, computedHash, step.Hash)
+		}
+	}
+
+	return bytes.Equal(computedHash, root)
+}
+
+// pathMatchesIndex checks that every sibling is on the side the leaf index puts it at its level, a level without a
+// sibling is one where an append-only tree promoted the last node, which is always a left node
+func pathMatchesIndex(proof *InclusionProof) bool {
+	index := proof.LeafIndex
+	if index < 0 {
+		return false
+	}
+	for _, step := range proof.Path {
+		// a left sibling is at the first level above at which the node is a right node
+		for step.Left && index != 0 && index%2 == 0 {
+			index = index / 2
+		}
+		if step.Left != (index%2 == 1) {
+			return false
+		}
+		index = index / 2
+	}
+	// the levels above the last sibling only promote the node up to the root
+	return index == 0
+}
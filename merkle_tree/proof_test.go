@@ -0,0 +1,121 @@
+package merkle_tree
+
+import (
+	"fmt"
+	"testing"
+)
+
+// copyProof returns a copy of the proof whose path can be changed without changing the proof
+func copyProof(proof *InclusionProof) *InclusionProof {
+	copied := *proof
+	copied.Path = make([]ProofStep, len(proof.Path))
+	for i, step := range proof.Path {
+		copied.Path[i] = ProofStep{Hash: append([]byte{}, step.Hash...), Left: step.Left}
+	}
+	return &copied
+}
+
+func TestInclusionProofRoundTrip(t *testing.T) {
+	for _, mode := range []TreeMode{MutableMode, AppendOnlyMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			for size := 1; size <= 33; size++ {
+				mt := newKeyedTree(mode, size)
+				root := mt.GetMerkleRoot()
+				for i := 0; i < size; i++ {
+					content := []byte(fmt.Sprintf("content-%d", i))
+					proof, err := mt.GenerateKeyedInclusionProof(fmt.Sprintf("key-%d", i), content)
+					if err != nil {
+						t.Fatalf("size %d: proof of key-%d failed: %v", size, i, err)
+					}
+					if !VerifyInclusionProof(HashLeaf(mt.HashAlgorithm, content), proof, root) {
+						t.Fatalf("size %d: proof of key-%d is not verified", size, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInclusionProofRefusesTampering(t *testing.T) {
+	for _, mode := range []TreeMode{MutableMode, AppendOnlyMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			mt := newKeyedTree(mode, 13)
+			root := mt.GetMerkleRoot()
+			content := []byte("content-5")
+			proof, err := mt.GenerateInclusionProof(content)
+			if err != nil {
+				t.Fatalf("proof failed: %v", err)
+			}
+			leafHash := HashLeaf(mt.HashAlgorithm, content)
+			otherProof, _ := mt.GenerateInclusionProof([]byte("content-6"))
+
+			tampered := map[string]func() bool{
+				"flipped sibling byte": func() bool {
+					p := copyProof(proof)
+					p.Path[0].Hash[0] ^= 0x01
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"flipped sibling side": func() bool {
+					p := copyProof(proof)
+					p.Path[len(p.Path)-1].Left = !p.Path[len(p.Path)-1].Left
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"wrong index": func() bool {
+					p := copyProof(proof)
+					p.LeafIndex ^= 1
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"negative index": func() bool {
+					p := copyProof(proof)
+					p.LeafIndex = -1
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"index beyond the path": func() bool {
+					p := copyProof(proof)
+					p.LeafIndex += 1 << len(p.Path)
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"dropped sibling": func() bool {
+					p := copyProof(proof)
+					p.Path = p.Path[:len(p.Path)-1]
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"proof of another leaf": func() bool {
+					return VerifyInclusionProof(leafHash, otherProof, root)
+				},
+				"wrong leaf": func() bool {
+					return VerifyInclusionProof(HashLeaf(mt.HashAlgorithm, []byte("content-6")), proof, root)
+				},
+				"wrong root": func() bool {
+					return VerifyInclusionProof(leafHash, proof, newKeyedTree(mode, 12).GetMerkleRoot())
+				},
+				"wrong hash algorithm": func() bool {
+					p := copyProof(proof)
+					p.HashAlgorithm = SHA512
+					return VerifyInclusionProof(leafHash, p, root)
+				},
+				"no proof": func() bool {
+					return VerifyInclusionProof(leafHash, nil, root)
+				},
+			}
+			for name, verify := range tampered {
+				if verify() {
+					t.Errorf("%s: expected the proof to be refused", name)
+				}
+			}
+		})
+	}
+}
+
+func TestInclusionProofOfUnknownContent(t *testing.T) {
+	mt := newKeyedTree(MutableMode, 4)
+	if _, err := mt.GenerateInclusionProof([]byte("unknown")); err != ErrContentNotFound {
+		t.Fatalf("expected %v, found %v", ErrContentNotFound, err)
+	}
+	if _, err := mt.GenerateKeyedInclusionProof("unknown", []byte("content-1")); err != ErrKeyNotFound {
+		t.Fatalf("expected %v, found %v", ErrKeyNotFound, err)
+	}
+	if _, err := mt.GenerateKeyedInclusionProof("key-1", []byte("content-2")); err != ErrContentMismatch {
+		t.Fatalf("expected %v, found %v", ErrContentMismatch, err)
+	}
+}
@@ -0,0 +1,229 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Tenancy represents how the leafs of a Merkle tree are split between tenants
+type Tenancy string
+
+// Supported tenancies
+const (
+	// SingleTenancy keeps the leafs of all tenants in one tree
+	SingleTenancy Tenancy = "single"
+	// NamespaceTenancy keeps a tree per Fission namespace, the leafs of the top-level tree commit to the
+	// roots of the namespace trees, so that a mutation in one namespace leaves the roots and proofs of
+	// the other namespaces unchanged
+	NamespaceTenancy Tenancy = "namespace"
+)
+
+// DefaultTenancy is used for new trees when no tenancy is configured and for trees stored without one
+const DefaultTenancy = SingleTenancy
+
+// ErrTenantMismatch is returned when a tenant tree does not match its leaf in the top-level tree
+var ErrTenantMismatch = errors.New("tenant tree does not match its leaf in the top-level merkle tree")
+
+// ErrNotMultiTenant is returned when a tenant proof is requested from a single tenant tree
+var ErrNotMultiTenant = errors.New("merkle tree does not keep a tree per tenant")
+
+// ParseTenancy returns the tenancy with the given name, an empty name returns the default
+func ParseTenancy(name string) (Tenancy, error) {
+	if name == "" {
+		return DefaultTenancy, nil
+	}
+	switch tenancy := Tenancy(name); tenancy {
+	case SingleTenancy, NamespaceTenancy:
+		return tenancy, nil
+	default:
+		return "", fmt.Errorf("unsupported tenancy %q", name)
+	}
+}
+
+// NewTreeWithTenancy creates a new Merkle Tree using the given hash algorithm, mode and tenancy,
+// the tenant trees of a multi-tenant tree share its hash algorithm and mode
+func NewTreeWithTenancy(algorithm HashAlgorithm, mode TreeMode, tenancy Tenancy) *MerkleTree {
+	t := NewTreeWithMode(algorithm, mode)
+	t.Tenancy = tenancy
+	if t.IsMultiTenant() {
+		t.Tenants = make(map[string]*MerkleTree)
+	}
+	return t
+}
+
+// IsMultiTenant returns whether the tree keeps a tree per tenant
+func (t *MerkleTree) IsMultiTenant() bool {
+	return t.Tenancy != "" && t.Tenancy != SingleTenancy
+}
+
+// TenantLeafHash returns the hash of the leaf committing to the root of a tenant tree in the top-level tree
+func TenantLeafHash(algorithm HashAlgorithm, tenant string, root []byte) []byte {
+	return HashLeaf(algorithm, []byte(fmt.Sprintf("trufaas-tenant\n%s\n%x\n", tenant, root)))
+}
+
+// GetTenant returns the tree of the tenant, a single tenant tree is the tree of every tenant
+func (t *MerkleTree) GetTenant(tenant string) (*MerkleTree, bool) {
+	if !t.IsMultiTenant() {
+		return t, true
+	}
+	tenantTree, found := t.Tenants[tenant]
+	return tenantTree, found
+}
+
+// TenantNames returns the sorted names of the tenants with a tree
+func (t *MerkleTree) TenantNames() []string {
+	names := make([]string, 0, len(t.Tenants))
+	for name := range t.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeyCount returns the number of identity keys with an active leaf, in all tenant trees of a multi-tenant tree
+func (t *MerkleTree) KeyCount() int {
+	if !t.IsMultiTenant() {
+		return t.KeyIndex.Count
+	}
+	count := 0
+	for _, tenantTree := range t.Tenants {
+		count += tenantTree.KeyIndex.Count
+	}
+	return count
+}
+
+// AppendTenantKeyedContent appends the content as the only active leaf of the identity key in the tree of the tenant,
+// as AppendKeyedContent does in a single tenant tree, and return the tree
+func (t *MerkleTree) AppendTenantKeyedContent(tenant string, key string, content []byte) *MerkleTree {
+	return t.AppendTenantKeyedLeafHash(tenant, key, t.hashLeaf(content))
+}
+
+// AppendTenantKeyedLeafHash appends the leaf hash as the only active leaf of the identity key in the tree of the tenant,
+// as AppendKeyedLeafHash does in a single tenant tree, and return the tree
+func (t *MerkleTree) AppendTenantKeyedLeafHash(tenant string, key string, leafHash []byte) *MerkleTree {
+	if !t.IsMultiTenant() {
+		return t.AppendKeyedLeafHash(key, leafHash)
+	}
+	tenantTree := t.cloneTenant(tenant)
+	tenantTree.AppendKeyedLeafHash(key, leafHash)
+	t.updateTenant(tenant, tenantTree)
+	return t
+}
+
+// RemoveTenantKeyedContent removes the active leaf of the identity key from the tree of the tenant,
+// as RemoveKeyedContent does in a single tenant tree, and return the tree
+func (t *MerkleTree) RemoveTenantKeyedContent(tenant string, key string) (*MerkleTree, error) {
+	if !t.IsMultiTenant() {
+		return t.RemoveKeyedContent(key)
+	}
+	if _, found := t.Tenants[tenant]; !found {
+		return t, ErrKeyNotFound
+	}
+	tenantTree := t.cloneTenant(tenant)
+	if _, err := tenantTree.RemoveKeyedContent(key); err != nil {
+		return t, err
+	}
+	t.updateTenant(tenant, tenantTree)
+	return t, nil
+}
+
+// GetTenantKeyedLeafHash returns the hash of the active leaf of the identity key in the tree of the tenant
+func (t *MerkleTree) GetTenantKeyedLeafHash(tenant string, key string) ([]byte, bool) {
+	tenantTree, found := t.GetTenant(tenant)
+	if !found {
+		return nil, false
+	}
+	return tenantTree.GetKeyedLeafHash(key)
+}
+
+// GenerateTenantInclusionProof returns the inclusion proof of the content registered under the identity key in the tree
+// of the tenant, and for a multi-tenant tree the inclusion proof of the tenant leaf in the top-level tree
+func (t *MerkleTree) GenerateTenantInclusionProof(tenant string, key string, content []byte) (*InclusionProof, *InclusionProof, error) {
+	tenantTree, found := t.GetTenant(tenant)
+	if !found {
+		return nil, nil, ErrKeyNotFound
+	}
+	proof, err := tenantTree.GenerateKeyedInclusionProof(key, content)
+	if err != nil || !t.IsMultiTenant() {
+		return proof, nil, err
+	}
+	tenantProof, err := t.GenerateTenantProof(tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, tenantProof, nil
+}
+
+// GenerateTenantProof returns the inclusion proof of the leaf committing to the root of the tenant tree in the top-level tree
+func (t *MerkleTree) GenerateTenantProof(tenant string) (*InclusionProof, error) {
+	if !t.IsMultiTenant() {
+		return nil, ErrNotMultiTenant
+	}
+	tenantLeafHash, found := t.KeyIndex.get(tenant)
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	position, found := t.findLeaf(tenantLeafHash)
+	if !found {
+		return nil, ErrTenantMismatch
+	}
+	return t.generateLeafInclusionProof(tenantLeafHash, position)
+}
+
+// VerifyTenantInclusionProof checks that the leaf hash hashes up to the root of the tenant tree and that the
+// tenant leaf committing to that root hashes up to the root of the top-level tree
+func VerifyTenantInclusionProof(leafHash []byte, proof *InclusionProof, tenant string, tenantRoot []byte, tenantProof *InclusionProof, root []byte) bool {
+	if !VerifyInclusionProof(leafHash, proof, tenantRoot) || tenantProof == nil {
+		return false
+	}
+	tenantLeafHash := TenantLeafHash(tenantProof.HashAlgorithm, tenant, tenantRoot)
+	return bytes.Equal(tenantLeafHash, tenantProof.LeafHash) && VerifyInclusionProof(tenantLeafHash, tenantProof, root)
+}
+
+// VerifyTenants checks that every tenant tree is committed to by its leaf in the top-level tree and that every
+// tenant leaf has a tree, so that a tenant tree cannot be changed without changing the root of the top-level tree
+func (t *MerkleTree) VerifyTenants() error {
+	if !t.IsMultiTenant() {
+		return nil
+	}
+	if len(t.Tenants) != t.KeyIndex.Count {
+		return fmt.Errorf("%w: %d tenant trees for %d tenant leafs", ErrTenantMismatch, len(t.Tenants), t.KeyIndex.Count)
+	}
+	for tenant, tenantTree := range t.Tenants {
+		leafHash, found := t.KeyIndex.get(tenant)
+		if !found || !bytes.Equal(leafHash, TenantLeafHash(t.HashAlgorithm, tenant, tenantTree.GetMerkleRoot())) {
+			return fmt.Errorf("%w: tenant %q", ErrTenantMismatch, tenant)
+		}
+		if tenantTree.HashAlgorithm != t.HashAlgorithm || tenantTree.Mode != t.Mode {
+			return fmt.Errorf("%w: tenant %q uses another hash algorithm or mode", ErrTenantMismatch, tenant)
+		}
+	}
+	return nil
+}
+
+// cloneTenant returns a copy of the tree of the tenant that can be mutated, or a new tree if the tenant has none,
+// published tenant trees are shared between copies of the top-level tree and never modified in place
+func (t *MerkleTree) cloneTenant(tenant string) *MerkleTree {
+	if tenantTree, found := t.Tenants[tenant]; found {
+		return tenantTree.Clone()
+	}
+	return NewTreeWithMode(t.HashAlgorithm, t.Mode)
+}
+
+// updateTenant replaces the tree of the tenant and its leaf in the top-level tree, the tenant is removed
+// once the last leaf of its mutable tree is removed
+func (t *MerkleTree) updateTenant(tenant string, tenantTree *MerkleTree) {
+	if t.Tenants == nil {
+		t.Tenants = make(map[string]*MerkleTree)
+	}
+	if tenantTree.KeyIndex.Count == 0 && !tenantTree.IsAppendOnly() {
+		delete(t.Tenants, tenant)
+		// the top-level tree has the mode of its tenants, so the tenant leaf can be removed
+		_, _ = t.RemoveKeyedContent(tenant)
+		return
+	}
+	t.Tenants[tenant] = tenantTree
+	t.AppendKeyedLeafHash(tenant, TenantLeafHash(t.HashAlgorithm, tenant, tenantTree.GetMerkleRoot()))
+}
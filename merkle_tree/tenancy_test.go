@@ -0,0 +1,165 @@
+package merkle_tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// newTenantTree returns a namespace tree of the mode holding count keys in each of the tenants
+func newTenantTree(mode TreeMode, tenants []string, count int) *MerkleTree {
+	mt := NewTreeWithTenancy(DefaultHashAlgorithm, mode, NamespaceTenancy)
+	for i := 0; i < count; i++ {
+		for _, tenant := range tenants {
+			mt.AppendTenantKeyedContent(tenant, fmt.Sprintf("%s/key-%d", tenant, i), []byte(fmt.Sprintf("%s/content-%d", tenant, i)))
+		}
+	}
+	return mt
+}
+
+func TestTenantInclusionProofRoundTrip(t *testing.T) {
+	tenants := []string{"default", "team-a", "team-b"}
+	for _, mode := range []TreeMode{MutableMode, AppendOnlyMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			for count := 1; count <= 9; count++ {
+				mt := newTenantTree(mode, tenants, count)
+				if err := mt.VerifyTenants(); err != nil {
+					t.Fatalf("%d keys: tenants not committed to: %v", count, err)
+				}
+				root := mt.GetMerkleRoot()
+				for _, tenant := range tenants {
+					tenantTree, _ := mt.GetTenant(tenant)
+					for i := 0; i < count; i++ {
+						content := []byte(fmt.Sprintf("%s/content-%d", tenant, i))
+						proof, tenantProof, err := mt.GenerateTenantInclusionProof(tenant, fmt.Sprintf("%s/key-%d", tenant, i), content)
+						if err != nil {
+							t.Fatalf("%d keys: proof of %s/key-%d failed: %v", count, tenant, i, err)
+						}
+						if !VerifyTenantInclusionProof(HashLeaf(mt.HashAlgorithm, content), proof, tenant, tenantTree.GetMerkleRoot(), tenantProof, root) {
+							t.Fatalf("%d keys: proof of %s/key-%d is not verified against the top-level root", count, tenant, i)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTenantInclusionProofRefusesTampering(t *testing.T) {
+	mt := newTenantTree(MutableMode, []string{"default", "team-a", "team-b"}, 5)
+	root := mt.GetMerkleRoot()
+	tenantTree, _ := mt.GetTenant("team-a")
+	tenantRoot := tenantTree.GetMerkleRoot()
+	otherTree, _ := mt.GetTenant("team-b")
+	content := []byte("team-a/content-2")
+	leafHash := HashLeaf(mt.HashAlgorithm, content)
+	proof, tenantProof, err := mt.GenerateTenantInclusionProof("team-a", "team-a/key-2", content)
+	if err != nil {
+		t.Fatalf("proof failed: %v", err)
+	}
+	otherTenantProof, _ := mt.GenerateTenantProof("team-b")
+
+	tampered := map[string]func() bool{
+		"other tenant name": func() bool {
+			return VerifyTenantInclusionProof(leafHash, proof, "team-b", tenantRoot, tenantProof, root)
+		},
+		"other tenant root": func() bool {
+			return VerifyTenantInclusionProof(leafHash, proof, "team-a", otherTree.GetMerkleRoot(), tenantProof, root)
+		},
+		"tenant proof of another tenant": func() bool {
+			return VerifyTenantInclusionProof(leafHash, proof, "team-a", tenantRoot, otherTenantProof, root)
+		},
+		"flipped tenant sibling": func() bool {
+			p := copyProof(tenantProof)
+			p.Path[0].Hash[0] ^= 0x01
+			return VerifyTenantInclusionProof(leafHash, proof, "team-a", tenantRoot, p, root)
+		},
+		"wrong top-level root": func() bool {
+			return VerifyTenantInclusionProof(leafHash, proof, "team-a", tenantRoot, tenantProof, tenantRoot)
+		},
+		"no tenant proof": func() bool {
+			return VerifyTenantInclusionProof(leafHash, proof, "team-a", tenantRoot, nil, root)
+		},
+		"wrong leaf": func() bool {
+			return VerifyTenantInclusionProof(HashLeaf(mt.HashAlgorithm, []byte("team-a/content-3")), proof, "team-a", tenantRoot, tenantProof, root)
+		},
+	}
+	for name, verify := range tampered {
+		if verify() {
+			t.Errorf("%s: expected the proof to be refused", name)
+		}
+	}
+}
+
+func TestTenantMutationLeavesOtherTenantsUnchanged(t *testing.T) {
+	for _, mode := range []TreeMode{MutableMode, AppendOnlyMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			mt := newTenantTree(mode, []string{"team-a", "team-b"}, 4)
+			root := mt.GetMerkleRoot()
+			teamB, _ := mt.GetTenant("team-b")
+			teamBRoot := teamB.GetMerkleRoot()
+			proof, _, err := mt.GenerateTenantInclusionProof("team-b", "team-b/key-1", []byte("team-b/content-1"))
+			if err != nil {
+				t.Fatalf("proof failed: %v", err)
+			}
+
+			mutated := mt.Clone()
+			mutated.AppendTenantKeyedContent("team-a", "team-a/key-9", []byte("team-a/content-9"))
+			if _, err = mutated.RemoveTenantKeyedContent("team-a", "team-a/key-0"); err != nil {
+				t.Fatalf("remove failed: %v", err)
+			}
+			if bytes.Equal(mutated.GetMerkleRoot(), root) {
+				t.Fatal("expected the top-level root to change")
+			}
+
+			// the tree of the other tenant and the proofs against its root are unchanged
+			mutatedB, _ := mutated.GetTenant("team-b")
+			if !bytes.Equal(mutatedB.GetMerkleRoot(), teamBRoot) {
+				t.Fatal("expected the root of the other tenant to be unchanged")
+			}
+			if !VerifyInclusionProof(proof.LeafHash, proof, mutatedB.GetMerkleRoot()) {
+				t.Fatal("expected the proof in the other tenant to stay valid")
+			}
+			if err = mutated.VerifyTenants(); err != nil {
+				t.Fatalf("tenants not committed to after the mutation: %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantRemovalOfLastKey(t *testing.T) {
+	mt := newTenantTree(MutableMode, []string{"team-a", "team-b"}, 1)
+	if _, err := mt.RemoveTenantKeyedContent("team-a", "team-a/key-0"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, found := mt.GetTenant("team-a"); found {
+		t.Fatal("expected the tenant of a mutable tree to be removed with its last key")
+	}
+	if names := mt.TenantNames(); len(names) != 1 || names[0] != "team-b" {
+		t.Fatalf("expected only team-b to be left, found %v", names)
+	}
+	if _, err := mt.GenerateTenantProof("team-a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected %v for the removed tenant, found %v", ErrKeyNotFound, err)
+	}
+	if err := mt.VerifyTenants(); err != nil {
+		t.Fatalf("tenants not committed to after the removal: %v", err)
+	}
+}
+
+func TestVerifyTenantsDetectsChangedTenantTree(t *testing.T) {
+	mt := newTenantTree(MutableMode, []string{"team-a", "team-b"}, 3)
+
+	// a tenant tree replaced without updating its leaf in the top-level tree
+	mt.Tenants["team-a"] = mt.Tenants["team-b"]
+	if err := mt.VerifyTenants(); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected %v for a replaced tenant tree, found %v", ErrTenantMismatch, err)
+	}
+	delete(mt.Tenants, "team-a")
+	if err := mt.VerifyTenants(); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected %v for a missing tenant tree, found %v", ErrTenantMismatch, err)
+	}
+	if _, err := newKeyedTree(MutableMode, 2).GenerateTenantProof("team-a"); !errors.Is(err, ErrNotMultiTenant) {
+		t.Fatalf("expected %v for a single tenant tree, found %v", ErrNotMultiTenant, err)
+	}
+}
@@ -0,0 +1,48 @@
+package merkle_tree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TreeMode represents how the leafs of a Merkle tree change
+type TreeMode string
+
+// Supported tree modes
+const (
+	// MutableMode removes leafs, a removed leaf is replaced by the last leaf and a node without sibling is paired with itself
+	MutableMode TreeMode = "mutable"
+	// AppendOnlyMode never removes or reorders leafs, removals append a tombstone leaf and a node without sibling
+	// is promoted to the next level, so that the tree has the RFC 6962 shape and supports consistency proofs
+	AppendOnlyMode TreeMode = "append-only"
+)
+
+// DefaultTreeMode is used for new trees when no mode is configured and for trees stored without one
+const DefaultTreeMode = MutableMode
+
+// ErrAppendOnly is returned when a leaf would be removed from an append-only tree
+var ErrAppendOnly = errors.New("leafs cannot be removed from an append-only merkle tree")
+
+// ParseTreeMode returns the tree mode with the given name, an empty name returns the default
+func ParseTreeMode(name string) (TreeMode, error) {
+	if name == "" {
+		return DefaultTreeMode, nil
+	}
+	switch mode := TreeMode(name); mode {
+	case MutableMode, AppendOnlyMode:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported tree mode %q", name)
+	}
+}
+
+// IsAppendOnly returns whether the tree is in append-only mode
+func (t *MerkleTree) IsAppendOnly() bool {
+	return t.Mode == AppendOnlyMode
+}
+
+// tombstoneContent returns the content of the leaf appended when the leaf of the identity key is removed from an
+// append-only tree, it commits to the key and the removed leaf so that the removal changes the root
+func tombstoneContent(key string, removedHash []byte) []byte {
+	return []byte(fmt.Sprintf("trufaas-tombstone\n%s\n%x\n", key, removedHash))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/checkpoint"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/health"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeHead "github.com/TruFaaS/TruFaaS/tree_head"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"io"
+	"time"
+)
+
+// reconcileRetryInterval is the interval at which an inconsistent trust state is reconciled again
+const reconcileRetryInterval = 30 * time.Second
+
+// retryReconciliation reconciles the trust state again at the interval while it is inconsistent. Mutations are
+// refused while the state is inconsistent, so e.g. a root that could not be anchored in a TPM that was unavailable
+// for a while is only anchored again by reconciling, which restores the previous snapshot the TPM still holds
+func (routerConfig *RouterConfig) retryReconciliation(interval time.Duration) {
+	for range time.Tick(interval) {
+		if status, reason := health.Get(); status == health.StatusInconsistent {
+			fmt.Println("Trust state is inconsistent,", reason+", reconciling again")
+			routerConfig.reconcileTrustState()
+		}
+	}
+}
+
+// reconcileTrustState authenticates the stored merkle tree after a restart and anchors its root in the TPM again.
+// The root is authenticated by the root kept in the TPM NV storage, or by the signed checkpoint when the TPM
+// has no root stored, e.g. as the simulator loses its state, as long as the checkpoint is not older than the latest
+// signed tree head. The previous snapshot is restored if only it is
+// authenticated. An empty tree is authenticated the same way, so that a lost stored tree is not mistaken for a
+// registry without functions. The health status is inconsistent if no tree is authenticated, in which case nothing
+// is anchored and no verification is served, or if a mutation applied before could still not be recorded in the
+// audit log.
+func (routerConfig *RouterConfig) reconcileTrustState() {
+	err := treeManager.Initialize()
+	if errors.Is(err, utils.ErrUnkeyedTree) && routerConfig.Config.DiscardTree {
+		err = discardUnkeyedTree()
+	}
+	if errors.Is(err, utils.ErrUnkeyedTree) {
+		// none of the functions would ever verify, they have to be registered again in an empty tree
+		health.SetWithCode(health.StatusInconsistent, "stored merkle tree holds functions registered before functions were keyed, "+
+			"set "+constants.DiscardUnkeyedEnv+" to replace it with an empty tree and register the functions again", constants.ErrCodeUnkeyedTree)
+		fmt.Println("Reconciliation failed,", err)
+		return
+	}
+	if err != nil {
+		health.Set(health.StatusInconsistent, "stored merkle tree could not be loaded")
+		fmt.Println("Reconciliation failed, stored merkle tree could not be loaded:", err)
+		return
+	}
+	mt := treeManager.Snapshot()
+
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		health.Set(health.StatusInconsistent, "TPM could not be opened")
+		fmt.Println("Reconciliation failed, TPM could not be opened:", err)
+		return
+	}
+	root := mt.GetMerkleRoot()
+
+	authenticatedBy, reason := authenticateStoredTree(tpmInstance, mt)
+	if authenticatedBy == "" {
+		// the component may have stopped after storing a mutated tree but before anchoring its root,
+		// in which case the previous snapshot is the tree that is anchored
+		if previous, err := restorePreviousTree(tpmInstance); err == nil && previous != nil {
+			mt, root = previous, previous.GetMerkleRoot()
+			authenticatedBy, reason = "previous snapshot", ""
+		}
+	}
+	if authenticatedBy == "" {
+		health.Set(health.StatusInconsistent, reason)
+		fmt.Println("Reconciliation failed,", reason)
+		return
+	}
+
+	// An empty tree has no root to anchor, only the PCR is reset so that nothing verifies. The NV storage is left
+	// unchanged, the root stored in it is the anchor of the last tree and must survive a lost stored tree
+	anchor := func() error { return tpm.SaveToTPM(tpmInstance, root, mt.HashAlgorithm) }
+	if len(root) == 0 {
+		anchor = func() error { return tpm.ResetPCR(tpmInstance) }
+	}
+	if err := anchor(); err != nil {
+		health.Set(health.StatusInconsistent, treeManager.AnchorFailure)
+		fmt.Println("Reconciliation failed, merkle root could not be anchored in the TPM:", err)
+		return
+	}
+	signTreeHeadIfMissing(mt)
+	if err := treeManager.RecordUnrecorded(); err != nil {
+		health.Set(health.StatusInconsistent, treeManager.AuditFailure)
+		fmt.Println("Reconciliation failed, mutation could not be recorded in the audit log:", err)
+		return
+	}
+	health.Set(health.StatusHealthy, "")
+	fmt.Println("Reconciliation done, merkle root authenticated by", authenticatedBy)
+}
+
+// discardUnkeyedTree replaces a stored tree whose functions are not keyed by an empty tree, which is anchored and
+// signed so that it is authenticated, the functions have to be registered again. The discarded tree is kept as the
+// previous snapshot by the stores
+func discardUnkeyedTree() error {
+	mt := utils.NewMerkleTree()
+	if err := treeManager.Restore(mt); err != nil {
+		return err
+	}
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		return err
+	}
+	// no root is anchored for an empty tree, the root of the discarded tree is removed from the NV storage
+	if err = tpm.SaveToTPM(tpmInstance, nil, mt.HashAlgorithm); err != nil {
+		return err
+	}
+	if _, err = utils.StoreCheckpoint(mt); err != nil {
+		return err
+	}
+	fmt.Println("Stored merkle tree holds functions that are not keyed, it is replaced by an empty tree")
+	return nil
+}
+
+// signTreeHeadIfMissing signs a tree head of the authenticated tree if the latest tree head is of another tree,
+// e.g. for a tree stored before tree heads were signed or converted to a newer format on load
+func signTreeHeadIfMissing(mt *merkleTree.MerkleTree) {
+	if latest, _ := treeHead.Latest(); latest != nil && latest.Matches(mt) {
+		return
+	}
+	cp, err := utils.StoreCheckpoint(mt)
+	if err == nil {
+		err = treeHead.Append(cp)
+	}
+	if err != nil {
+		fmt.Println("Failed to sign a tree head of the stored merkle tree:", err)
+	}
+}
+
+// restorePreviousTree restores the previous snapshot as the active tree if it is authenticated, nil is returned otherwise
+func restorePreviousTree(tpmInstance io.ReadWriter) (*merkleTree.MerkleTree, error) {
+	previous, err := utils.RetrievePreviousMerkleTree()
+	if err != nil {
+		return nil, err
+	}
+	if authenticatedBy, _ := authenticateStoredTree(tpmInstance, previous); authenticatedBy == "" {
+		return nil, nil
+	}
+	fmt.Println("Stored merkle tree is not authenticated, restoring the previous snapshot")
+	if err = treeManager.Restore(previous); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// authenticateStoredTree returns what authenticated the root of the tree, or the reason it is not authenticated
+func authenticateStoredTree(tpmInstance io.ReadWriter, mt *merkleTree.MerkleTree) (string, string) {
+	nvRoot, err := tpm.ReadRootFromNV(tpmInstance)
+	if err == nil {
+		if !bytes.Equal(nvRoot, mt.GetMerkleRoot()) {
+			return "", "stored merkle root does not match the root in the TPM NV storage"
+		}
+		return "TPM NV storage", ""
+	}
+	if !errors.Is(err, tpm.ErrNoNVRoot) {
+		return "", "merkle root could not be read from the TPM NV storage"
+	}
+
+	cp, err := checkpoint.Load(utils.GetTreeStore())
+	if errors.Is(err, store.ErrNotFound) && len(mt.GetMerkleRoot()) == 0 {
+		// no root was ever anchored nor signed, e.g. on the first start, so there is nothing an empty tree could have lost
+		return "absence of any anchored root", ""
+	}
+	if err != nil {
+		return "", "no root in the TPM NV storage and no checkpoint could be loaded"
+	}
+	if !cp.VerifyTrusted() {
+		return "", "checkpoint signature is invalid"
+	}
+	if !cp.Matches(mt) {
+		return "", "stored merkle tree does not match the signed checkpoint"
+	}
+	if reason := checkLatestTreeHead(cp, mt); reason != "" {
+		return "", reason
+	}
+	return "signed checkpoint", ""
+}
+
+// checkLatestTreeHead returns why the checkpoint is not accepted as the latest state of the tree, or an empty string.
+// Any checkpoint ever signed verifies, so without a root in the NV storage a stored tree and checkpoint could be
+// replaced by older ones. The checkpoint must be the latest signed tree head, or be signed after it, e.g. if the
+// component stopped before the tree head was appended or another replica mutated the tree, in which case an
+// append-only tree must extend the tree of the latest tree head
+func checkLatestTreeHead(cp *checkpoint.Checkpoint, mt *merkleTree.MerkleTree) string {
+	latest, _ := treeHead.Latest()
+	if latest == nil {
+		return ""
+	}
+	if cp.Timestamp == latest.Timestamp && cp.TreeSize == latest.TreeSize && bytes.Equal(cp.RootHash, latest.RootHash) {
+		return ""
+	}
+	if cp.Timestamp <= latest.Timestamp {
+		return "signed checkpoint is older than the latest signed tree head, the stored merkle tree was rolled back"
+	}
+	if !mt.IsAppendOnly() || latest.TreeSize == 0 || latest.HashAlgorithm != cp.HashAlgorithm {
+		return ""
+	}
+	proof, err := mt.GenerateConsistencyProof(latest.TreeSize, mt.LeafCount)
+	if err != nil || !merkleTree.VerifyConsistencyProof(proof, latest.RootHash, mt.GetMerkleRoot()) {
+		return "stored merkle tree does not extend the tree of the latest signed tree head"
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/health"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeBaselineTree stores the tree of the baseline format, whose functions are not keyed by their identity
+func storeBaselineTree(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("utils", "testdata", "baseline_tree.gob"))
+	if err != nil {
+		t.Fatalf("failed to read the baseline tree: %v", err)
+	}
+	if err = utils.GetTreeStore().StoreTree(data); err != nil {
+		t.Fatalf("failed to store the baseline tree: %v", err)
+	}
+}
+
+// request sends the request to the router and returns the error code of its response
+func request(method string, path string, body string) (int, string) {
+	recorder := httptest.NewRecorder()
+	testRouter.Router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var response struct {
+		ErrorCode string `json:"error_code"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.ErrorCode
+}
+
+func TestReconcileBaselineTree(t *testing.T) {
+	storeBaselineTree(t)
+	defer func() { testRouter.Config.DiscardTree = false }()
+
+	// the component keeps running, but refuses trust values until the functions are registered again
+	testRouter.reconcileTrustState()
+	if status, _ := health.Get(); status != health.StatusInconsistent {
+		t.Fatalf("expected inconsistent health for a baseline tree, found %s", status)
+	}
+	if code, errorCode := request(http.MethodGet, "/health", ""); code != http.StatusServiceUnavailable || errorCode != constants.ErrCodeUnkeyedTree {
+		t.Fatalf("expected 503 with %s from /health, found %d %s", constants.ErrCodeUnkeyedTree, code, errorCode)
+	}
+	if code, errorCode := request(http.MethodPost, "/fn/create", functionJSON("baseline")); code != http.StatusServiceUnavailable || errorCode != constants.ErrCodeUnkeyedTree {
+		t.Fatalf("expected 503 with %s from /fn/create, found %d %s", constants.ErrCodeUnkeyedTree, code, errorCode)
+	}
+
+	// once discarding the tree is allowed, the functions are registered again in an empty tree
+	testRouter.Config.DiscardTree = true
+	testRouter.reconcileTrustState()
+	if status, reason := health.Get(); status != health.StatusHealthy {
+		t.Fatalf("expected healthy after discarding the baseline tree, found %s (%s)", status, reason)
+	}
+	if keys := treeManager.Snapshot().KeyCount(); keys != 0 {
+		t.Fatalf("expected an empty tree after discarding the baseline tree, found %d keys", keys)
+	}
+	if code, _ := request(http.MethodPost, "/fn/create", functionJSON("baseline")); code != http.StatusCreated {
+		t.Fatalf("expected the function to be registered again, found %d", code)
+	}
+	if code, _ := request(http.MethodPost, "/fn/verify", functionJSON("baseline")); code != http.StatusOK {
+		t.Fatalf("expected the registered function to verify, found %d", code)
+	}
+
+	// the empty tree is authenticated on the next restart without discarding anything
+	testRouter.Config.DiscardTree = false
+	testRouter.reconcileTrustState()
+	if status, reason := health.Get(); status != health.StatusHealthy {
+		t.Fatalf("expected healthy after restarting, found %s (%s)", status, reason)
+	}
+}
+
+// clearNVRoot removes the root from the TPM NV storage, as a TPM without persistent NV storage after a restart
+func clearNVRoot(t *testing.T) {
+	tpmInstance, err := tpm.GetInstance()
+	if err == nil {
+		err = tpm.SaveToTPM(tpmInstance, nil, merkleTree.DefaultHashAlgorithm)
+	}
+	if err != nil {
+		t.Fatalf("failed to clear the NV root: %v", err)
+	}
+}
+
+func TestReconcileRefusesRolledBackCheckpoint(t *testing.T) {
+	treeStore := utils.GetTreeStore()
+	if code, _ := request(http.MethodPost, "/fn/create", functionJSON("rollback-1")); code != http.StatusCreated {
+		t.Fatalf("create responded with %d", code)
+	}
+	oldTree, err := treeStore.LoadTree()
+	if err != nil {
+		t.Fatalf("failed to load the tree: %v", err)
+	}
+	oldCheckpoint, err := treeStore.LoadCheckpoint()
+	if err != nil {
+		t.Fatalf("failed to load the checkpoint: %v", err)
+	}
+	// the checkpoints are signed at different times
+	time.Sleep(2 * time.Millisecond)
+	if code, _ := request(http.MethodPost, "/fn/delete", functionJSON("rollback-1")); code != http.StatusOK {
+		t.Fatalf("delete responded with %d", code)
+	}
+	currentTree, _ := treeStore.LoadTree()
+	currentCheckpoint, _ := treeStore.LoadCheckpoint()
+
+	// the older tree and its validly signed checkpoint would bring back the deleted function
+	if err = treeStore.StoreTree(oldTree); err == nil {
+		err = treeStore.StoreCheckpoint(oldCheckpoint)
+	}
+	if err != nil {
+		t.Fatalf("failed to roll back the store: %v", err)
+	}
+	clearNVRoot(t)
+	testRouter.reconcileTrustState()
+	if status, reason := health.Get(); status != health.StatusInconsistent || !strings.Contains(reason, "rolled back") {
+		t.Fatalf("expected inconsistent health for a rolled back checkpoint, found %s (%s)", status, reason)
+	}
+
+	// the latest checkpoint is still accepted without the NV root
+	if err = treeStore.StoreTree(currentTree); err == nil {
+		err = treeStore.StoreCheckpoint(currentCheckpoint)
+	}
+	if err != nil {
+		t.Fatalf("failed to restore the store: %v", err)
+	}
+	clearNVRoot(t)
+	testRouter.reconcileTrustState()
+	if status, reason := health.Get(); status != health.StatusHealthy {
+		t.Fatalf("expected healthy for the latest checkpoint, found %s (%s)", status, reason)
+	}
+	if code, _ := request(http.MethodPost, "/fn/verify", functionJSON("rollback-1")); code == http.StatusOK {
+		t.Fatal("expected the deleted function not to verify")
+	}
+}
@@ -1,33 +1,179 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/TruFaaS/TruFaaS/attestation"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/auth"
+	"github.com/TruFaaS/TruFaaS/config"
 	"github.com/TruFaaS/TruFaaS/constants"
 	"github.com/TruFaaS/TruFaaS/fission"
+	"github.com/TruFaaS/TruFaaS/health"
+	"github.com/TruFaaS/TruFaaS/identity"
+	identityKey "github.com/TruFaaS/TruFaaS/identity_key"
+	serverTLS "github.com/TruFaaS/TruFaaS/server_tls"
+	"github.com/TruFaaS/TruFaaS/store"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeHead "github.com/TruFaaS/TruFaaS/tree_head"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	treeProof "github.com/TruFaaS/TruFaaS/tree_proof"
+	"github.com/TruFaaS/TruFaaS/utils"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
 )
 
 type RouterConfig struct {
-	Router   *mux.Router
-	Platform constants.FaaSPlatform
+	Router        *mux.Router
+	Platform      constants.FaaSPlatform
+	Config        *config.Config
+	Authenticator auth.Authenticator
+	TLS           *serverTLS.Reloader // TLS serves the certificate of the HTTPS server, nil if plain HTTP is served
 }
 
 // Initialize initializes the router configuration
 func (routerConfig *RouterConfig) Initialize(platform constants.FaaSPlatform) {
 	fmt.Println("Initializing Router")
 	routerConfig.Platform = platform
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	routerConfig.Config = cfg
+	utils.SetNewTreeHashAlgorithm(cfg.HashAlgorithm)
+	utils.SetNewTreeMode(cfg.TreeMode)
+	utils.SetNewTreeTenancy(cfg.Tenancy)
+
+	treeStore, err := store.NewTreeStore(cfg.StoreBackend, cfg.StorePath, cfg.EtcdEndpoints, cfg.EtcdPrefix)
+	if err != nil {
+		log.Fatalf("failed to open tree store: %v", err)
+	}
+	utils.SetTreeStore(treeStore)
+	fmt.Println("Using", treeStore.Name())
+
+	tpmBackend, err := tpm.NewBackend(cfg.TPMBackend, cfg.TPMDevicePath, cfg.TPMAddress)
+	if err != nil {
+		log.Fatalf("failed to configure TPM: %v", err)
+	}
+	if err = tpm.Initialize(tpmBackend); err != nil {
+		log.Fatalf("failed to initialize TPM: %v", err)
+	}
+	if err = routerConfig.initializeSigningKey(); err != nil {
+		log.Fatalf("failed to initialize signing key: %v", err)
+	}
+	if cfg.ReplicaKeys != "" {
+		if err = identity.LoadReplicaKeys(cfg.ReplicaKeys); err != nil {
+			log.Fatalf("failed to load replica keys: %v", err)
+		}
+	}
+	if err = audit.Initialize(cfg.AuditLog, cfg.AuditVerify); err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	if err = treeHead.Initialize(cfg.TreeHeadLog); err != nil {
+		log.Fatalf("failed to load tree head history: %v", err)
+	}
+	routerConfig.initializeTLS()
+	routerConfig.Authenticator, err = auth.NewAuthenticator(cfg.AuthMethods, cfg.AuthKeys, cfg.AuthJWKS, cfg.AuthIssuer, cfg.AuthAudience)
+	if err != nil {
+		log.Fatalf("failed to configure authentication: %v", err)
+	}
+	if routerConfig.Authenticator == nil {
+		// serving without authentication lets any client change trust values, so it must be asked for
+		if !cfg.AllowNoAuth {
+			log.Fatalf("no authentication method is configured, set %s, or %s=true to serve without authentication",
+				constants.AuthMethodsEnv, constants.AllowNoAuthEnv)
+		}
+		fmt.Println("Authentication is disabled, any client may create, update and delete trust values")
+	}
+	routerConfig.reconcileTrustState()
+	// trees stored by other replicas sharing the store are published here as well
+	go treeManager.Watch(context.Background())
+	go routerConfig.retryReconciliation(reconcileRetryInterval)
+
+	routerConfig.initializeRoutes()
+}
+
+// initializeRoutes creates the router serving the routes, which are authenticated by the authenticator
+func (routerConfig *RouterConfig) initializeRoutes() {
+	// the audit log names the functions and who changed them
+	auditRead := auth.Require(routerConfig.Authenticator, routerConfig.Config.AuditRule)
+
 	routerConfig.Router = mux.NewRouter().StrictSlash(true)
+	routerConfig.Router.HandleFunc("/health", health.HealthHandler).Methods(http.MethodGet)
+	routerConfig.Router.Handle("/audit", auditRead(http.HandlerFunc(audit.AuditHandler))).Methods(http.MethodGet)
+	routerConfig.Router.HandleFunc("/identity/key", identityKey.KeyHandler).Methods(http.MethodGet)
+	routerConfig.Router.HandleFunc("/tree/head", treeHead.TreeHeadHandler).Methods(http.MethodGet)
+	routerConfig.Router.HandleFunc("/tree/heads", treeHead.TreeHeadHistoryHandler).Methods(http.MethodGet)
+	routerConfig.Router.Handle("/tree/consistency", health.RequireHealthy(http.HandlerFunc(treeProof.ConsistencyProofHandler))).Methods(http.MethodGet)
+	routerConfig.Router.Handle("/attest/quote", health.RequireHealthy(http.HandlerFunc(attestation.QuoteMerkleRoot))).Methods(http.MethodGet)
 	routerConfig.initializeSpecifiedPlatformRoutes()
 
 }
 
 // Run Starts the router
 func (routerConfig *RouterConfig) Run() {
-	fmt.Println("Server started on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", routerConfig.Router))
+	if routerConfig.TLS == nil {
+		fmt.Println("Server started on port 8080...")
+		log.Fatal(http.ListenAndServe(":8080", routerConfig.Router))
+	}
 
+	// rotated certificates are picked up without restarting
+	go routerConfig.TLS.Watch(serverTLS.ReloadInterval, nil)
+	server := &http.Server{Addr: ":8080", Handler: routerConfig.Router, TLSConfig: routerConfig.TLS.TLSConfig()}
+	fmt.Println("Server started on port 8080 with TLS...")
+	log.Fatal(server.ListenAndServeTLS("", ""))
+
+}
+
+// initializeTLS loads the server certificate, generating a self-signed one first in the self-signed mode
+func (routerConfig *RouterConfig) initializeTLS() {
+	cfg := routerConfig.Config
+	for _, method := range cfg.AuthMethods {
+		if method == auth.MethodMTLS && (cfg.TLSMode == serverTLS.ModeOff || cfg.TLSClientCA == "") {
+			log.Fatalf("mtls authentication requires TLS and a client CA bundle")
+		}
+	}
+	if cfg.TLSMode == serverTLS.ModeOff {
+		fmt.Println("TLS is disabled, the API is served over plain HTTP")
+		return
+	}
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		log.Fatalf("TLS requires a certificate file and a key file")
+	}
+	if cfg.TLSMode == serverTLS.ModeSelfSigned {
+		if err := serverTLS.EnsureSelfSigned(cfg.TLSCert, cfg.TLSKey); err != nil {
+			log.Fatalf("failed to generate self-signed TLS certificate: %v", err)
+		}
+	}
+
+	reloader, err := serverTLS.NewReloader(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA, cfg.TLSClientAuth)
+	if err != nil {
+		log.Fatalf("failed to load TLS certificate: %v", err)
+	}
+	routerConfig.TLS = reloader
+}
+
+// initializeSigningKey loads the identity key signing tree heads and ephemeral keys from its file or the TPM
+func (routerConfig *RouterConfig) initializeSigningKey() error {
+	if routerConfig.Config.KeySource == identity.FileKeySource {
+		return identity.Initialize(routerConfig.Config.SigningKey)
+	}
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		return err
+	}
+	signer, err := tpm.SigningKey(tpmInstance)
+	if err != nil {
+		return err
+	}
+	if err = identity.InitializeWithSigner(signer); err != nil {
+		return err
+	}
+	keyID, _ := identity.KeyID()
+	fmt.Println("Using the signing key resident in the TPM, key id", keyID)
+	return nil
 }
 
 // To initialize only specified FaaS platform routes
@@ -48,8 +194,27 @@ func (routerConfig *RouterConfig) initializeSpecifiedPlatformRoutes() {
 // Fission Routes
 func (routerConfig *RouterConfig) initializeFissionRoutes() {
 	fmt.Println("Initializing Fission Routes")
-	routerConfig.Router.HandleFunc("/fn/create", fission.CreateFnTrustValue).Methods(http.MethodPost)
-	routerConfig.Router.HandleFunc("/fn/verify", fission.VerifyFnTrustValue).Methods(http.MethodPost)
+	// trust values are neither served nor mutated while the stored trust state is not authenticated
+	// only the mutating principals, by default the Fission controller, may change trust values
+	mutate := auth.Require(routerConfig.Authenticator, routerConfig.Config.MutateRule)
+	verify := auth.Require(routerConfig.Authenticator, routerConfig.Config.VerifyRule)
+
+	fnRouter := routerConfig.Router.PathPrefix("/fn").Subrouter()
+	fnRouter.Use(health.RequireHealthy)
+	fnRouter.Handle("/create", mutate(http.HandlerFunc(fission.CreateFnTrustValue))).Methods(http.MethodPost)
+	fnRouter.Handle("/verify", verify(http.HandlerFunc(fission.VerifyFnTrustValue))).Methods(http.MethodPost)
+	fnRouter.Handle("/update", mutate(http.HandlerFunc(fission.UpdateFnTrustValue))).Methods(http.MethodPost)
+	fnRouter.Handle("/delete", mutate(http.HandlerFunc(fission.DeleteFnTrustValue))).Methods(http.MethodPost)
+
+	// namespace-scoped routes only accept functions of the namespace in the path
+	nsPath := "/ns/{" + constants.NamespacePathVar + "}/fn"
+	routerConfig.Router.Handle(nsPath, health.RequireHealthy(verify(http.HandlerFunc(fission.ListFnTrustValues)))).Methods(http.MethodGet)
+	nsRouter := routerConfig.Router.PathPrefix(nsPath).Subrouter()
+	nsRouter.Use(health.RequireHealthy)
+	nsRouter.Handle("/create", mutate(http.HandlerFunc(fission.CreateFnTrustValue))).Methods(http.MethodPost)
+	nsRouter.Handle("/verify", verify(http.HandlerFunc(fission.VerifyFnTrustValue))).Methods(http.MethodPost)
+	nsRouter.Handle("/update", mutate(http.HandlerFunc(fission.UpdateFnTrustValue))).Methods(http.MethodPost)
+	nsRouter.Handle("/delete", mutate(http.HandlerFunc(fission.DeleteFnTrustValue))).Methods(http.MethodPost)
 
 }
 
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/auth"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/fission"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	"github.com/google/go-tpm/tpm2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRouter is the router all tests share, it is initialized once as only one TPM simulator can be open at a time
+var testRouter *RouterConfig
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "trufaas-test")
+	if err != nil {
+		fmt.Println("failed to create test directory:", err)
+		os.Exit(1)
+	}
+	os.Setenv(constants.StorePathEnv, dir)
+	os.Setenv(constants.SigningKeyEnv, filepath.Join(dir, constants.SigningKeyFileName))
+	os.Setenv(constants.AuditLogEnv, filepath.Join(dir, constants.AuditLogFileName))
+	os.Setenv(constants.TreeHeadLogEnv, filepath.Join(dir, constants.TreeHeadLogFileName))
+	os.Setenv(constants.AllowNoAuthEnv, "true")
+	testRouter = &RouterConfig{}
+	testRouter.Initialize(constants.Fission)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// functionJSON returns the request body of the function with the given name in the default namespace
+func functionJSON(name string) string {
+	return fmt.Sprintf(`{"function_information":{"function_name":%q,"function_namespace":"default"}}`, name)
+}
+
+// post sends the body to the path of the router and returns the response
+func post(server *httptest.Server, path string, body string) (*http.Response, error) {
+	resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// TestConcurrentCreateAndVerify verifies a registered function while other functions are created, every verification
+// must see a published tree whose root is anchored. Run with -race to check the snapshot handling
+func TestConcurrentCreateAndVerify(t *testing.T) {
+	server := httptest.NewServer(testRouter.Router)
+	defer server.Close()
+
+	if resp, err := post(server, "/fn/create", functionJSON("concurrent-base")); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create of the base function failed: %v %v", resp, err)
+	}
+
+	const creators, verifiers, requests = 4, 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, (creators+verifiers)*requests)
+	for c := 0; c < creators; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				resp, err := post(server, "/fn/create", functionJSON(fmt.Sprintf("concurrent-%d-%d", c, i)))
+				if err == nil && resp.StatusCode != http.StatusCreated {
+					err = fmt.Errorf("create responded with %d", resp.StatusCode)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(c)
+	}
+	for v := 0; v < verifiers; v++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				resp, err := post(server, "/fn/verify", functionJSON("concurrent-base"))
+				if err == nil && resp.StatusCode != http.StatusOK {
+					err = fmt.Errorf("verify responded with %d", resp.StatusCode)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// every created function is in the published tree
+	for c := 0; c < creators; c++ {
+		for i := 0; i < requests; i++ {
+			resp, err := post(server, "/fn/verify", functionJSON(fmt.Sprintf("concurrent-%d-%d", c, i)))
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("function concurrent-%d-%d is not verified: %v", c, i, err)
+			}
+		}
+	}
+}
+
+// registerFunctions registers functions bench-<i> until the active tree holds count functions, in one mutation so
+// that the tree is anchored once
+func registerFunctions(b *testing.B, count int) {
+	_, err := treeManager.Mutate(&audit.Entry{Operation: audit.OperationCreate, Actor: "benchmark"}, func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+		for i := mt.KeyCount(); i < count; i++ {
+			var function fission.Function
+			if err := json.Unmarshal([]byte(functionJSON(fmt.Sprintf("bench-%d", i))), &function); err != nil {
+				return nil, err
+			}
+			fnByteArr, err := function.CanonicalBytes()
+			if err != nil {
+				return nil, err
+			}
+			mt = mt.AppendTenantKeyedContent(function.Tenant(), function.Identity(), fnByteArr)
+		}
+		return mt, nil
+	})
+	if err != nil {
+		b.Fatalf("failed to register %d functions: %v", count, err)
+	}
+}
+
+// BenchmarkVerify measures a verification by the router over trees of increasing size and reports the p99 latency,
+// which stays flat as the verification is served from the in-memory tree
+func BenchmarkVerify(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		registerFunctions(b, size)
+		body := functionJSON(fmt.Sprintf("bench-%d", size/2))
+		b.Run(fmt.Sprintf("functions=%d", size), func(b *testing.B) {
+			latencies := make([]time.Duration, 0, b.N)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				recorder := httptest.NewRecorder()
+				testRouter.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/fn/verify", strings.NewReader(body)))
+				latencies = append(latencies, time.Since(start))
+				if recorder.Code != http.StatusOK {
+					b.Fatalf("verify responded with %d", recorder.Code)
+				}
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
+
+func TestVerifyRefusesInvalidPublicKeys(t *testing.T) {
+	p256Key, _ := ecdh.P256().GenerateKey(rand.Reader)
+	p384Key, _ := ecdh.P384().GenerateKey(rand.Reader)
+	offCurve := p256Key.PublicKey().Bytes()
+	offCurve[len(offCurve)-1] ^= 0x01
+
+	tests := []struct {
+		name      string
+		publicKey string
+		suites    string
+	}{
+		{"short", "04ab", ""},
+		{"odd length hex", hex.EncodeToString(p256Key.PublicKey().Bytes())[1:], ""},
+		{"off-curve point", hex.EncodeToString(offCurve), ""},
+		{"P-384 key for P-256", hex.EncodeToString(p384Key.PublicKey().Bytes()), ""},
+		{"all-zero X25519", strings.Repeat("00", 32), "X25519+HMAC-SHA256"},
+		{"low order X25519", "e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800", "X25519+HMAC-SHA256"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/fn/verify", strings.NewReader(functionJSON("invalid-key")))
+			req.Header.Set(constants.InvokerPublicKeyHeader, test.publicKey)
+			if test.suites != "" {
+				req.Header.Set(constants.InvokerSuitesHeader, test.suites)
+			}
+			recorder := httptest.NewRecorder()
+			testRouter.Router.ServeHTTP(recorder, req)
+
+			var response struct {
+				ErrorCode string `json:"error_code"`
+			}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			if recorder.Code != http.StatusBadRequest || response.ErrorCode != constants.ErrCodeInvalidPublicKey {
+				t.Fatalf("expected 400 with %s, found %d %s", constants.ErrCodeInvalidPublicKey, recorder.Code, response.ErrorCode)
+			}
+		})
+	}
+}
+
+// hexField decodes the hex encoded field of a response
+func hexField(t *testing.T, name string, value string) []byte {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatalf("%s is not hex encoded: %v", name, err)
+	}
+	return decoded
+}
+
+func TestQuoteAttestsMerkleRoot(t *testing.T) {
+	if code, _ := request(http.MethodPost, "/fn/create", functionJSON("quoted")); code != http.StatusCreated {
+		t.Fatalf("create responded with %d", code)
+	}
+	nonce := "6e6f6e6365"
+	recorder := httptest.NewRecorder()
+	testRouter.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/attest/quote?nonce="+nonce, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /attest/quote, found %d %s", recorder.Code, recorder.Body.String())
+	}
+	var response commonTypes.QuoteResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	quote := hexField(t, "quote", response.Quote)
+
+	// the quote is signed by the attestation key of the response
+	akPublicKey, err := x509.ParsePKIXPublicKey(hexField(t, "ak_public_key", response.AKPublicKey))
+	if err != nil {
+		t.Fatalf("failed to parse the attestation key: %v", err)
+	}
+	signature, err := tpm2.DecodeSignature(bytes.NewBuffer(hexField(t, "signature", response.Signature)))
+	if err != nil || signature.ECC == nil {
+		t.Fatalf("expected an ECDSA signature, found %v", err)
+	}
+	signatureHash, _ := signature.ECC.HashAlg.Hash()
+	h := signatureHash.New()
+	h.Write(quote)
+	if !ecdsa.Verify(akPublicKey.(*ecdsa.PublicKey), h.Sum(nil), signature.ECC.R, signature.ECC.S) {
+		t.Fatal("expected the quote to be signed by the attestation key")
+	}
+
+	// the quote is of the nonce and of PCR 23 holding the value of the response
+	attestation, err := tpm2.DecodeAttestationData(quote)
+	if err != nil || attestation.AttestedQuoteInfo == nil {
+		t.Fatalf("expected a quote, found %v", err)
+	}
+	if hex.EncodeToString(attestation.ExtraData) != nonce {
+		t.Fatalf("expected the quote of the nonce %s, found %x", nonce, attestation.ExtraData)
+	}
+	if pcrs := attestation.AttestedQuoteInfo.PCRSelection.PCRs; len(pcrs) != 1 || pcrs[0] != 23 || response.PCRIndex != 23 {
+		t.Fatalf("expected a quote of PCR 23, found %v", pcrs)
+	}
+	pcrValue := hexField(t, "pcr_value", response.PCRValue)
+	h.Reset()
+	h.Write(pcrValue)
+	if !bytes.Equal(attestation.AttestedQuoteInfo.PCRDigest, h.Sum(nil)) {
+		t.Fatal("expected the quoted PCR digest to be the digest of the PCR value")
+	}
+
+	// the PCR holds the anchored merkle root, which is the active root
+	merkleRoot := hexField(t, "merkle_root", response.MerkleRoot)
+	if !bytes.Equal(merkleRoot, treeManager.Snapshot().GetMerkleRoot()) {
+		t.Fatal("expected the merkle root of the response to be the active root")
+	}
+	bankHash, err := attestation.AttestedQuoteInfo.PCRSelection.Hash.Hash()
+	if err != nil {
+		t.Fatalf("unsupported PCR bank: %v", err)
+	}
+	h = bankHash.New()
+	h.Write(make([]byte, bankHash.Size()))
+	h.Write(merkleRoot)
+	if !bytes.Equal(pcrValue, h.Sum(nil)) {
+		t.Fatalf("expected the PCR to hold the merkle root, found %x", pcrValue)
+	}
+
+	if code, _ := request(http.MethodGet, "/attest/quote?nonce=xyz", ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a nonce that is not hex encoded, found %d", code)
+	}
+}
+
+// tokenReviewer authenticates the bearer tokens naming a principal as that principal
+type tokenReviewer struct{}
+
+func (tokenReviewer) Review(ctx context.Context, token string) (string, error) {
+	return token, nil
+}
+
+// requestAs sends the request to the router with the principal as bearer token, none if it is empty, and returns the status code
+func requestAs(principal string, method string, path string, body string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if principal != "" {
+		req.Header.Set("Authorization", "Bearer "+principal)
+	}
+	recorder := httptest.NewRecorder()
+	testRouter.Router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestRoutesRequireAuthentication(t *testing.T) {
+	testRouter.Authenticator = auth.Chain{&auth.TokenReviewAuthenticator{Reviewer: tokenReviewer{}}}
+	testRouter.initializeRoutes()
+	defer func() {
+		testRouter.Authenticator = nil
+		testRouter.initializeRoutes()
+	}()
+	controller := constants.DefaultMutatePrincipals
+
+	tests := []struct {
+		name      string
+		principal string
+		method    string
+		path      string
+		expected  int
+	}{
+		{"create without credentials", "", http.MethodPost, "/fn/create", http.StatusUnauthorized},
+		{"create of a function", "system:serviceaccount:default:hello", http.MethodPost, "/fn/create", http.StatusForbidden},
+		{"create of the controller", controller, http.MethodPost, "/fn/create", http.StatusCreated},
+		{"namespace delete without credentials", "", http.MethodPost, "/ns/default/fn/delete", http.StatusUnauthorized},
+		{"update of a function", "system:serviceaccount:default:hello", http.MethodPost, "/fn/update", http.StatusForbidden},
+		{"audit log without credentials", "", http.MethodGet, "/audit", http.StatusUnauthorized},
+		{"audit log of an authenticated principal", "auditor", http.MethodGet, "/audit", http.StatusOK},
+		{"verify without credentials", "", http.MethodPost, "/fn/verify", http.StatusOK},
+		{"health without credentials", "", http.MethodGet, "/health", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := requestAs(test.principal, test.method, test.path, functionJSON("authenticated")); code != test.expected {
+				t.Fatalf("expected %d, found %d", test.expected, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server_tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	atomicFile "github.com/TruFaaS/TruFaaS/atomic_file"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// selfSignedValidity is how long a generated self-signed certificate is valid
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// EnsureSelfSigned generates a self-signed ECDSA P-256 certificate for localhost and the host name of the machine
+// into the certificate and key files if the certificate file does not exist, existing files are left unchanged
+func EnsureSelfSigned(certFile string, keyFile string) error {
+	if _, err := os.Stat(certFile); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	dnsNames := []string{"localhost"}
+	if hostName, err := os.Hostname(); err == nil && hostName != "localhost" {
+		dnsNames = append(dnsNames, hostName)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "trufaas-self-signed"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// the key is written first, so that a certificate file always has its key
+	if err = atomicFile.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err = atomicFile.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644); err != nil {
+		return err
+	}
+	fingerprint := sha256.Sum256(certDER)
+	fmt.Printf("Generated self-signed TLS certificate %s for %v, SHA-256 fingerprint %x\n", certFile, dnsNames, fingerprint)
+	return nil
+}
@@ -0,0 +1,185 @@
+package server_tls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mode represents how the API is served
+type Mode string
+
+// Supported TLS modes
+const (
+	ModeOff        Mode = "off"         // ModeOff serves plain HTTP
+	ModeOn         Mode = "on"          // ModeOn serves HTTPS with the configured certificate and key files
+	ModeSelfSigned Mode = "self-signed" // ModeSelfSigned generates a self-signed certificate and key if the files do not exist, for development
+)
+
+// ClientAuth represents whether client certificates are required when a client CA bundle is configured
+type ClientAuth string
+
+// Supported client certificate policies
+const (
+	ClientAuthOptional ClientAuth = "optional" // ClientAuthOptional verifies client certificates if clients send one
+	ClientAuthRequire  ClientAuth = "require"  // ClientAuthRequire refuses connections without a valid client certificate
+)
+
+// DefaultCertFile and DefaultKeyFile are the files of the self-signed certificate and key when none are configured
+const (
+	DefaultCertFile = "tls.crt"
+	DefaultKeyFile  = "tls.key"
+)
+
+// ReloadInterval is how often the certificate, key and client CA files are checked for changes
+const ReloadInterval = 10 * time.Second
+
+// ParseMode returns the TLS mode with the given name, an empty name returns ModeOff
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeOn, ModeSelfSigned:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported TLS mode %q", name)
+	}
+}
+
+// ParseClientAuth returns the client certificate policy with the given name, an empty name returns ClientAuthOptional
+func ParseClientAuth(name string) (ClientAuth, error) {
+	switch clientAuth := ClientAuth(name); clientAuth {
+	case "":
+		return ClientAuthOptional, nil
+	case ClientAuthOptional, ClientAuthRequire:
+		return clientAuth, nil
+	default:
+		return "", fmt.Errorf("unsupported TLS client authentication %q", name)
+	}
+}
+
+// Reloader serves the certificate, key and client CA bundle of the files, which are loaded again when they change,
+// so that rotated certificates are used for new connections without restarting the component
+type Reloader struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // ClientCAFile is the PEM bundle client certificates are verified against, mutual TLS is disabled if empty
+	ClientAuth   ClientAuth
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	loaded      []byte // loaded is the content of the files the certificate and client CAs were loaded from
+}
+
+// NewReloader loads the certificate, key and client CA bundle of the files
+func NewReloader(certFile string, keyFile string, clientCAFile string, clientAuth ClientAuth) (*Reloader, error) {
+	reloader := &Reloader{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile, ClientAuth: clientAuth}
+	if _, err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload loads the files again if their content changed and returns whether they were loaded,
+// the previous certificate and client CAs are kept if the new files are not valid
+func (reloader *Reloader) Reload() (bool, error) {
+	content, err := reloader.readFiles()
+	if err != nil {
+		return false, err
+	}
+	reloader.mutex.RLock()
+	unchanged := bytes.Equal(content, reloader.loaded)
+	reloader.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.CertFile, reloader.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if reloader.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(reloader.ClientCAFile)
+		if err != nil {
+			return false, err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return false, fmt.Errorf("no certificates found in %s", reloader.ClientCAFile)
+		}
+	}
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.certificate, reloader.clientCAs, reloader.loaded = &certificate, clientCAs, content
+	return true, nil
+}
+
+// readFiles returns the concatenated content of the certificate, key and client CA files
+func (reloader *Reloader) readFiles() ([]byte, error) {
+	var content []byte
+	for _, fileName := range []string{reloader.CertFile, reloader.KeyFile, reloader.ClientCAFile} {
+		if fileName == "" {
+			continue
+		}
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, data...)
+	}
+	return content, nil
+}
+
+// Watch reloads the files every interval until stop is closed, a failed reload keeps the loaded files in use
+func (reloader *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := reloader.Reload()
+			if err != nil {
+				fmt.Println("Failed to reload TLS certificate, keeping the loaded one:", err)
+			} else if reloaded {
+				fmt.Println("TLS certificate reloaded from", reloader.CertFile)
+			}
+		}
+	}
+}
+
+// TLSConfig returns the server TLS configuration, every handshake uses the certificate and client CAs loaded last.
+// The configuration of a handshake is a clone of the returned one, so that it keeps the application protocols and
+// session ticket keys of the server
+func (reloader *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the protocols the server adds are set in advance, as it adds them to a copy the handshakes do not see
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		reloader.mutex.RLock()
+		defer reloader.mutex.RUnlock()
+
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*reloader.certificate}
+		if reloader.clientCAs != nil {
+			config.ClientCAs = reloader.clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			if reloader.ClientAuth == ClientAuthRequire {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		return config, nil
+	}
+	return base
+}
@@ -0,0 +1,250 @@
+package server_tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate is a generated certificate with its key
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newCertificate generates a certificate with the common name, signed by the issuer or self-signed as a CA if it is nil
+func newCertificate(t *testing.T, commonName string, issuer *testCertificate, usage x509.ExtKeyUsage) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		t.Fatalf("failed to generate serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	parent, signer := template, key
+	if issuer == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	} else {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCertificate{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// keyPEM returns the PEM encoded key of the certificate
+func (c *testCertificate) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// tlsCertificate returns the certificate and key for a TLS client
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// writeFile writes the data to the file in the directory and returns its path
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	fileName := filepath.Join(dir, name)
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return fileName
+}
+
+// testPKI holds a CA with a server certificate and a client certificate it signed, written to files of a directory
+type testPKI struct {
+	dir      string
+	ca       *testCertificate
+	server   *testCertificate
+	client   *testCertificate
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	pki := &testPKI{dir: t.TempDir()}
+	pki.ca = newCertificate(t, "test-ca", nil, 0)
+	pki.server = newCertificate(t, "server-1", pki.ca, x509.ExtKeyUsageServerAuth)
+	pki.client = newCertificate(t, "controller", pki.ca, x509.ExtKeyUsageClientAuth)
+	pki.certFile = writeFile(t, pki.dir, "tls.crt", pki.server.pem)
+	pki.keyFile = writeFile(t, pki.dir, "tls.key", pki.server.keyPEM(t))
+	pki.caFile = writeFile(t, pki.dir, "ca.crt", pki.ca.pem)
+	return pki
+}
+
+// serve serves a handler responding with the common name of the verified client certificate over TLS with the
+// configuration of the reloader, and returns the URL of the server
+func serve(t *testing.T, reloader *Reloader) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+			if len(req.TLS.VerifiedChains) > 0 {
+				respWriter.Header().Set("X-Client", req.TLS.VerifiedChains[0][0].Subject.CommonName)
+			}
+		}),
+		TLSConfig: reloader.TLSConfig(),
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// newClient returns an HTTP client trusting the CA, presenting the client certificate if it is not nil. Every request
+// opens a new connection, which resumes the session of the previous one if the server allows it
+func newClient(ca *testCertificate, client *testCertificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots, ClientSessionCache: tls.NewLRUClientSessionCache(4)}
+	if client != nil {
+		// the certificate is sent even if it is not issued by a CA the server asks for
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate := client.tlsCertificate()
+			return &certificate, nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true, DisableKeepAlives: true}}
+}
+
+// get sends a request to the server and returns the response, the body is closed
+func get(client *http.Client, url string) (*http.Response, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func TestTLSNegotiatesHTTP2AndResumesSessions(t *testing.T) {
+	pki := newTestPKI(t)
+	reloader, err := NewReloader(pki.certFile, pki.keyFile, "", ClientAuthOptional)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	url := serve(t, reloader)
+	client := newClient(pki.ca, nil)
+
+	resp, err := get(client, url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.ProtoMajor != 2 || resp.TLS.NegotiatedProtocol != "h2" {
+		t.Fatalf("expected HTTP/2 to be negotiated, found %s %q", resp.Proto, resp.TLS.NegotiatedProtocol)
+	}
+	if resp.TLS.PeerCertificates[0].Subject.CommonName != "server-1" {
+		t.Fatalf("unexpected server certificate %s", resp.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+	// the session ticket of the first connection is accepted by the configuration of the next handshake
+	if resp, err = get(client, url); err != nil || !resp.TLS.DidResume {
+		t.Fatalf("second connection did not resume the session: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newCertificate(t, "other-ca", nil, 0)
+	untrusted := newCertificate(t, "controller", other, x509.ExtKeyUsageClientAuth)
+
+	for _, clientAuth := range []ClientAuth{ClientAuthOptional, ClientAuthRequire} {
+		t.Run(string(clientAuth), func(t *testing.T) {
+			reloader, err := NewReloader(pki.certFile, pki.keyFile, pki.caFile, clientAuth)
+			if err != nil {
+				t.Fatalf("failed to load certificate: %v", err)
+			}
+			url := serve(t, reloader)
+
+			resp, err := get(newClient(pki.ca, pki.client), url)
+			if err != nil || resp.Header.Get("X-Client") != "controller" {
+				t.Fatalf("client certificate was not verified: %v", err)
+			}
+			if _, err = get(newClient(pki.ca, untrusted), url); err == nil {
+				t.Fatalf("client certificate of another CA was accepted")
+			}
+			resp, err = get(newClient(pki.ca, nil), url)
+			if clientAuth == ClientAuthRequire && err == nil {
+				t.Fatalf("client without a certificate was accepted")
+			}
+			if clientAuth == ClientAuthOptional && (err != nil || resp.Header.Get("X-Client") != "") {
+				t.Fatalf("client without a certificate was refused: %v", err)
+			}
+		})
+	}
+}
+
+func TestReloadRotatesCertificateAndClientCAs(t *testing.T) {
+	pki := newTestPKI(t)
+	reloader, err := NewReloader(pki.certFile, pki.keyFile, pki.caFile, ClientAuthRequire)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	url := serve(t, reloader)
+	if reloaded, err := reloader.Reload(); reloaded || err != nil {
+		t.Fatalf("unchanged files were reloaded: %v", err)
+	}
+
+	// a new CA signs the rotated server certificate and the client certificates
+	rotatedCA := newCertificate(t, "rotated-ca", nil, 0)
+	rotatedServer := newCertificate(t, "server-2", rotatedCA, x509.ExtKeyUsageServerAuth)
+	rotatedClient := newCertificate(t, "controller", rotatedCA, x509.ExtKeyUsageClientAuth)
+	writeFile(t, pki.dir, "tls.crt", rotatedServer.pem)
+	writeFile(t, pki.dir, "tls.key", rotatedServer.keyPEM(t))
+	writeFile(t, pki.dir, "ca.crt", rotatedCA.pem)
+	if reloaded, err := reloader.Reload(); !reloaded || err != nil {
+		t.Fatalf("rotated files were not reloaded: %v", err)
+	}
+
+	resp, err := get(newClient(rotatedCA, rotatedClient), url)
+	if err != nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "server-2" || resp.ProtoMajor != 2 {
+		t.Fatalf("rotated certificate is not served: %v", err)
+	}
+	if _, err = get(newClient(rotatedCA, pki.client), url); err == nil {
+		t.Fatalf("client certificate of the replaced CA was accepted")
+	}
+
+	// a key that does not match the certificate is refused and the loaded certificate stays in use
+	writeFile(t, pki.dir, "tls.key", pki.server.keyPEM(t))
+	if _, err = reloader.Reload(); err == nil {
+		t.Fatalf("mismatched certificate and key were loaded")
+	}
+	if resp, err = get(newClient(rotatedCA, rotatedClient), url); err != nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "server-2" {
+		t.Fatalf("loaded certificate not kept after a failed reload: %v", err)
+	}
+}
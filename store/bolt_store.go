@@ -0,0 +1,92 @@
+package store
+
+import (
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// boltBucket is the bucket holding all entries of the bolt store
+var boltBucket = []byte("trufaas")
+
+// keys of the entries in the bolt and etcd stores
+const (
+	treeKey         = "tree"
+	previousTreeKey = "tree.prev"
+	checkpointKey   = "checkpoint"
+)
+
+// BoltStore stores the tree and checkpoint in an embedded bbolt database, every write is a synced transaction
+type BoltStore struct {
+	Path string // Path is the database file
+	db   *bolt.DB
+}
+
+// NewBoltStore opens the database file, which is created if it does not exist
+func NewBoltStore(path string) (*BoltStore, error) {
+	// the file is locked by the process holding it open, a second process fails instead of blocking
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{Path: path, db: db}, nil
+}
+
+func (s *BoltStore) StoreTree(data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		// the value is only valid during the transaction, put copies it
+		if previous := bucket.Get([]byte(treeKey)); previous != nil {
+			if err := bucket.Put([]byte(previousTreeKey), previous); err != nil {
+				return err
+			}
+		}
+		return bucket.Put([]byte(treeKey), data)
+	})
+}
+
+func (s *BoltStore) LoadTree() ([]byte, error) {
+	return s.get(treeKey)
+}
+
+func (s *BoltStore) LoadPreviousTree() ([]byte, error) {
+	return s.get(previousTreeKey)
+}
+
+func (s *BoltStore) StoreCheckpoint(data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(checkpointKey), data)
+	})
+}
+
+func (s *BoltStore) LoadCheckpoint() ([]byte, error) {
+	return s.get(checkpointKey)
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Name() string {
+	return "bolt store in " + s.Path
+}
+
+func (s *BoltStore) get(key string) ([]byte, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBucket).Get([]byte(key))
+		if value == nil {
+			return ErrNotFound
+		}
+		data = append([]byte(nil), value...)
+		return nil
+	})
+	return data, err
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etcdTimeout bounds every request to the etcd cluster
+const etcdTimeout = 5 * time.Second
+
+// ErrConcurrentModification is returned when the tree in etcd was replaced by another writer since it was loaded
+var ErrConcurrentModification = errors.New("stored tree was modified concurrently")
+
+// EtcdStore stores the tree and checkpoint under a key prefix in an etcd cluster. Replicas using the same prefix share
+// the tree, a replica only replaces the tree it loaded or stored last, so that no replica overwrites the tree of another
+type EtcdStore struct {
+	Endpoints []string // Endpoints are the client URLs of the cluster
+	Prefix    string   // Prefix is prepended to the keys of all entries
+	client    *clientv3.Client
+
+	mutex    sync.Mutex
+	revision int64  // revision is the modification revision of the tree loaded or stored last, 0 if there was none
+	tree     []byte // tree is the tree loaded or stored last, it becomes the previous tree when it is replaced
+
+	checkpointRevision int64 // checkpointRevision is the revision of the checkpoint stored last, 0 if there was none
+}
+
+// NewEtcdStore connects to the etcd cluster
+func NewEtcdStore(endpoints []string, prefix string) (*EtcdStore, error) {
+	client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: etcdTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStore{Endpoints: endpoints, Prefix: prefix, client: client}, nil
+}
+
+// StoreTree replaces the tree loaded or stored last, ErrConcurrentModification is returned if another writer replaced
+// it in between, in which case the tree has to be loaded again
+func (s *EtcdStore) StoreTree(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	// the previous tree is only replaced together with the tree, and only if the tree was not replaced since
+	// it was loaded, a revision of 0 requires that there is no tree
+	compare := clientv3.Compare(clientv3.ModRevision(s.key(treeKey)), "=", s.revision)
+	var ops []clientv3.Op
+	if s.tree != nil {
+		ops = append(ops, clientv3.OpPut(s.key(previousTreeKey), string(s.tree)))
+	}
+	ops = append(ops, clientv3.OpPut(s.key(treeKey), string(data)))
+
+	resp, err := s.client.Txn(ctx).If(compare).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrConcurrentModification
+	}
+	s.revision, s.tree = resp.Header.Revision, data
+	return nil
+}
+
+// LoadTree returns the stored tree, which is the tree the next StoreTree replaces
+func (s *EtcdStore) LoadTree() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.key(treeKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		s.revision, s.tree = 0, nil
+		return nil, ErrNotFound
+	}
+	s.revision, s.tree = resp.Kvs[0].ModRevision, resp.Kvs[0].Value
+	return resp.Kvs[0].Value, nil
+}
+
+func (s *EtcdStore) LoadPreviousTree() ([]byte, error) {
+	return s.get(previousTreeKey)
+}
+
+func (s *EtcdStore) StoreCheckpoint(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	// the revision is tracked before the watch may look it up for the event of this put
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resp, err := s.client.Put(ctx, s.key(checkpointKey), string(data))
+	if err != nil {
+		return err
+	}
+	s.checkpointRevision = resp.Header.Revision
+	return nil
+}
+
+func (s *EtcdStore) LoadCheckpoint() ([]byte, error) {
+	return s.get(checkpointKey)
+}
+
+// WatchCheckpoint calls changed whenever another replica stores a checkpoint under the prefix, the checkpoint is
+// stored after the tree it signs so the tree is complete when changed is called
+func (s *EtcdStore) WatchCheckpoint(ctx context.Context, changed func()) {
+	for interrupted := false; ctx.Err() == nil; interrupted = true {
+		if interrupted {
+			// the watch was canceled, e.g. as the revision was compacted, changes in between are not reported
+			changed()
+		}
+		for resp := range s.client.Watch(clientv3.WithRequireLeader(ctx), s.key(checkpointKey)) {
+			if err := resp.Err(); err != nil {
+				fmt.Println("Watch of", s.Name(), "interrupted:", err)
+				break
+			}
+			for _, event := range resp.Events {
+				if event.Type == clientv3.EventTypePut && event.Kv.ModRevision != s.storedCheckpointRevision() {
+					changed()
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// storedCheckpointRevision returns the revision of the checkpoint stored last by this store
+func (s *EtcdStore) storedCheckpointRevision() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.checkpointRevision
+}
+
+func (s *EtcdStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *EtcdStore) Name() string {
+	return "etcd store at " + strings.Join(s.Endpoints, ",") + " under " + s.Prefix
+}
+
+func (s *EtcdStore) key(name string) string {
+	return s.Prefix + name
+}
+
+func (s *EtcdStore) get(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.key(name))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return resp.Kvs[0].Value, nil
+}
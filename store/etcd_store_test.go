@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.etcd.io/etcd/server/v3/embed"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// freeURL returns a URL of a local port that is free to listen on
+func freeURL(t *testing.T) url.URL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// startEtcd starts an embedded single member etcd cluster and returns its client URL
+func startEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start etcd: %v", err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatalf("etcd did not start")
+	}
+	return clientURL.String()
+}
+
+// newEtcdStore connects a store to the cluster under the prefix
+func newEtcdStore(t *testing.T, endpoint string, prefix string) *EtcdStore {
+	s, err := NewEtcdStore([]string{endpoint}, prefix)
+	if err != nil {
+		t.Fatalf("failed to connect to etcd: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// assertLoaded checks that load returns the expected data
+func assertLoaded(t *testing.T, name string, load func() ([]byte, error), expected string) {
+	data, err := load()
+	if err != nil || !bytes.Equal(data, []byte(expected)) {
+		t.Fatalf("%s: expected %q, found %q (%v)", name, expected, data, err)
+	}
+}
+
+func TestEtcdStoreKeepsPreviousTree(t *testing.T) {
+	s := newEtcdStore(t, startEtcd(t), "/test/")
+
+	if _, err := s.LoadTree(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a new store, found %v", err)
+	}
+	if _, err := s.LoadCheckpoint(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a new store, found %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := s.StoreTree([]byte(fmt.Sprintf("tree-%d", i))); err != nil {
+			t.Fatalf("store of tree-%d failed: %v", i, err)
+		}
+	}
+	assertLoaded(t, "tree", s.LoadTree, "tree-3")
+	assertLoaded(t, "previous tree", s.LoadPreviousTree, "tree-2")
+
+	if err := s.StoreCheckpoint([]byte("checkpoint")); err != nil {
+		t.Fatalf("store of checkpoint failed: %v", err)
+	}
+	assertLoaded(t, "checkpoint", s.LoadCheckpoint, "checkpoint")
+}
+
+func TestEtcdStoreRefusesTreeReplacedByAnotherReplica(t *testing.T) {
+	endpoint := startEtcd(t)
+	first, second := newEtcdStore(t, endpoint, "/shared/"), newEtcdStore(t, endpoint, "/shared/")
+
+	// both replicas start without a tree
+	first.LoadTree()
+	second.LoadTree()
+	if err := first.StoreTree([]byte("first-1")); err != nil {
+		t.Fatalf("store of the first replica failed: %v", err)
+	}
+	if err := second.StoreTree([]byte("second-1")); !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("expected ErrConcurrentModification for a tree created by another replica, found %v", err)
+	}
+
+	// once loaded again, the tree of the other replica is replaced and kept as the previous tree
+	assertLoaded(t, "reloaded tree", second.LoadTree, "first-1")
+	if err := second.StoreTree([]byte("second-1")); err != nil {
+		t.Fatalf("store after reloading failed: %v", err)
+	}
+	assertLoaded(t, "previous tree", second.LoadPreviousTree, "first-1")
+
+	// the first replica did not load the tree of the second one
+	if err := first.StoreTree([]byte("first-2")); !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("expected ErrConcurrentModification for a tree replaced by another replica, found %v", err)
+	}
+	assertLoaded(t, "tree", first.LoadTree, "second-1")
+
+	// a replica using another prefix does not share the tree
+	other := newEtcdStore(t, endpoint, "/other/")
+	if err := other.StoreTree([]byte("other-1")); err != nil {
+		t.Fatalf("store under another prefix failed: %v", err)
+	}
+}
+
+func TestEtcdStoreWatchesCheckpointsOfOtherReplicas(t *testing.T) {
+	endpoint := startEtcd(t)
+	first, second := newEtcdStore(t, endpoint, "/shared/"), newEtcdStore(t, endpoint, "/shared/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go first.WatchCheckpoint(ctx, func() { changed <- struct{}{} })
+	// the watch is established asynchronously, the checkpoint of the first replica must not be reported
+	time.Sleep(200 * time.Millisecond)
+
+	if err := first.StoreCheckpoint([]byte("first")); err != nil {
+		t.Fatalf("store of the first replica failed: %v", err)
+	}
+	if err := second.StoreCheckpoint([]byte("second")); err != nil {
+		t.Fatalf("store of the second replica failed: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("checkpoint stored by another replica was not reported")
+	}
+	select {
+	case <-changed:
+		t.Fatal("checkpoint stored by the watching replica was reported")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
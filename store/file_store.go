@@ -0,0 +1,62 @@
+package store
+
+import (
+	"errors"
+	atomicFile "github.com/TruFaaS/TruFaaS/atomic_file"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"os"
+	"path/filepath"
+)
+
+// FileStore stores the tree and checkpoint as files in a directory
+type FileStore struct {
+	Dir string // Dir is the directory holding the files
+}
+
+// NewFileStore returns the file store of the directory, which is created if it does not exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) StoreTree(data []byte) error {
+	return atomicFile.WriteFileKeepingPrevious(s.path(constants.TreeStoreFileName), s.path(constants.PreviousTreeStoreFileName), data, 0644)
+}
+
+func (s *FileStore) LoadTree() ([]byte, error) {
+	return s.read(constants.TreeStoreFileName)
+}
+
+func (s *FileStore) LoadPreviousTree() ([]byte, error) {
+	return s.read(constants.PreviousTreeStoreFileName)
+}
+
+func (s *FileStore) StoreCheckpoint(data []byte) error {
+	return atomicFile.WriteFile(s.path(constants.CheckpointFileName), data, 0644)
+}
+
+func (s *FileStore) LoadCheckpoint() ([]byte, error) {
+	return s.read(constants.CheckpointFileName)
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) Name() string {
+	return "file store in " + s.Dir
+}
+
+func (s *FileStore) path(fileName string) string {
+	return filepath.Join(s.Dir, fileName)
+}
+
+func (s *FileStore) read(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(fileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when nothing is stored under the requested entry
+var ErrNotFound = errors.New("not found in tree store")
+
+// TreeStore represents where the encoded merkle tree, the tree it replaced and the signed checkpoint are persisted
+type TreeStore interface {
+	// StoreTree replaces the stored tree atomically, the replaced tree is kept as the previous tree. A store shared
+	// between replicas returns ErrConcurrentModification if another replica replaced the tree since it was loaded
+	StoreTree(data []byte) error
+	// LoadTree returns the stored tree, ErrNotFound is returned if there is none
+	LoadTree() ([]byte, error)
+	// LoadPreviousTree returns the tree replaced by the last StoreTree, ErrNotFound is returned if there is none
+	LoadPreviousTree() ([]byte, error)
+	// StoreCheckpoint replaces the stored checkpoint atomically
+	StoreCheckpoint(data []byte) error
+	// LoadCheckpoint returns the stored checkpoint, ErrNotFound is returned if there is none
+	LoadCheckpoint() ([]byte, error)
+	// Close releases the resources of the store
+	Close() error
+	// Name returns a short description of the store for logs
+	Name() string
+}
+
+// TreeWatcher is implemented by stores shared between replicas, it reports trees stored by other replicas
+type TreeWatcher interface {
+	// WatchCheckpoint calls changed whenever another writer replaces the checkpoint, which is stored after the tree it
+	// signs, until the context is done. It is called once as well after the watch was interrupted, as a change may
+	// have been missed in between
+	WatchCheckpoint(ctx context.Context, changed func())
+}
+
+// BackendType represents the kind of store to use
+type BackendType string
+
+// Supported backend types
+const (
+	FileBackendType BackendType = "file" // Files in a local directory
+	BoltBackendType BackendType = "bolt" // Embedded bbolt key-value database file
+	EtcdBackendType BackendType = "etcd" // etcd cluster, shared by all replicas using the same prefix
+)
+
+// DefaultFileDirectory is the directory of the file backend used when none is configured
+const DefaultFileDirectory = "."
+
+// DefaultBoltPath is the database file of the bolt backend used when none is configured
+const DefaultBoltPath = "trufaas.db"
+
+// DefaultEtcdEndpoint is the etcd endpoint used when none is configured
+const DefaultEtcdEndpoint = "localhost:2379"
+
+// DefaultEtcdPrefix is the prefix of the etcd keys used when none is configured
+const DefaultEtcdPrefix = "/trufaas/"
+
+// ParseBackendType returns the backend type with the given name, an empty name returns the file backend
+func ParseBackendType(name string) (BackendType, error) {
+	switch backendType := BackendType(name); backendType {
+	case "":
+		return FileBackendType, nil
+	case FileBackendType, BoltBackendType, EtcdBackendType:
+		return backendType, nil
+	default:
+		return "", fmt.Errorf("unsupported store backend %q", name)
+	}
+}
+
+// NewTreeStore opens the store of the given type, the path is the directory of the file backend and the database
+// file of the bolt backend, the endpoints and prefix are only used by the etcd backend
+func NewTreeStore(backendType BackendType, path string, endpoints []string, prefix string) (TreeStore, error) {
+	switch backendType {
+	case FileBackendType:
+		if path == "" {
+			path = DefaultFileDirectory
+		}
+		return NewFileStore(path)
+	case BoltBackendType:
+		if path == "" {
+			path = DefaultBoltPath
+		}
+		return NewBoltStore(path)
+	case EtcdBackendType:
+		if len(endpoints) == 0 {
+			endpoints = []string{DefaultEtcdEndpoint}
+		}
+		if prefix == "" {
+			prefix = DefaultEtcdPrefix
+		}
+		return NewEtcdStore(endpoints, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported store backend %q", backendType)
+	}
+}
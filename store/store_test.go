@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// localStores returns a new store of each backend that is not shared between replicas
+func localStores(t *testing.T) map[string]TreeStore {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "trufaas.db"))
+	if err != nil {
+		t.Fatalf("failed to create bolt store: %v", err)
+	}
+	t.Cleanup(func() { boltStore.Close() })
+	return map[string]TreeStore{"file": fileStore, "bolt": boltStore}
+}
+
+func TestLocalStoresKeepPreviousTree(t *testing.T) {
+	for name, s := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.LoadTree(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound for a new store, found %v", err)
+			}
+			if _, err := s.LoadPreviousTree(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound for a new store, found %v", err)
+			}
+			if _, err := s.LoadCheckpoint(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound for a new store, found %v", err)
+			}
+
+			if err := s.StoreTree([]byte("tree-1")); err != nil {
+				t.Fatalf("store of tree-1 failed: %v", err)
+			}
+			assertLoaded(t, "tree", s.LoadTree, "tree-1")
+			if _, err := s.LoadPreviousTree(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound before the first tree is replaced, found %v", err)
+			}
+			for i := 2; i <= 3; i++ {
+				if err := s.StoreTree([]byte(fmt.Sprintf("tree-%d", i))); err != nil {
+					t.Fatalf("store of tree-%d failed: %v", i, err)
+				}
+			}
+			assertLoaded(t, "tree", s.LoadTree, "tree-3")
+			assertLoaded(t, "previous tree", s.LoadPreviousTree, "tree-2")
+
+			for _, checkpoint := range []string{"checkpoint-1", "checkpoint-2"} {
+				if err := s.StoreCheckpoint([]byte(checkpoint)); err != nil {
+					t.Fatalf("store of %s failed: %v", checkpoint, err)
+				}
+			}
+			assertLoaded(t, "checkpoint", s.LoadCheckpoint, "checkpoint-2")
+			// the checkpoint does not replace the previous tree
+			assertLoaded(t, "previous tree", s.LoadPreviousTree, "tree-2")
+		})
+	}
+}
+
+func TestLocalStoresNeverReportConcurrentModification(t *testing.T) {
+	for name, s := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// local stores have a single writer, concurrent stores are serialized instead of refused
+			var wg sync.WaitGroup
+			errs := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs <- s.StoreTree([]byte(fmt.Sprintf("tree-%d", i)))
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("concurrent store failed: %v", err)
+				}
+			}
+
+			tree, err := s.LoadTree()
+			if err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			previous, err := s.LoadPreviousTree()
+			if err != nil {
+				t.Fatalf("load of the previous tree failed: %v", err)
+			}
+			var found int
+			for i := 0; i < 10; i++ {
+				if string(tree) == fmt.Sprintf("tree-%d", i) || string(previous) == fmt.Sprintf("tree-%d", i) {
+					found++
+				}
+			}
+			if found != 2 || string(tree) == string(previous) {
+				t.Fatalf("expected two distinct stored trees, found %q and %q", tree, previous)
+			}
+		})
+	}
+}
+
+func TestBoltStoreRefusesSecondProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trufaas.db")
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("failed to create bolt store: %v", err)
+	}
+	defer s.Close()
+
+	// the database is locked while it is open, a second writer fails instead of overwriting the tree
+	if second, err := NewBoltStore(path); err == nil {
+		second.Close()
+		t.Fatal("expected the second bolt store of the same file to fail")
+	}
+}
@@ -0,0 +1,74 @@
+package tpm
+
+import (
+	"crypto"
+	"fmt"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/google/go-tpm-tools/client"
+	"github.com/google/go-tpm/tpm2"
+	"io"
+)
+
+// MaxQuoteNonceSize is the largest nonce the TPM accepts as qualifying data of a quote
+const MaxQuoteNonceSize = 64
+
+// attestationKey is the restricted ECC P-256 signing key quoting the PCR, created on first use
+var attestationKey *client.Key
+
+// QuoteResult holds a TPM2_Quote over the merkle root PCR and the attestation key that signed it
+type QuoteResult struct {
+	Quote        []byte           // Quote is the signed TPMS_ATTEST structure
+	Signature    []byte           // Signature is the TPMT_SIGNATURE over the quote
+	PCRIndex     int              // PCRIndex is the index of the quoted PCR
+	PCRBank      tpm2.Algorithm   // PCRBank is the bank of the quoted PCR
+	PCRValue     []byte           // PCRValue is the value of the quoted PCR
+	AKPublicKey  crypto.PublicKey // AKPublicKey is the public key of the attestation key
+	AKPublicArea []byte           // AKPublicArea is the encoded TPMT_PUBLIC of the attestation key
+}
+
+// getAttestationKey returns the attestation key, creating it in the TPM if it does not exist yet
+func getAttestationKey(rw io.ReadWriter) (*client.Key, error) {
+	if attestationKey == nil {
+		ak, err := client.AttestationKeyECC(rw)
+		if err != nil {
+			return nil, err
+		}
+		attestationKey = ak
+	}
+	return attestationKey, nil
+}
+
+// Quote returns a quote over the merkle root PCR in the bank of the hash algorithm, qualified by the nonce
+func Quote(rw io.ReadWriter, nonce []byte, algorithm merkleTree.HashAlgorithm) (*QuoteResult, error) {
+	if len(nonce) == 0 || len(nonce) > MaxQuoteNonceSize {
+		return nil, fmt.Errorf("nonce must be between 1 and %d bytes", MaxQuoteNonceSize)
+	}
+
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	ak, err := getAttestationKey(rw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attestation key: %w", dropIfBroken(rw, err))
+	}
+
+	bank := pcrBank(algorithm)
+	quote, err := ak.Quote(tpm2.PCRSelection{Hash: bank, PCRs: []int{pcrIndex}}, nonce)
+	if err != nil {
+		return nil, dropIfBroken(rw, err)
+	}
+	akPublicArea, err := ak.PublicArea().Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuoteResult{
+		Quote:        quote.GetQuote(),
+		Signature:    quote.GetRawSig(),
+		PCRIndex:     pcrIndex,
+		PCRBank:      bank,
+		PCRValue:     quote.GetPcrs().GetPcrs()[uint32(pcrIndex)],
+		AKPublicKey:  ak.PublicKey(),
+		AKPublicArea: akPublicArea,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package tpm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/google/go-tpm/tpm2"
+	"testing"
+)
+
+// anchoredPCRValue returns the value of the PCR reset and extended with the root in the bank of the hash algorithm
+func anchoredPCRValue(t *testing.T, root []byte, algorithm merkleTree.HashAlgorithm) []byte {
+	bankHash, err := pcrBank(algorithm).Hash()
+	if err != nil {
+		t.Fatalf("no hash function for the %s bank: %v", algorithm, err)
+	}
+	h := bankHash.New()
+	h.Write(make([]byte, bankHash.Size()))
+	h.Write(root)
+	return h.Sum(nil)
+}
+
+// verifyQuote checks the quote as a caller of /attest/quote does, its signature by the attestation key, its nonce
+// and that its PCR digest is the digest of the PCR value
+func verifyQuote(quote *QuoteResult, nonce []byte) bool {
+	signature, err := tpm2.DecodeSignature(bytes.NewBuffer(quote.Signature))
+	if err != nil || signature.ECC == nil {
+		return false
+	}
+	signatureHash, err := signature.ECC.HashAlg.Hash()
+	if err != nil {
+		return false
+	}
+	akPublicKey, ok := quote.AKPublicKey.(*ecdsa.PublicKey)
+	h := signatureHash.New()
+	h.Write(quote.Quote)
+	if !ok || !ecdsa.Verify(akPublicKey, h.Sum(nil), signature.ECC.R, signature.ECC.S) {
+		return false
+	}
+
+	attestation, err := tpm2.DecodeAttestationData(quote.Quote)
+	if err != nil || attestation.Type != tpm2.TagAttestQuote || attestation.AttestedQuoteInfo == nil {
+		return false
+	}
+	selection := attestation.AttestedQuoteInfo.PCRSelection
+	if !bytes.Equal(attestation.ExtraData, nonce) || selection.Hash != quote.PCRBank ||
+		len(selection.PCRs) != 1 || selection.PCRs[0] != quote.PCRIndex {
+		return false
+	}
+	// the PCR digest is the digest of the quoted PCR values with the hash of the signature
+	h.Reset()
+	h.Write(quote.PCRValue)
+	return bytes.Equal(attestation.AttestedQuoteInfo.PCRDigest, h.Sum(nil))
+}
+
+func TestQuoteAttestsAnchoredRoot(t *testing.T) {
+	rw := useSimulator(t)
+	nonce := []byte("quote-nonce")
+
+	for _, algorithm := range merkleTree.HashAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			root := rootOf(algorithm, "root")
+			if err := SaveToTPM(rw, root, algorithm); err != nil {
+				t.Fatalf("failed to anchor the root: %v", err)
+			}
+			quote, err := Quote(rw, nonce, algorithm)
+			if err != nil {
+				t.Fatalf("quote failed: %v", err)
+			}
+			if !verifyQuote(quote, nonce) {
+				t.Fatal("expected the quote to be verified with the attestation key")
+			}
+			if quote.PCRIndex != 23 || quote.PCRBank != pcrBank(algorithm) {
+				t.Fatalf("expected PCR 23 of the %v bank, found PCR %d of %v", pcrBank(algorithm), quote.PCRIndex, quote.PCRBank)
+			}
+			if !bytes.Equal(quote.PCRValue, anchoredPCRValue(t, root, algorithm)) {
+				t.Fatalf("expected the quoted PCR to hold the anchored root, found %x", quote.PCRValue)
+			}
+
+			// the encoded public area is the attestation key
+			public, err := tpm2.DecodePublic(quote.AKPublicArea)
+			if err != nil {
+				t.Fatalf("failed to decode the public area: %v", err)
+			}
+			if key, err := public.Key(); err != nil || !key.(*ecdsa.PublicKey).Equal(quote.AKPublicKey) {
+				t.Fatalf("expected the public area to be the attestation key (%v)", err)
+			}
+		})
+	}
+}
+
+func TestQuoteRefusesTampering(t *testing.T) {
+	rw := useSimulator(t)
+	nonce := []byte("quote-nonce")
+	if err := SaveToTPM(rw, rootOf(merkleTree.SHA256, "root"), merkleTree.SHA256); err != nil {
+		t.Fatalf("failed to anchor the root: %v", err)
+	}
+	quote, err := Quote(rw, nonce, merkleTree.SHA256)
+	if err != nil {
+		t.Fatalf("quote failed: %v", err)
+	}
+
+	if verifyQuote(quote, []byte("other-nonce")) {
+		t.Fatal("expected the quote not to be verified with another nonce")
+	}
+	changedPCR := *quote
+	changedPCR.PCRValue = anchoredPCRValue(t, rootOf(merkleTree.SHA256, "other"), merkleTree.SHA256)
+	if verifyQuote(&changedPCR, nonce) {
+		t.Fatal("expected the quote not to be verified with another PCR value")
+	}
+	changedQuote := *quote
+	changedQuote.Quote = append([]byte{}, quote.Quote...)
+	changedQuote.Quote[len(changedQuote.Quote)-1] ^= 0x01
+	if verifyQuote(&changedQuote, nonce) {
+		t.Fatal("expected a changed quote not to be verified")
+	}
+
+	for _, invalid := range [][]byte{nil, make([]byte, MaxQuoteNonceSize+1)} {
+		if _, err = Quote(rw, invalid, merkleTree.SHA256); err == nil {
+			t.Fatalf("expected a nonce of %d bytes to be refused", len(invalid))
+		}
+	}
+}
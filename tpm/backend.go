@@ -0,0 +1,62 @@
+package tpm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Backend represents a TPM the merkle root is anchored in
+type Backend interface {
+	// Open opens a connection to the TPM, which is ready to receive commands once returned
+	Open() (io.ReadWriteCloser, error)
+	// Name returns a short description of the backend for logs
+	Name() string
+}
+
+// BackendType represents the kind of TPM to use
+type BackendType string
+
+// Supported backend types
+const (
+	SimulatorBackendType BackendType = "simulator" // In-memory go-tpm-tools simulator, state is lost on restart
+	DeviceBackendType    BackendType = "device"    // Hardware or kernel TPM character device
+	SwtpmBackendType     BackendType = "swtpm"     // swtpm listening on a TCP socket
+)
+
+// DefaultDevicePath is the kernel resource manager device of the TPM
+const DefaultDevicePath = "/dev/tpmrm0"
+
+// DefaultSwtpmAddress is the address of the swtpm server socket used when none is configured
+const DefaultSwtpmAddress = "localhost:2321"
+
+// ParseBackendType returns the backend type with the given name, an empty name returns the simulator
+func ParseBackendType(name string) (BackendType, error) {
+	switch backendType := BackendType(name); backendType {
+	case "":
+		return SimulatorBackendType, nil
+	case SimulatorBackendType, DeviceBackendType, SwtpmBackendType:
+		return backendType, nil
+	default:
+		return "", fmt.Errorf("unsupported TPM backend %q", name)
+	}
+}
+
+// NewBackend creates the backend of the given type, the device path and address are only used by their backend
+func NewBackend(backendType BackendType, devicePath string, address string) (Backend, error) {
+	switch backendType {
+	case SimulatorBackendType:
+		return &SimulatorBackend{}, nil
+	case DeviceBackendType:
+		if devicePath == "" {
+			devicePath = DefaultDevicePath
+		}
+		return &DeviceBackend{Path: devicePath}, nil
+	case SwtpmBackendType:
+		if address == "" {
+			address = DefaultSwtpmAddress
+		}
+		return &SwtpmBackend{Address: address}, nil
+	default:
+		return nil, fmt.Errorf("unsupported TPM backend %q", backendType)
+	}
+}
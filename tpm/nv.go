@@ -0,0 +1,67 @@
+package tpm
+
+import (
+	"errors"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"io"
+)
+
+// rootNVIndex is the owner NV index holding the last anchored merkle root, so that the root
+// survives restarts of the component on TPMs that persist their NV storage
+var rootNVIndex = tpmutil.Handle(0x01000023)
+
+// ErrNoNVRoot is returned when no merkle root is stored in the TPM NV storage
+var ErrNoNVRoot = errors.New("no merkle root stored in TPM NV storage")
+
+// storeRootInNV writes the merkle root into the NV index, the index is (re)defined with the size of the root
+func storeRootInNV(rw io.ReadWriter, merkleRoot []byte) error {
+	nvPublic, err := tpm2.NVReadPublic(rw, rootNVIndex)
+	defined := err == nil
+	if err != nil && !isUndefinedHandleError(err) {
+		return err
+	}
+
+	// the size of the index is fixed, a root of a different hash algorithm needs a new index
+	if defined && int(nvPublic.DataSize) != len(merkleRoot) {
+		if err = tpm2.NVUndefineSpace(rw, "", tpm2.HandleOwner, rootNVIndex); err != nil {
+			return err
+		}
+		defined = false
+	}
+
+	// an empty tree has no root, which is stored as an undefined index
+	if len(merkleRoot) == 0 {
+		return nil
+	}
+
+	if !defined {
+		attributes := tpm2.AttrOwnerWrite | tpm2.AttrOwnerRead | tpm2.AttrNoDA
+		err = tpm2.NVDefineSpace(rw, tpm2.HandleOwner, rootNVIndex, "", "", nil, attributes, uint16(len(merkleRoot)))
+		if err != nil {
+			return err
+		}
+	}
+	return tpm2.NVWrite(rw, tpm2.HandleOwner, rootNVIndex, "", merkleRoot, 0)
+}
+
+// ReadRootFromNV returns the merkle root stored in the NV index, ErrNoNVRoot is returned if there is none
+func ReadRootFromNV(rw io.ReadWriter) ([]byte, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	nvPublic, err := tpm2.NVReadPublic(rw, rootNVIndex)
+	if isUndefinedHandleError(err) {
+		return nil, ErrNoNVRoot
+	}
+	if err != nil {
+		return nil, dropIfBroken(rw, err)
+	}
+	root, err := tpm2.NVReadEx(rw, rootNVIndex, tpm2.HandleOwner, "", int(nvPublic.DataSize))
+	return root, dropIfBroken(rw, err)
+}
+
+func isUndefinedHandleError(err error) bool {
+	var handleErr tpm2.HandleError
+	return errors.As(err, &handleErr) && handleErr.Code == tpm2.RCHandle
+}
@@ -0,0 +1,78 @@
+package tpm
+
+import (
+	"crypto"
+	"errors"
+	"github.com/google/go-tpm-tools/client"
+	"github.com/google/go-tpm/tpm2"
+	"io"
+)
+
+// signingKey is the unrestricted ECC P-256 identity key, created on first use
+var signingKey *client.Key
+
+// signingKeyTemplate is the template of the identity key, a primary key of the owner hierarchy, so the TPM derives the
+// same key from its owner seed every time it is created and the private key never leaves the TPM
+func signingKeyTemplate() tpm2.Public {
+	template := client.AKTemplateECC()
+	// the key signs digests computed outside the TPM, which restricted keys refuse
+	template.Attributes = tpm2.FlagSign | tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth
+	return template
+}
+
+// tpmSigner serializes the signatures of the identity key with the other TPM commands, the key is created again
+// if the TPM was opened again after its connection failed
+type tpmSigner struct {
+	public crypto.PublicKey
+}
+
+func (s *tpmSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *tpmSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	rw, err := openInstance()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := currentSigner(rw)
+	if err != nil {
+		return nil, dropIfBroken(rw, err)
+	}
+	// a TPM that lost its owner seed derives another key, whose signatures would not verify
+	if public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !public.Equal(s.public) {
+		return nil, errors.New("signing key resident in the TPM changed")
+	}
+	signature, err := signer.Sign(rand, digest, opts)
+	return signature, dropIfBroken(rw, err)
+}
+
+// currentSigner returns the signer of the identity key, creating the key if it was not created on the connection yet,
+// it must be called with tpmMutex held
+func currentSigner(rw io.ReadWriter) (crypto.Signer, error) {
+	if signingKey == nil {
+		key, err := client.NewKey(rw, tpm2.HandleOwner, signingKeyTemplate())
+		if err != nil {
+			return nil, err
+		}
+		signingKey = key
+	}
+	return signingKey.GetSigner()
+}
+
+// SigningKey returns the ECDSA P-256 identity key resident in the TPM, signatures are ASN.1 encoded like the ones of a
+// key in a file. The key is stable across restarts of a TPM that keeps its owner seed, e.g. a device or swtpm with
+// state, but the simulator creates a new seed, and so a new key, every time it is started
+func SigningKey(rw io.ReadWriter) (crypto.Signer, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	signer, err := currentSigner(rw)
+	if err != nil {
+		return nil, dropIfBroken(rw, err)
+	}
+	return &tpmSigner{public: signer.Public()}, nil
+}
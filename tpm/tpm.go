@@ -0,0 +1,213 @@
+package tpm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+var instance io.ReadWriteCloser
+var backend Backend = &SimulatorBackend{}
+var pcrIndex int = 23
+
+// tpmMutex serializes access to the TPM, commands of concurrent requests must not interleave on the
+// connection and a PCR reset followed by an extension must not be observed halfway
+var tpmMutex sync.Mutex
+
+//var previousPCRValue []byte
+
+// Initialize opens the given TPM backend, which is used by all later TPM operations
+func Initialize(b Backend) error {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	// the previous TPM is closed first, only one simulator can be open at a time
+	if instance != nil {
+		instance.Close()
+		instance = nil
+	}
+	rwc, err := b.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s TPM: %w", b.Name(), err)
+	}
+	backend, instance = b, rwc
+	// keys of the previous TPM are not loaded in the new one
+	attestationKey, signingKey = nil, nil
+	fmt.Println("Using", b.Name(), "TPM")
+	return nil
+}
+
+// GetInstance returns the opened TPM, the simulator is opened if Initialize was not called. The TPM is opened again
+// if its connection failed, e.g. as the swtpm or the TPM resource manager restarted
+func GetInstance() (io.ReadWriter, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	return openInstance()
+}
+
+// openInstance opens the backend unless it is open, it must be called with tpmMutex held
+func openInstance() (io.ReadWriter, error) {
+	if instance == nil {
+		rwc, err := backend.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s TPM: %w", backend.Name(), err)
+		}
+		instance = rwc
+	}
+	return instance, nil
+}
+
+// dropIfBroken closes the opened TPM if the error is an I/O error of its connection, so that the next GetInstance
+// opens it again instead of failing forever. Errors the TPM responded with leave the connection open. The keys
+// created in the TPM are created again on the new connection. It must be called with tpmMutex held
+func dropIfBroken(rw io.ReadWriter, err error) error {
+	if err == nil || instance == nil || rw != io.ReadWriter(instance) || !isConnectionError(err) {
+		return err
+	}
+	fmt.Println("Connection to the", backend.Name(), "TPM failed, it is opened again on the next command:", err)
+	instance.Close()
+	instance = nil
+	attestationKey, signingKey = nil, nil
+	return err
+}
+
+// isConnectionError returns whether the error is an I/O error of the connection to the TPM
+func isConnectionError(err error) bool {
+	var pathErr *os.PathError
+	var syscallErr *os.SyscallError
+	var opErr *net.OpError
+	return errors.As(err, &pathErr) || errors.As(err, &syscallErr) || errors.As(err, &opErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// pcrBank returns the PCR bank used to anchor roots of the given hash algorithm, algorithms without
+// a matching bank in common TPMs are anchored in the bank of the same digest size
+func pcrBank(algorithm merkleTree.HashAlgorithm) tpm2.Algorithm {
+	switch algorithm {
+	case merkleTree.SHA384:
+		return tpm2.AlgSHA384
+	case merkleTree.SHA512:
+		return tpm2.AlgSHA512
+	default:
+		// SHA3-256 and BLAKE2b-256 have 32 byte digests as SHA-256
+		return tpm2.AlgSHA256
+	}
+}
+
+// SaveToTPM anchors the merkle root by resetting the PCR and extending it with the root, which is kept in the NV
+// storage as well. An empty root leaves the PCR reset and removes the root from the NV storage
+func SaveToTPM(rw io.ReadWriter, hashedContent []byte, algorithm merkleTree.HashAlgorithm) error {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	return dropIfBroken(rw, saveToTPM(rw, hashedContent, algorithm))
+}
+
+// saveToTPM anchors the merkle root as SaveToTPM, it must be called with tpmMutex held
+func saveToTPM(rw io.ReadWriter, hashedContent []byte, algorithm merkleTree.HashAlgorithm) error {
+	pcrHandle := tpmutil.Handle(uint32(pcrIndex))
+
+	// uncomment for debugging
+	//initialPcrValue, err := tpm2.ReadPCR(rw, pcrIndex, tpm2.AlgSHA256)
+	//if err != nil {
+	//	return fmt.Errorf("failed to read PCR: %w", err)
+	//}
+	err := tpm2.PCRReset(rw, pcrHandle)
+	//previousPCR, err := tpm2.ReadPCR(rw, pcrIndex, tpm2.AlgSHA256)
+	if err != nil {
+		return fmt.Errorf("failed to reset PCR: %w", err)
+	}
+	//previousPCRValue = previousPCR
+
+	// An empty tree has no root to anchor, the PCR stays reset so that no function verifies
+	if len(hashedContent) == 0 {
+		return storeRootInNV(rw, hashedContent)
+	}
+
+	// TPM PCR extensions follow the calculation:
+	// pcr_new = H(pcr_old | H(data))
+	// The variable hashedContent already contains the H(data) value
+	err = tpm2.PCRExtend(rw, pcrHandle, pcrBank(algorithm), hashedContent, "")
+	if err != nil {
+		return fmt.Errorf("failed to extend PCR: %w", err)
+	}
+
+	// Keep the root in NV storage so that it can be authenticated after a restart
+	if err = storeRootInNV(rw, hashedContent); err != nil {
+		return fmt.Errorf("failed to store merkle root in TPM NV storage: %w", err)
+	}
+
+	return nil
+
+}
+
+// ResetPCR resets the merkle root PCR so that no root verifies, the root in the NV storage is left unchanged
+func ResetPCR(rw io.ReadWriter) error {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	return dropIfBroken(rw, tpm2.PCRReset(rw, tpmutil.Handle(uint32(pcrIndex))))
+}
+
+// ReadPCRValue returns the value of the merkle root PCR in the bank of the hash algorithm
+func ReadPCRValue(rw io.ReadWriter, algorithm merkleTree.HashAlgorithm) ([]byte, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	pcrValue, err := tpm2.ReadPCR(rw, pcrIndex, pcrBank(algorithm))
+	return pcrValue, dropIfBroken(rw, err)
+}
+
+// VerifyMerkleRoot returns whether the merkle root is the root the PCR was extended with, an error is returned if the
+// PCR cannot be read
+func VerifyMerkleRoot(rw io.ReadWriter, merkleRoot []byte, algorithm merkleTree.HashAlgorithm) (bool, error) {
+	tpmMutex.Lock()
+	defer tpmMutex.Unlock()
+
+	bank := pcrBank(algorithm)
+
+	// Read the merkle root stored in the TPM
+	pcrValue, err := tpm2.ReadPCR(rw, pcrIndex, bank)
+	if err != nil {
+		return false, fmt.Errorf("failed to read PCR: %w", dropIfBroken(rw, err))
+	}
+	// This method involves manually recreating the PCRExtend operation
+	// TPM PCR extensions follow the calculation:
+	// pcr_new = H(pcr_old | H(data))
+	// The variable hashedContent already contains the H(data) value
+	// H is the hash of the PCR bank, the reset PCR is a byte array of 0's of its digest size
+	bankHash, err := bank.Hash()
+	if err != nil {
+		return false, fmt.Errorf("unsupported PCR bank: %w", err)
+	}
+	zeroByteArray := bytes.Repeat([]byte{0}, bankHash.Size())
+
+	// Get the hash algorithm of the bank
+	hashCalculator := bankHash.New()
+	// Write the 0 byte array
+	hashCalculator.Write(zeroByteArray)
+	// Concatenate the merkle root given from TruFaaS
+	hashCalculator.Write(merkleRoot)
+	// Calculate the hashed value
+	hashedValue := hashCalculator.Sum(nil)
+
+	if bytes.Equal(hashedValue, pcrValue) {
+		fmt.Println("PCR value matches the extended value.")
+		return true, nil
+	} else {
+		fmt.Println("PCR value does not match the extended value.")
+		return false, nil
+	}
+
+}
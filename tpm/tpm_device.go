@@ -0,0 +1,20 @@
+package tpm
+
+import (
+	"github.com/google/go-tpm/tpm2"
+	"io"
+)
+
+// DeviceBackend is a TPM character device, e.g. /dev/tpmrm0 for the kernel resource manager
+type DeviceBackend struct {
+	Path string // Path of the TPM device
+}
+
+func (b *DeviceBackend) Open() (io.ReadWriteCloser, error) {
+	// the kernel has already started up the TPM, OpenTPM also checks it is a TPM 2.0
+	return tpm2.OpenTPM(b.Path)
+}
+
+func (b *DeviceBackend) Name() string {
+	return "device " + b.Path
+}
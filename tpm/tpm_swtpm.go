@@ -0,0 +1,77 @@
+package tpm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/go-tpm/tpm2"
+	"io"
+	"net"
+)
+
+// tpmResponseHeaderSize is the size of tag, response size and response code of a TPM response
+const tpmResponseHeaderSize = 10
+
+// SwtpmBackend is a swtpm instance serving raw TPM commands on a TCP socket,
+// e.g. started with `swtpm socket --tpm2 --server type=tcp,port=2321 --ctrl type=tcp,port=2322`
+type SwtpmBackend struct {
+	Address string // Address of the swtpm server socket, host:port
+}
+
+func (b *SwtpmBackend) Open() (io.ReadWriteCloser, error) {
+	conn, err := net.Dial("tcp", b.Address)
+	if err != nil {
+		return nil, err
+	}
+	rwc := &swtpmConn{conn: conn}
+
+	// swtpm is not started up unless it is run with --flags startup-clear, a TPM that is
+	// already started up answers with TPM_RC_INITIALIZE which is fine
+	err = tpm2.Startup(rwc, tpm2.StartupClear)
+	if err != nil && !isInitializeError(err) {
+		rwc.Close()
+		return nil, fmt.Errorf("failed to start up swtpm: %w", err)
+	}
+	return rwc, nil
+}
+
+func (b *SwtpmBackend) Name() string {
+	return "swtpm " + b.Address
+}
+
+func isInitializeError(err error) bool {
+	tpmErr, ok := err.(tpm2.Error)
+	return ok && tpmErr.Code == tpm2.RCInitialize
+}
+
+// swtpmConn reads a complete TPM response on every Read, as the go-tpm library expects
+// a response in a single Read while TCP might deliver it in several segments
+type swtpmConn struct {
+	conn net.Conn
+}
+
+func (c *swtpmConn) Read(p []byte) (int, error) {
+	if len(p) < tpmResponseHeaderSize {
+		return 0, io.ErrShortBuffer
+	}
+	if _, err := io.ReadFull(c.conn, p[:tpmResponseHeaderSize]); err != nil {
+		return 0, err
+	}
+
+	// the response size covers the header and the body
+	size := int(binary.BigEndian.Uint32(p[2:6]))
+	if size < tpmResponseHeaderSize || size > len(p) {
+		return 0, fmt.Errorf("invalid TPM response size %d", size)
+	}
+	if _, err := io.ReadFull(c.conn, p[tpmResponseHeaderSize:size]); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (c *swtpmConn) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+func (c *swtpmConn) Close() error {
+	return c.conn.Close()
+}
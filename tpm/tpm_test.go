@@ -0,0 +1,214 @@
+package tpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/google/go-tpm-tools/simulator"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+// breakableBackend is the simulator, whose connection fails like a closed socket once broken is set
+type breakableBackend struct {
+	broken atomic.Bool
+	opened atomic.Int32
+}
+
+// breakableConnection fails every command while the backend is broken
+type breakableConnection struct {
+	io.ReadWriteCloser
+	backend *breakableBackend
+}
+
+func (b *breakableBackend) Open() (io.ReadWriteCloser, error) {
+	sim, err := simulator.Get()
+	if err != nil {
+		return nil, err
+	}
+	b.opened.Add(1)
+	b.broken.Store(false)
+	return &breakableConnection{ReadWriteCloser: sim, backend: b}, nil
+}
+
+func (b *breakableBackend) Name() string {
+	return "breakable simulator"
+}
+
+func (c *breakableConnection) Write(data []byte) (int, error) {
+	if c.backend.broken.Load() {
+		return 0, io.ErrClosedPipe
+	}
+	return c.ReadWriteCloser.Write(data)
+}
+
+// useSimulator opens a new simulator for the test
+func useSimulator(t *testing.T) io.ReadWriter {
+	if err := Initialize(&SimulatorBackend{}); err != nil {
+		t.Fatalf("failed to open the simulator: %v", err)
+	}
+	rw, err := GetInstance()
+	if err != nil {
+		t.Fatalf("failed to get the simulator: %v", err)
+	}
+	return rw
+}
+
+// rootOf returns a root of the size of the hash algorithm
+func rootOf(algorithm merkleTree.HashAlgorithm, content string) []byte {
+	return merkleTree.HashLeaf(algorithm, []byte(content))
+}
+
+func TestSaveToTPMAnchorsRoot(t *testing.T) {
+	rw := useSimulator(t)
+
+	for _, algorithm := range merkleTree.HashAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			root := rootOf(algorithm, "root")
+			if err := SaveToTPM(rw, root, algorithm); err != nil {
+				t.Fatalf("failed to anchor the root: %v", err)
+			}
+			verified, err := VerifyMerkleRoot(rw, root, algorithm)
+			if err != nil || !verified {
+				t.Fatalf("expected the anchored root to verify, found %v (%v)", verified, err)
+			}
+			if verified, _ = VerifyMerkleRoot(rw, rootOf(algorithm, "other"), algorithm); verified {
+				t.Fatal("expected another root not to verify")
+			}
+
+			// the PCR holds the extension of the reset PCR with the root
+			pcrValue, err := ReadPCRValue(rw, algorithm)
+			if err != nil {
+				t.Fatalf("failed to read the PCR: %v", err)
+			}
+			if len(pcrValue) != algorithm.Size() {
+				t.Fatalf("expected a PCR value of %d bytes, found %d", algorithm.Size(), len(pcrValue))
+			}
+
+			// anchoring the root again replaces the root instead of extending the PCR with it
+			if err = SaveToTPM(rw, root, algorithm); err != nil {
+				t.Fatalf("failed to anchor the root again: %v", err)
+			}
+			if verified, _ = VerifyMerkleRoot(rw, root, algorithm); !verified {
+				t.Fatal("expected the root anchored again to verify")
+			}
+		})
+	}
+}
+
+func TestSaveToTPMWithEmptyRootResetsPCR(t *testing.T) {
+	rw := useSimulator(t)
+	root := rootOf(merkleTree.SHA256, "root")
+	if err := SaveToTPM(rw, root, merkleTree.SHA256); err != nil {
+		t.Fatalf("failed to anchor the root: %v", err)
+	}
+
+	if err := SaveToTPM(rw, nil, merkleTree.SHA256); err != nil {
+		t.Fatalf("failed to anchor the empty root: %v", err)
+	}
+	if verified, _ := VerifyMerkleRoot(rw, root, merkleTree.SHA256); verified {
+		t.Fatal("expected the replaced root not to verify")
+	}
+	pcrValue, err := ReadPCRValue(rw, merkleTree.SHA256)
+	if err != nil || !bytes.Equal(pcrValue, make([]byte, sha256.Size)) {
+		t.Fatalf("expected the reset PCR, found %x (%v)", pcrValue, err)
+	}
+	if _, err = ReadRootFromNV(rw); !errors.Is(err, ErrNoNVRoot) {
+		t.Fatalf("expected ErrNoNVRoot for an empty root, found %v", err)
+	}
+}
+
+func TestRootNVRoundTrip(t *testing.T) {
+	rw := useSimulator(t)
+	if _, err := ReadRootFromNV(rw); !errors.Is(err, ErrNoNVRoot) {
+		t.Fatalf("expected ErrNoNVRoot for a new TPM, found %v", err)
+	}
+
+	// the NV index is defined again for roots of another size
+	for _, algorithm := range []merkleTree.HashAlgorithm{merkleTree.SHA256, merkleTree.SHA512, merkleTree.SHA384, merkleTree.SHA256} {
+		root := rootOf(algorithm, "root")
+		if err := SaveToTPM(rw, root, algorithm); err != nil {
+			t.Fatalf("failed to anchor the %s root: %v", algorithm, err)
+		}
+		stored, err := ReadRootFromNV(rw)
+		if err != nil || !bytes.Equal(stored, root) {
+			t.Fatalf("expected the %s root %x in the NV storage, found %x (%v)", algorithm, root, stored, err)
+		}
+	}
+
+	// resetting the PCR leaves the root in the NV storage
+	if err := ResetPCR(rw); err != nil {
+		t.Fatalf("failed to reset the PCR: %v", err)
+	}
+	if stored, err := ReadRootFromNV(rw); err != nil || !bytes.Equal(stored, rootOf(merkleTree.SHA256, "root")) {
+		t.Fatalf("expected the root to survive a PCR reset, found %x (%v)", stored, err)
+	}
+}
+
+func TestGetInstanceReconnectsAfterConnectionFailure(t *testing.T) {
+	b := &breakableBackend{}
+	if err := Initialize(b); err != nil {
+		t.Fatalf("failed to open the backend: %v", err)
+	}
+	defer Initialize(&SimulatorBackend{})
+	rw, err := GetInstance()
+	if err != nil {
+		t.Fatalf("failed to get the TPM: %v", err)
+	}
+	root := rootOf(merkleTree.SHA256, "root")
+
+	b.broken.Store(true)
+	if err = SaveToTPM(rw, root, merkleTree.SHA256); err == nil {
+		t.Fatal("expected the anchoring to fail on a broken connection")
+	}
+
+	// the failed connection is not returned again, the TPM is opened again instead
+	reopened, err := GetInstance()
+	if err != nil {
+		t.Fatalf("failed to open the TPM again: %v", err)
+	}
+	if reopened == rw || b.opened.Load() != 2 {
+		t.Fatalf("expected the TPM to be opened again, opened %d times", b.opened.Load())
+	}
+	if err = SaveToTPM(reopened, root, merkleTree.SHA256); err != nil {
+		t.Fatalf("failed to anchor the root after reconnecting: %v", err)
+	}
+	if verified, err := VerifyMerkleRoot(reopened, root, merkleTree.SHA256); err != nil || !verified {
+		t.Fatalf("expected the root to verify after reconnecting, found %v (%v)", verified, err)
+	}
+}
+
+func TestGetInstanceKeepsConnectionAfterTPMError(t *testing.T) {
+	b := &breakableBackend{}
+	if err := Initialize(b); err != nil {
+		t.Fatalf("failed to open the backend: %v", err)
+	}
+	defer Initialize(&SimulatorBackend{})
+	rw, err := GetInstance()
+	if err != nil {
+		t.Fatalf("failed to get the TPM: %v", err)
+	}
+
+	// a root that does not fit the PCR bank is refused by the TPM, the connection is fine
+	if err = SaveToTPM(rw, []byte("short"), merkleTree.SHA256); err == nil {
+		t.Fatal("expected a root of the wrong size to be refused")
+	}
+	if again, _ := GetInstance(); again != rw || b.opened.Load() != 1 {
+		t.Fatal("expected the connection to be kept after an error the TPM responded with")
+	}
+}
+
+func TestPCRBankMatchesDigestSize(t *testing.T) {
+	for _, algorithm := range merkleTree.HashAlgorithms {
+		bankHash, err := pcrBank(algorithm).Hash()
+		if err != nil {
+			t.Fatalf("no hash function for the %s bank: %v", algorithm, err)
+		}
+		// the root is extended into the bank as it is, so it must have the digest size of the bank
+		if bankHash.Size() != algorithm.Size() {
+			t.Fatalf("expected the %s bank to have %d byte digests, found %d", algorithm, algorithm.Size(), bankHash.Size())
+		}
+	}
+}
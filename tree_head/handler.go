@@ -0,0 +1,127 @@
+package tree_head
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/checkpoint"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/identity"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+)
+
+// DefaultHistoryLimit is the number of heads returned when no limit is given
+const DefaultHistoryLimit = 100
+
+// MaxHistoryLimit is the largest number of heads returned by a single request
+const MaxHistoryLimit = 1000
+
+// SignatureAlgorithm describes how the tree heads are signed
+const SignatureAlgorithm = identity.SignatureAlgorithm
+
+// TreeHead : struct that represents a signed tree head, binary values are hex encoded
+type TreeHead struct {
+	Index         int    `json:"index"`
+	TreeSize      int    `json:"tree_size"`
+	RootHash      string `json:"root_hash"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Timestamp     int64  `json:"timestamp"`
+	Signature     string `json:"signature"`
+}
+
+// TreeHeadResponse : struct that represents the latest signed tree head and the key that signed it
+type TreeHeadResponse struct {
+	StatusCode         int      `json:"status_code"`
+	TreeHead           TreeHead `json:"tree_head"`
+	SignatureAlgorithm string   `json:"signature_algorithm"`
+	PublicKey          string   `json:"public_key"`
+}
+
+// TreeHeadHistoryResponse : struct that represents a range of the signed tree head history
+type TreeHeadHistoryResponse struct {
+	StatusCode         int        `json:"status_code"`
+	Total              int        `json:"total"`
+	TreeHeads          []TreeHead `json:"tree_heads"`
+	SignatureAlgorithm string     `json:"signature_algorithm"`
+	PublicKey          string     `json:"public_key"`
+}
+
+// TreeHeadHandler responds with the latest signed tree head
+func TreeHeadHandler(respWriter http.ResponseWriter, req *http.Request) {
+	publicKey, err := publicKeyHex()
+	if err != nil {
+		sendInternalServerError(respWriter, err)
+		return
+	}
+	head, index := Latest()
+	if head == nil {
+		utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{StatusCode: http.StatusNotFound, ErrorMsg: "No tree head signed yet"})
+		return
+	}
+
+	utils.SendJSONResponse(respWriter, http.StatusOK, TreeHeadResponse{
+		StatusCode:         http.StatusOK,
+		TreeHead:           convertTreeHead(index, head),
+		SignatureAlgorithm: SignatureAlgorithm,
+		PublicKey:          publicKey,
+	})
+}
+
+// TreeHeadHistoryHandler responds with the signed tree heads starting at the from index, at most limit heads are returned
+func TreeHeadHistoryHandler(respWriter http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	from, err := utils.ParseQueryInt(query.Get(constants.FromQueryParam), 0)
+	if err != nil || from < 0 {
+		utils.SendBadRequestResponse(respWriter, "from must be a non-negative index")
+		return
+	}
+	limit, err := utils.ParseQueryInt(query.Get(constants.LimitQueryParam), DefaultHistoryLimit)
+	if err != nil || limit < 1 || limit > MaxHistoryLimit {
+		utils.SendBadRequestResponse(respWriter, fmt.Sprintf("limit must be between 1 and %d", MaxHistoryLimit))
+		return
+	}
+	publicKey, err := publicKeyHex()
+	if err != nil {
+		sendInternalServerError(respWriter, err)
+		return
+	}
+
+	heads, total := History(from, limit)
+	treeHeads := make([]TreeHead, 0, len(heads))
+	for i, head := range heads {
+		treeHeads = append(treeHeads, convertTreeHead(from+i, head))
+	}
+	utils.SendJSONResponse(respWriter, http.StatusOK, TreeHeadHistoryResponse{
+		StatusCode:         http.StatusOK,
+		Total:              total,
+		TreeHeads:          treeHeads,
+		SignatureAlgorithm: SignatureAlgorithm,
+		PublicKey:          publicKey,
+	})
+}
+
+func convertTreeHead(index int, head *checkpoint.Checkpoint) TreeHead {
+	return TreeHead{
+		Index:         index,
+		TreeSize:      head.TreeSize,
+		RootHash:      hex.EncodeToString(head.RootHash),
+		HashAlgorithm: head.HashAlgorithm,
+		Timestamp:     head.Timestamp,
+		Signature:     hex.EncodeToString(head.Signature),
+	}
+}
+
+// publicKeyHex returns the hex encoded PKIX public key of the signing key
+func publicKeyHex() (string, error) {
+	publicKey, err := identity.PublicKeyDER()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(publicKey), nil
+}
+
+func sendInternalServerError(respWriter http.ResponseWriter, err error) {
+	fmt.Println("failed to serve tree head:", err)
+	utils.SendErrorResponse(respWriter, commonTypes.ErrorResponse{StatusCode: http.StatusInternalServerError, ErrorMsg: "Internal Server error"})
+}
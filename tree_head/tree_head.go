@@ -0,0 +1,118 @@
+package tree_head
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	atomicFile "github.com/TruFaaS/TruFaaS/atomic_file"
+	"github.com/TruFaaS/TruFaaS/checkpoint"
+	"os"
+	"sync"
+)
+
+// A signed tree head is the checkpoint signed after every mutation, the history of all signed tree heads lets third
+// parties detect a rewritten registry, e.g. a pinned head missing from the history. Only append-only trees let them
+// detect a fork from the heads: two heads of the same size with different roots, or a head whose tree does not extend
+// an earlier one, checked with the consistency proofs of /tree/consistency. A mutable tree changes its leafs in
+// place, so two heads of the same size with different roots are a normal update and /tree/consistency refuses it
+// with ErrCodeNotAppendOnly
+
+var mutex sync.Mutex
+var historyFileName = ""
+var history = make([]*checkpoint.Checkpoint, 0)
+
+// Initialize loads the history of signed tree heads from the file, one JSON checkpoint per line
+func Initialize(fileName string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	truncated, err := atomicFile.TruncateIncompleteLine(fileName)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		fmt.Println("Tree head history ends with an incomplete head, which is removed")
+	}
+	heads, err := readHistory(fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	historyFileName = fileName
+	history = heads
+	fmt.Println("Tree head history", fileName, "loaded with", len(heads), "heads")
+	return nil
+}
+
+// Append appends the signed tree head to the history
+func Append(head *checkpoint.Checkpoint) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if historyFileName == "" {
+		return nil
+	}
+	line, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(historyFileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	history = append(history, head)
+	return nil
+}
+
+// Latest returns the last signed tree head and its index in the history, nil if none was signed yet
+func Latest() (*checkpoint.Checkpoint, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(history) == 0 {
+		return nil, -1
+	}
+	return history[len(history)-1], len(history) - 1
+}
+
+// History returns at most limit signed tree heads starting at the from index, and the total number of heads
+func History(from int, limit int) ([]*checkpoint.Checkpoint, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if from >= len(history) {
+		return []*checkpoint.Checkpoint{}, len(history)
+	}
+	to := from + limit
+	if to > len(history) {
+		to = len(history)
+	}
+	return history[from:to], len(history)
+}
+
+func readHistory(fileName string) ([]*checkpoint.Checkpoint, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return make([]*checkpoint.Checkpoint, 0), err
+	}
+
+	heads := make([]*checkpoint.Checkpoint, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var head checkpoint.Checkpoint
+		if err = json.Unmarshal(scanner.Bytes(), &head); err != nil {
+			return nil, fmt.Errorf("tree head history line %d: %w", lineNumber, err)
+		}
+		heads = append(heads, &head)
+	}
+	return heads, scanner.Err()
+}
@@ -0,0 +1,311 @@
+package tree_manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/checkpoint"
+	"github.com/TruFaaS/TruFaaS/health"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeHead "github.com/TruFaaS/TruFaaS/tree_head"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"sync"
+	"sync/atomic"
+)
+
+// mutex serializes mutations of the tree, from cloning the snapshot until the new root is anchored and published
+var mutex sync.Mutex
+
+// snapshot is the active tree, a published tree is never modified so it can be read without locking
+var snapshot atomic.Pointer[merkleTree.MerkleTree]
+
+// maxStoreAttempts bounds how often a mutation is applied again after another replica replaced the stored tree
+const maxStoreAttempts = 3
+
+// reasons of the inconsistent health status set by the tree manager, which are recovered from once a tree is anchored
+// or, for AuditFailure, once the entry of the anchored mutation is recorded
+const (
+	AnchorFailure  = "merkle root could not be anchored in the TPM"
+	RefreshFailure = "merkle tree stored by another replica could not be authenticated"
+	AuditFailure   = "mutation could not be recorded in the audit log"
+)
+
+// unrecorded is the entry of an anchored mutation that could not be recorded in the audit log, it is recorded before
+// any other mutation so that the log never misses an applied mutation
+var unrecorded *audit.Entry
+
+// anchored is the tree whose root is known to be anchored in the TPM, so that verifications do not wait on the TPM
+var anchored atomic.Pointer[merkleTree.MerkleTree]
+
+// Initialize loads the stored merkle tree as the active tree, it is the only time the stored tree is read,
+// afterwards the tree is kept in memory and only written on mutation
+func Initialize() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	mt, err := utils.RetrieveMerkleTree()
+	if err != nil {
+		return err
+	}
+	snapshot.Store(mt)
+	return nil
+}
+
+// Restore stores the tree and publishes it as the active tree, without anchoring its root in the TPM
+func Restore(mt *merkleTree.MerkleTree) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := utils.StoreMerkleTree(mt); err != nil {
+		return err
+	}
+	snapshot.Store(mt)
+	return nil
+}
+
+// Snapshot returns the active tree, which must not be modified
+func Snapshot() *merkleTree.MerkleTree {
+	return snapshot.Load()
+}
+
+// Mutate applies the mutation to a copy of the active tree, stores the result, anchors its root in the TPM and
+// publishes it as the active tree, then signs a checkpoint of it that is appended to the tree head history and records
+// the entry in the audit log with the roots and PCR value of the mutation. Mutations are applied one at a time and the
+// active tree is left unchanged if any step before anchoring fails. Once anchored the mutation is applied, so a failure
+// to sign it degrades the health status instead of failing the mutation. A failure to record it sets the inconsistent
+// health status, as the audit log would no longer replay to the anchored root, and the entry is recorded again before
+// the next mutation or by RecordUnrecorded. A mutation that does not change
+// the tree, e.g. registering a function again with the same spec, is neither persisted nor recorded. If another
+// replica sharing the store replaced the stored tree, the mutation is applied again to the tree it stored.
+func Mutate(entry *audit.Entry, mutation func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error)) (*merkleTree.MerkleTree, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := recordUnrecorded(); err != nil {
+		return nil, fmt.Errorf("failed to record the previous mutation in the audit log: %w", err)
+	}
+	active := snapshot.Load()
+	mt, err := mutation(active.Clone())
+	if err != nil {
+		return nil, err
+	}
+	if unchanged(active, mt) {
+		return active, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = utils.StoreMerkleTree(mt)
+		if !errors.Is(err, store.ErrConcurrentModification) || attempt == maxStoreAttempts {
+			break
+		}
+		fmt.Println("Stored merkle tree was replaced by another replica, loading it again")
+		if active, err = reloadStoredTree(); err != nil {
+			return nil, err
+		}
+		if mt, err = mutation(active.Clone()); err != nil {
+			return nil, err
+		}
+		if unchanged(active, mt) {
+			// the tree stored by the other replica already holds the mutation, it only has to be anchored
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = anchorRoot(mt); err != nil {
+		// the stored tree is no longer the one anchored in the TPM, and the PCR may hold neither root
+		anchored.Store(nil)
+		health.Set(health.StatusInconsistent, AnchorFailure)
+		return nil, fmt.Errorf("failed to anchor merkle root in TPM: %w", err)
+	}
+	anchored.Store(mt)
+	snapshot.Store(mt)
+	health.Recover(AnchorFailure)
+
+	// the tree is anchored so it stays published, a missing tree head is signed again on restart
+	cp, err := utils.StoreCheckpoint(mt)
+	if err == nil {
+		err = treeHead.Append(cp)
+	}
+	if err != nil {
+		health.Degrade("tree head of the anchored merkle root could not be signed")
+		fmt.Println("Mutation applied but no tree head signed:", err)
+	}
+	if err = recordMutation(entry, active, mt); err != nil {
+		unrecorded = entry
+		health.Set(health.StatusInconsistent, AuditFailure)
+		fmt.Println("Mutation applied but not recorded in the audit log:", err)
+	}
+	return mt, nil
+}
+
+// RecordUnrecorded records the entry of an anchored mutation that could not be recorded in the audit log, if any,
+// and recovers from the inconsistent health status it set
+func RecordUnrecorded() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return recordUnrecorded()
+}
+
+// recordUnrecorded records the unrecorded entry, the mutex must be held
+func recordUnrecorded() error {
+	if unrecorded == nil {
+		return nil
+	}
+	if err := completeEntry(unrecorded, snapshot.Load()); err != nil {
+		return err
+	}
+	if err := audit.Record(unrecorded); err != nil {
+		return err
+	}
+	unrecorded = nil
+	health.Recover(AuditFailure)
+	fmt.Println("Mutation recorded in the audit log")
+	return nil
+}
+
+// anchorRoot anchors the root of the tree in the TPM
+func anchorRoot(mt *merkleTree.MerkleTree) error {
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		return err
+	}
+	return tpm.SaveToTPM(tpmInstance, mt.GetMerkleRoot(), mt.HashAlgorithm)
+}
+
+// Watch refreshes the active tree whenever another replica sharing the store replaces it, until the context is done.
+// Stores that are not shared between replicas are not watched
+func Watch(ctx context.Context) {
+	watcher, ok := utils.GetTreeStore().(store.TreeWatcher)
+	if !ok {
+		return
+	}
+	watcher.WatchCheckpoint(ctx, func() {
+		if err := Refresh(); err != nil {
+			fmt.Println("Failed to refresh the merkle tree stored by another replica:", err)
+		}
+	})
+}
+
+// Refresh publishes the tree another replica stored once its signed checkpoint is verified and anchors its root in the
+// TPM, so that a function updated or deleted by another replica no longer verifies here either. The tree is published
+// before its root is anchored, a failure to anchor it fails its verifications with a merkle root mismatch. If the
+// stored tree cannot be authenticated the health status is inconsistent, as the active tree may hold removed functions
+func Refresh() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	active := snapshot.Load()
+	mt, err := reloadStoredTree()
+	if err != nil {
+		health.Set(health.StatusInconsistent, RefreshFailure)
+		return err
+	}
+	if unchanged(active, mt) && anchored.Load() == active {
+		health.Recover(RefreshFailure)
+		return nil
+	}
+	anchored.Store(nil)
+	snapshot.Store(mt)
+	if err = anchorRoot(mt); err != nil {
+		health.Set(health.StatusInconsistent, AnchorFailure)
+		return fmt.Errorf("failed to anchor merkle root in TPM: %w", err)
+	}
+	anchored.Store(mt)
+	health.Recover(AnchorFailure, RefreshFailure)
+	fmt.Println("Merkle tree stored by another replica published")
+	return nil
+}
+
+// unchanged returns whether the mutated tree is the same as the tree it was copied from
+func unchanged(active *merkleTree.MerkleTree, mt *merkleTree.MerkleTree) bool {
+	return bytes.Equal(mt.GetMerkleRoot(), active.GetMerkleRoot()) && mt.KeyCount() == active.KeyCount()
+}
+
+// reloadStoredTree loads the tree another replica stored, which is only accepted if its signed checkpoint matches it,
+// so that a tree written to the store by anyone else is never anchored
+func reloadStoredTree() (*merkleTree.MerkleTree, error) {
+	mt, err := utils.ReloadMerkleTree()
+	if err != nil {
+		return nil, err
+	}
+	cp, err := checkpoint.Load(utils.GetTreeStore())
+	if err != nil {
+		return nil, err
+	}
+	if !cp.VerifyTrusted() || !cp.Matches(mt) {
+		return nil, errors.New("stored merkle tree replaced by another replica does not match the signed checkpoint")
+	}
+	return mt, nil
+}
+
+// recordMutation completes the audit entry with the roots before and after the mutation and the anchored PCR value
+// and records it
+func recordMutation(entry *audit.Entry, oldTree *merkleTree.MerkleTree, newTree *merkleTree.MerkleTree) error {
+	entry.HashAlgorithm = string(newTree.HashAlgorithm)
+	entry.TreeMode = string(newTree.Mode)
+	if newTree.IsMultiTenant() {
+		entry.Tenancy = string(newTree.Tenancy)
+	}
+	entry.OldRoot = hex.EncodeToString(oldTree.GetMerkleRoot())
+	entry.NewRoot = hex.EncodeToString(newTree.GetMerkleRoot())
+	if err := completeEntry(entry, newTree); err != nil {
+		return err
+	}
+	return audit.Record(entry)
+}
+
+// completeEntry sets the PCR value the root of the tree is anchored with, unless it was read already. The PCR holds
+// the same value while the entry is unrecorded, as no other mutation is applied until it is recorded
+func completeEntry(entry *audit.Entry, mt *merkleTree.MerkleTree) error {
+	if entry.PCRValue != "" {
+		return nil
+	}
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		return err
+	}
+	pcrValue, err := tpm.ReadPCRValue(tpmInstance, mt.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	entry.PCRValue = hex.EncodeToString(pcrValue)
+	return nil
+}
+
+// AnchoredSnapshot returns the active tree and whether its root is the one anchored in the TPM. The tree anchored
+// by the last mutation is known to be anchored, so only a tree not anchored by a mutation, e.g. the tree restored
+// on startup, is checked against the TPM, after which it is known to be anchored as well. An error is returned if the
+// TPM cannot be read
+func AnchoredSnapshot() (*merkleTree.MerkleTree, bool, error) {
+	mt := snapshot.Load()
+	if anchored.Load() == mt {
+		return mt, true, nil
+	}
+
+	// a concurrent mutation may be anchoring its root, the active tree and the TPM are consistent again once it is done
+	mutex.Lock()
+	defer mutex.Unlock()
+	mt = snapshot.Load()
+	if anchored.Load() == mt {
+		return mt, true, nil
+	}
+	tpmInstance, err := tpm.GetInstance()
+	if err != nil {
+		return mt, false, err
+	}
+	verified, err := tpm.VerifyMerkleRoot(tpmInstance, mt.GetMerkleRoot(), mt.HashAlgorithm)
+	if err != nil {
+		return mt, false, err
+	}
+	if verified {
+		anchored.Store(mt)
+	}
+	return mt, verified, nil
+}
@@ -0,0 +1,323 @@
+package tree_manager
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/audit"
+	"github.com/TruFaaS/TruFaaS/health"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
+	"github.com/TruFaaS/TruFaaS/tpm"
+	treeHead "github.com/TruFaaS/TruFaaS/tree_head"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"github.com/google/go-tpm-tools/simulator"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// failingBackend is the simulator, whose commands fail while fail is set
+type failingBackend struct {
+	fail atomic.Bool
+}
+
+// failingConnection fails every command while the backend fails
+type failingConnection struct {
+	io.ReadWriteCloser
+	backend *failingBackend
+}
+
+func (b *failingBackend) Open() (io.ReadWriteCloser, error) {
+	sim, err := simulator.Get()
+	if err != nil {
+		return nil, err
+	}
+	return &failingConnection{ReadWriteCloser: sim, backend: b}, nil
+}
+
+func (b *failingBackend) Name() string {
+	return "failing simulator"
+}
+
+func (c *failingConnection) Write(data []byte) (int, error) {
+	if c.backend.fail.Load() {
+		return 0, errors.New("TPM unavailable")
+	}
+	return c.ReadWriteCloser.Write(data)
+}
+
+var testBackend = &failingBackend{}
+
+// testAuditLog is the audit log the tests record in
+var testAuditLog string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "trufaas-tree-manager-test")
+	if err != nil {
+		fmt.Println("failed to create test directory:", err)
+		os.Exit(1)
+	}
+	err = tpm.Initialize(testBackend)
+	if err == nil {
+		err = identity.Initialize(filepath.Join(dir, "signing-key.pem"))
+	}
+	if err == nil {
+		testAuditLog = filepath.Join(dir, "audit.log")
+		err = audit.Initialize(testAuditLog, false)
+	}
+	if err == nil {
+		err = treeHead.Initialize(filepath.Join(dir, "tree-heads.log"))
+	}
+	if err != nil {
+		fmt.Println("failed to initialize test state:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useNewStore publishes an empty tree kept in a new file store as the active tree
+func useNewStore(t testing.TB) store.TreeStore {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	utils.SetTreeStore(s)
+	if err = Initialize(); err != nil {
+		t.Fatalf("failed to initialize the tree manager: %v", err)
+	}
+	health.Set(health.StatusHealthy, "")
+	return s
+}
+
+// appendKey returns the mutation appending the content under the key
+func appendKey(key string, content string) func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+	return func(mt *merkleTree.MerkleTree) (*merkleTree.MerkleTree, error) {
+		return mt.AppendKeyedContent(key, []byte(content)), nil
+	}
+}
+
+// createEntry returns the audit entry of the create appending the content under the key
+func createEntry(key string, content string) *audit.Entry {
+	specHash := merkleTree.HashLeaf(merkleTree.DefaultHashAlgorithm, []byte(content))
+	return &audit.Entry{Operation: audit.OperationCreate, FunctionIdentity: key, SpecHash: hex.EncodeToString(specHash)}
+}
+
+// assertAnchored checks that the active tree has the number of keys and is the tree anchored in the TPM
+func assertAnchored(t *testing.T, keys int) *merkleTree.MerkleTree {
+	mt, verified, err := AnchoredSnapshot()
+	if err != nil || !verified {
+		t.Fatalf("expected the active tree to be anchored, found %v (%v)", verified, err)
+	}
+	if mt.KeyCount() != keys {
+		t.Fatalf("expected %d keys in the active tree, found %d", keys, mt.KeyCount())
+	}
+	return mt
+}
+
+func TestMutateAnchorsAndStoresTree(t *testing.T) {
+	s := useNewStore(t)
+
+	mt, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-1", "spec-1"))
+	if err != nil {
+		t.Fatalf("mutation failed: %v", err)
+	}
+	if assertAnchored(t, 1) != mt {
+		t.Fatal("expected the mutated tree to be published")
+	}
+	if _, err = s.LoadTree(); err != nil {
+		t.Fatalf("expected the mutated tree to be stored: %v", err)
+	}
+	if latest, _ := treeHead.Latest(); latest == nil || !latest.Matches(mt) {
+		t.Fatal("expected a tree head of the mutated tree")
+	}
+}
+
+func TestMutateLeavesUnchangedTreeUnstored(t *testing.T) {
+	s := useNewStore(t)
+	first, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-1", "spec-1"))
+	if err != nil {
+		t.Fatalf("mutation failed: %v", err)
+	}
+	recorded := len(audit.Query(func(audit.Entry) bool { return true }))
+	if err = s.StoreTree([]byte("marker")); err != nil {
+		t.Fatalf("failed to replace the stored tree: %v", err)
+	}
+
+	// registering the function again with the same spec does not change the tree
+	mt, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-1", "spec-1"))
+	if err != nil {
+		t.Fatalf("mutation failed: %v", err)
+	}
+	if mt != first || Snapshot() != first {
+		t.Fatal("expected the active tree to be returned unchanged")
+	}
+	if data, _ := s.LoadTree(); string(data) != "marker" {
+		t.Fatal("expected an unchanged tree not to be stored")
+	}
+	if len(audit.Query(func(audit.Entry) bool { return true })) != recorded {
+		t.Fatal("expected an unchanged tree not to be recorded in the audit log")
+	}
+}
+
+func TestMutateFailingToAnchorIsRecovered(t *testing.T) {
+	useNewStore(t)
+	active, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-1", "spec-1"))
+	if err != nil {
+		t.Fatalf("mutation failed: %v", err)
+	}
+
+	testBackend.fail.Store(true)
+	_, err = Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-2", "spec-2"))
+	testBackend.fail.Store(false)
+	if err == nil {
+		t.Fatal("expected the mutation to fail while the TPM is unavailable")
+	}
+	if Snapshot() != active {
+		t.Fatal("expected the active tree to be left unchanged")
+	}
+	if status, reason := health.Get(); status != health.StatusInconsistent || reason != AnchorFailure {
+		t.Fatalf("expected inconsistent health after the anchoring failed, found %s (%s)", status, reason)
+	}
+
+	// the next anchored tree restores the health
+	if _, err = Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-2", "spec-2")); err != nil {
+		t.Fatalf("mutation after the TPM recovered failed: %v", err)
+	}
+	assertAnchored(t, 2)
+	if status, reason := health.Get(); status != health.StatusHealthy {
+		t.Fatalf("expected healthy after the root was anchored again, found %s (%s)", status, reason)
+	}
+
+	// other reasons are not recovered from by anchoring
+	health.Set(health.StatusInconsistent, "checkpoint signature is invalid")
+	if _, err = Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey("default/fn-3", "spec-3")); err != nil {
+		t.Fatalf("mutation failed: %v", err)
+	}
+	if status, _ := health.Get(); status != health.StatusInconsistent {
+		t.Fatalf("expected health to stay inconsistent, found %s", status)
+	}
+}
+
+func TestMutateFailingToRecordIsRecordedAgain(t *testing.T) {
+	useNewStore(t)
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	if err := audit.Initialize(auditLog, false); err != nil {
+		t.Fatalf("failed to open the audit log: %v", err)
+	}
+	defer audit.Initialize(testAuditLog, false)
+
+	// the audit log cannot be written while a directory takes its place
+	if err := os.Mkdir(auditLog, 0755); err != nil {
+		t.Fatalf("failed to replace the audit log: %v", err)
+	}
+	mt, err := Mutate(createEntry("default/fn-1", "spec-1"), appendKey("default/fn-1", "spec-1"))
+	if err != nil {
+		t.Fatalf("expected the anchored mutation to succeed, found %v", err)
+	}
+	assertAnchored(t, 1)
+	if status, reason := health.Get(); status != health.StatusInconsistent || reason != AuditFailure {
+		t.Fatalf("expected inconsistent health after the recording failed, found %s (%s)", status, reason)
+	}
+
+	// no other mutation is applied before the entry is recorded
+	if _, err = Mutate(createEntry("default/fn-2", "spec-2"), appendKey("default/fn-2", "spec-2")); err == nil {
+		t.Fatal("expected the mutation to fail while the previous one is not recorded")
+	}
+	assertAnchored(t, 1)
+
+	if err = os.Remove(auditLog); err != nil {
+		t.Fatalf("failed to restore the audit log: %v", err)
+	}
+	if err = RecordUnrecorded(); err != nil {
+		t.Fatalf("failed to record the mutation again: %v", err)
+	}
+	if status, reason := health.Get(); status != health.StatusHealthy {
+		t.Fatalf("expected healthy after the mutation was recorded, found %s (%s)", status, reason)
+	}
+	if _, err = Mutate(createEntry("default/fn-2", "spec-2"), appendKey("default/fn-2", "spec-2")); err != nil {
+		t.Fatalf("mutation after the recording failed: %v", err)
+	}
+
+	// the log holds both mutations in order and replays to the anchored root
+	entries, err := audit.ReadLog(auditLog)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 entries in the audit log, found %d (%v)", len(entries), err)
+	}
+	if entries[0].NewRoot != hex.EncodeToString(mt.GetMerkleRoot()) || entries[0].PCRValue == "" {
+		t.Fatal("expected the first entry to record the root and PCR value of the first mutation")
+	}
+	replayed, err := audit.Replay(entries)
+	if err != nil {
+		t.Fatalf("failed to replay the audit log: %v", err)
+	}
+	if !unchanged(assertAnchored(t, 2), replayed) {
+		t.Fatal("expected the audit log to replay to the anchored root")
+	}
+}
+
+func TestConcurrentMutations(t *testing.T) {
+	useNewStore(t)
+
+	const mutations = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, mutations)
+	for i := 0; i < mutations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey(fmt.Sprintf("default/fn-%d", i), fmt.Sprintf("spec-%d", i)))
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent mutation failed: %v", err)
+		}
+	}
+
+	// no mutation is lost and the stored tree is the active one
+	mt := assertAnchored(t, mutations)
+	stored, err := utils.ReloadMerkleTree()
+	if err != nil {
+		t.Fatalf("failed to load the stored tree: %v", err)
+	}
+	if !unchanged(mt, stored) {
+		t.Fatal("expected the stored tree to be the active tree")
+	}
+}
+
+// BenchmarkMutate measures a create through the whole mutation path with the file store, copying and appending to the
+// active tree, storing it, anchoring its root in the TPM, signing its checkpoint and recording it in the audit log
+// Storing encodes the whole tree, so unlike the append the latency grows with the number of functions
+func BenchmarkMutate(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("leafs=%d", size), func(b *testing.B) {
+			useNewStore(b)
+			mt := merkleTree.NewTree()
+			for i := 0; i < size; i++ {
+				mt.AppendKeyedContent(fmt.Sprintf("default/fn-%d", i), []byte(fmt.Sprintf("spec-%d", i)))
+			}
+			if err := Restore(mt); err != nil {
+				b.Fatalf("failed to store the tree: %v", err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("default/appended-%d", i)
+				if _, err := Mutate(&audit.Entry{Operation: audit.OperationCreate}, appendKey(key, key)); err != nil {
+					b.Fatalf("mutation failed: %v", err)
+				}
+			}
+		})
+	}
+}
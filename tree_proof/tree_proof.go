@@ -0,0 +1,72 @@
+package tree_proof
+
+import (
+	"errors"
+	"fmt"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	treeManager "github.com/TruFaaS/TruFaaS/tree_manager"
+	"github.com/TruFaaS/TruFaaS/utils"
+	"net/http"
+	"strconv"
+)
+
+// ConsistencyProofHandler responds with the RFC 6962 consistency proof between the from and to tree sizes of the
+// active tree, to defaults to the current size. Auditors compare the returned roots with signed tree heads of
+// both sizes, so that a removed or reordered function registration is detected. The proof is generated from the
+// tree of the namespace query parameter if it is set and the tree is multi-tenant.
+func ConsistencyProofHandler(respWriter http.ResponseWriter, req *http.Request) {
+	errResponse := commonTypes.ErrorResponse{}
+	mt := treeManager.Snapshot()
+
+	query := req.URL.Query()
+	if namespace := query.Get(constants.NamespaceQueryParam); namespace != "" {
+		if !mt.IsMultiTenant() {
+			errResponse.StatusCode = http.StatusConflict
+			errResponse.ErrorMsg = "Namespace trees are only available for multi-tenant trees"
+			errResponse.ErrorCode = constants.ErrCodeNotMultiTenant
+			utils.SendErrorResponse(respWriter, errResponse)
+			return
+		}
+		namespaceTree, found := mt.GetTenant(namespace)
+		if !found {
+			errResponse.StatusCode = http.StatusNotFound
+			errResponse.ErrorMsg = "No functions registered in namespace " + namespace
+			utils.SendErrorResponse(respWriter, errResponse)
+			return
+		}
+		mt = namespaceTree
+	}
+	from, err := strconv.Atoi(query.Get(constants.FromQueryParam))
+	if err != nil {
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = "from must be a tree size"
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+	to, err := utils.ParseQueryInt(query.Get(constants.ToQueryParam), mt.LeafCount)
+	if err != nil {
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = "to must be a tree size"
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+
+	proof, err := mt.GenerateConsistencyProof(from, to)
+	if errors.Is(err, merkleTree.ErrNotAppendOnly) {
+		errResponse.StatusCode = http.StatusConflict
+		errResponse.ErrorMsg = "Consistency proofs are only available for append-only trees"
+		errResponse.ErrorCode = constants.ErrCodeNotAppendOnly
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+	if err != nil {
+		errResponse.StatusCode = http.StatusBadRequest
+		errResponse.ErrorMsg = fmt.Sprintf("tree sizes must satisfy 0 < from <= to <= %d", mt.LeafCount)
+		utils.SendErrorResponse(respWriter, errResponse)
+		return
+	}
+
+	utils.SendJSONResponse(respWriter, http.StatusOK, utils.ConvertConsistencyProof(proof))
+}
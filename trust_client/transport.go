@@ -0,0 +1,76 @@
+package trust_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// verdictKey is the context key of the verdict of a request sent by a Transport
+type verdictKey struct{}
+
+// UntrustedError is returned by a Transport when the component did not verify the invoked function
+type UntrustedError struct {
+	Verdict *Verdict
+}
+
+func (err *UntrustedError) Error() string {
+	return fmt.Sprintf("function %s failed trust verification", err.Verdict.Function)
+}
+
+// Transport is an http.RoundTripper for invocations of functions through a router that verifies the function with the
+// component and returns its trust protocol headers with the response of the function. It sends the trust protocol
+// headers with every request and only returns responses whose verdict is authenticated and trusted
+type Transport struct {
+	Client   *Client           // Client holds the identity key, suites and max age of the verification
+	Base     http.RoundTripper // Base sends the requests, http.DefaultTransport if nil
+	Function func(req *http.Request) (namespace string, name string)
+}
+
+// NewTransport returns a transport verifying the invocations with the client, the function resolves the invoked
+// function of a request, e.g. from its path
+func NewTransport(client *Client, function func(req *http.Request) (namespace string, name string)) *Transport {
+	return &Transport{Client: client, Function: function}
+}
+
+// RoundTrip sends the request with the trust protocol headers and authenticates the verdict of the response, which
+// VerdictOf returns. An *UntrustedError is returned if the function failed verification, the body is closed then
+func (transport *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	namespace, name := transport.Function(req)
+	verdict := new(Verdict)
+	// the request must not be modified, the headers and the verdict are set on a copy
+	req = req.Clone(context.WithValue(req.Context(), verdictKey{}, verdict))
+	exchange, err := transport.Client.newExchange(req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	authenticated, err := exchange.verify(resp.Header, namespace+"/"+name)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	*verdict = *authenticated
+	if !verdict.TrustVerified {
+		resp.Body.Close()
+		return nil, &UntrustedError{Verdict: verdict}
+	}
+	return resp, nil
+}
+
+// VerdictOf returns the authenticated verdict of a response returned by a Transport, nil for other responses
+func VerdictOf(resp *http.Response) *Verdict {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	verdict, _ := resp.Request.Context().Value(verdictKey{}).(*Verdict)
+	return verdict
+}
@@ -0,0 +1,333 @@
+package trust_client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
+	"github.com/TruFaaS/TruFaaS/constants"
+	functionSpec "github.com/TruFaaS/TruFaaS/function_spec"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	trustProtocol "github.com/TruFaaS/TruFaaS/trust_protocol"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAge is how far the timestamp of a verdict may be from the clock of the invoker when no MaxAge is set
+const DefaultMaxAge = time.Minute
+
+// nonceSize is the size of the random nonce sent with every verification
+const nonceSize = 16
+
+// Errors returned when a response cannot be authenticated, the verdict of such a response must not be trusted
+var (
+	ErrMissingHeaders   = errors.New("response has no trust protocol headers")
+	ErrUnexpectedSuite  = errors.New("response uses a suite that was not offered")
+	ErrInvalidSignature = errors.New("ephemeral public key is not signed by the identity key")
+	ErrInvalidMAC       = errors.New("MAC does not authenticate the verdict")
+	ErrStaleVerdict     = errors.New("verdict timestamp is outside the accepted age")
+	ErrSpecMismatch     = errors.New("verdict is for another spec than the one sent")
+)
+
+// Verdict is the authenticated result of a verification, every field except ErrorCode and InclusionProof is covered by
+// the MAC of the response
+type Verdict struct {
+	Function       string              // Function is the identity of the verified function, namespace/name
+	TrustVerified  bool                // TrustVerified is whether the function matches its registered trust value
+	Suite          trustProtocol.Suite // Suite is the suite the component chose
+	SpecHash       []byte              // SpecHash is the leaf hash of the verified spec, Verify checks it is the sent spec
+	MerkleRoot     []byte              // MerkleRoot is the root of the tree the function was verified against
+	Timestamp      time.Time           // Timestamp is when the component verified the function
+	KeyID          string              // KeyID identifies the identity key that signed the ephemeral public key
+	ErrorCode      string              // ErrorCode is the reason of a failed verification, it is not authenticated
+	InclusionProof *commonTypes.InclusionProof
+}
+
+// ResponseError is returned when the component refused a verification without a verdict, e.g. a malformed request
+type ResponseError struct {
+	StatusCode int
+	ErrorCode  string
+	ErrorMsg   string
+}
+
+func (err *ResponseError) Error() string {
+	return fmt.Sprintf("verification refused with %d %s: %s", err.StatusCode, err.ErrorCode, err.ErrorMsg)
+}
+
+// Client verifies functions with the component and authenticates the verdicts with the trust protocol
+type Client struct {
+	BaseURL     string                // BaseURL is the URL of the component, e.g. https://trufaas.trufaas:8080
+	HTTPClient  *http.Client          // HTTPClient sends the requests, http.DefaultClient if nil
+	IdentityKey crypto.PublicKey      // IdentityKey is the pinned identity key of the component
+	Suites      []trustProtocol.Suite // Suites are offered in the order of preference, the default suite if empty
+	MaxAge      time.Duration         // MaxAge is how old a verdict may be, DefaultMaxAge if zero
+}
+
+// NewClient returns a client of the component at the base URL that trusts verdicts signed by the identity key
+func NewClient(baseURL string, identityKey crypto.PublicKey) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), IdentityKey: identityKey}
+}
+
+// FetchIdentityKey returns the identity key published by the component at the base URL. The key is only authenticated
+// by the connection it is fetched over, so it is checked against the key id if one is given, e.g. from the deployment
+func FetchIdentityKey(ctx context.Context, httpClient *http.Client, baseURL string, keyID string) (crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/identity/key", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClientOrDefault(httpClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch identity key, status %d", resp.StatusCode)
+	}
+
+	var keyResponse commonTypes.IdentityKeyResponse
+	if err = json.NewDecoder(resp.Body).Decode(&keyResponse); err != nil {
+		return nil, err
+	}
+	der, err := hex.DecodeString(keyResponse.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	fetchedKeyID := sha256.Sum256(der)
+	if keyID != "" && hex.EncodeToString(fetchedKeyID[:]) != strings.ToLower(keyID) {
+		return nil, fmt.Errorf("identity key %x does not match key id %s", fetchedKeyID, keyID)
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
+
+// Verify sends the function, e.g. a function_spec.Function, to /fn/verify and returns the authenticated verdict. The
+// function is identified by the function_information of its JSON encoding, and the verdict must be for the leaf hash
+// of its canonical bytes, so that a verdict for a spec replaced on the way is refused. A verdict is returned for
+// failed verifications as well, errors mean that there is no verdict that can be trusted
+func (client *Client) Verify(ctx context.Context, function interface{}) (*Verdict, error) {
+	body, err := json.Marshal(function)
+	if err != nil {
+		return nil, err
+	}
+	var spec functionSpec.Function
+	if err = json.Unmarshal(body, &spec); err != nil {
+		return nil, err
+	}
+	if spec.FunctionInformation.Name == "" {
+		return nil, errors.New("function has no function_information.function_name")
+	}
+	specBytes, err := spec.CanonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.BaseURL+"/fn/verify", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", constants.ContentTypeJSON)
+	exchange, err := client.newExchange(req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClientOrDefault(client.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var responseBody struct {
+		commonTypes.ErrorResponse
+		InclusionProof *commonTypes.InclusionProof `json:"inclusion_proof,omitempty"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&responseBody)
+	if resp.Header.Get(constants.MACHeader) == "" && resp.StatusCode != http.StatusOK {
+		return nil, &ResponseError{StatusCode: resp.StatusCode, ErrorCode: responseBody.ErrorCode, ErrorMsg: responseBody.ErrorMsg}
+	}
+
+	verdict, err := exchange.verify(resp.Header, spec.Identity())
+	if err != nil {
+		return nil, err
+	}
+	if !isLeafHashOf(verdict.SpecHash, specBytes) {
+		return nil, fmt.Errorf("%w: %x", ErrSpecMismatch, verdict.SpecHash)
+	}
+	verdict.ErrorCode = responseBody.ErrorCode
+	verdict.InclusionProof = responseBody.InclusionProof
+	return verdict, nil
+}
+
+// exchange is the state of the invoker in one run of the trust protocol
+type exchange struct {
+	client     *Client
+	suites     []trustProtocol.Suite // suites are the offered suites, which share one key agreement
+	privateKey *ecdh.PrivateKey      // privateKey is the ephemeral key of the invoker
+	nonce      []byte
+}
+
+// newExchange generates the ephemeral key and the nonce of a run of the trust protocol and sets the request headers
+func (client *Client) newExchange(header http.Header) (*exchange, error) {
+	suites := client.Suites
+	if len(suites) == 0 {
+		suites = []trustProtocol.Suite{trustProtocol.DefaultSuite}
+	}
+	exchange := &exchange{client: client, suites: suites, nonce: make([]byte, nonceSize)}
+	if _, err := rand.Read(exchange.nonce); err != nil {
+		return nil, err
+	}
+
+	// one key is sent, so all offered suites must share the key agreement of the preferred one
+	keyAgreement := suites[0].KeyAgreement
+	names := make([]string, 0, len(suites))
+	for _, suite := range suites {
+		if suite.KeyAgreement != keyAgreement {
+			return nil, fmt.Errorf("offered suites use the key agreements %s and %s, only one key can be sent", keyAgreement, suite.KeyAgreement)
+		}
+		names = append(names, suite.String())
+	}
+	curve := keyAgreement.Curve()
+	if curve == nil {
+		return nil, fmt.Errorf("unsupported key agreement %q", keyAgreement)
+	}
+	privateKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	exchange.privateKey = privateKey
+
+	header.Set(constants.InvokerPublicKeyHeader, hex.EncodeToString(trustProtocol.EncodePublicKey(privateKey.PublicKey())))
+	header.Set(constants.InvokerSuitesHeader, strings.Join(names, ", "))
+	header.Set(constants.InvokerNonceHeader, hex.EncodeToString(exchange.nonce))
+	return exchange, nil
+}
+
+// verify authenticates the trust protocol headers of the response for the function and returns the verdict
+func (exchange *exchange) verify(header http.Header, function string) (*Verdict, error) {
+	for _, name := range []string{constants.SuiteHeader, constants.ExternalComponentPublicKeyHeader, constants.MACHeader,
+		constants.KeySignatureHeader, constants.TrustVerificationHeader, constants.TimestampHeader} {
+		if header.Get(name) == "" {
+			return nil, fmt.Errorf("%w: %s is missing", ErrMissingHeaders, name)
+		}
+	}
+
+	suite, err := trustProtocol.ParseSuite(header.Get(constants.SuiteHeader))
+	if err != nil || !exchange.offered(suite) {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedSuite, header.Get(constants.SuiteHeader))
+	}
+	privateKey := exchange.privateKey
+	serverPublicKey, err := trustProtocol.ParsePublicKey(header.Get(constants.ExternalComponentPublicKeyHeader), suite.KeyAgreement)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ephemeral key of the component must be signed for the suite and the key of this invoker by the pinned identity key
+	signature, err := hex.DecodeString(header.Get(constants.KeySignatureHeader))
+	signedBytes := trustProtocol.EphemeralKeySignedBytes(suite, trustProtocol.EncodePublicKey(serverPublicKey), trustProtocol.EncodePublicKey(privateKey.PublicKey()))
+	if err != nil || !identity.Verify(exchange.client.IdentityKey, signedBytes, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	sharedSecret, err := privateKey.ECDH(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := trustProtocol.ParseMACHeader(header.Get(constants.MACHeader))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMAC, err)
+	}
+	transcript, err := responseTranscript(header, function, exchange.nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMAC, err)
+	}
+	if !hmac.Equal(mac, suite.ComputeMAC(suite.DeriveMACKey(sharedSecret), transcript)) {
+		return nil, ErrInvalidMAC
+	}
+
+	timestamp := time.UnixMilli(transcript.Timestamp)
+	if age := time.Since(timestamp); age > exchange.client.maxAge() || age < -exchange.client.maxAge() {
+		return nil, fmt.Errorf("%w: verified at %s", ErrStaleVerdict, timestamp)
+	}
+	return &Verdict{
+		Function:      function,
+		TrustVerified: transcript.TrustVerified,
+		Suite:         suite,
+		SpecHash:      transcript.SpecHash,
+		MerkleRoot:    transcript.MerkleRoot,
+		Timestamp:     timestamp,
+		KeyID:         header.Get(constants.KeyIDHeader),
+	}, nil
+}
+
+// offered returns whether the suite is one of the suites offered by the invoker
+func (exchange *exchange) offered(suite trustProtocol.Suite) bool {
+	for _, offeredSuite := range exchange.suites {
+		if offeredSuite == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// responseTranscript returns the transcript of the response from its headers, the function and the nonce of the invoker
+func responseTranscript(header http.Header, function string, nonce []byte) (*trustProtocol.Transcript, error) {
+	trustVerified, err := strconv.ParseBool(header.Get(constants.TrustVerificationHeader))
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := strconv.ParseInt(header.Get(constants.TimestampHeader), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	specHash, err := hex.DecodeString(header.Get(constants.SpecHashHeader))
+	if err != nil {
+		return nil, err
+	}
+	merkleRoot, err := hex.DecodeString(header.Get(constants.MerkleRootHeader))
+	if err != nil {
+		return nil, err
+	}
+	return &trustProtocol.Transcript{
+		TrustVerified: trustVerified,
+		Function:      function,
+		SpecHash:      specHash,
+		MerkleRoot:    merkleRoot,
+		Nonce:         nonce,
+		Timestamp:     timestamp,
+	}, nil
+}
+
+// isLeafHashOf returns whether the leaf hash is of the canonical bytes of a spec, with any hash algorithm the tree of
+// the component may use
+func isLeafHashOf(leafHash []byte, specBytes []byte) bool {
+	for _, algorithm := range merkleTree.HashAlgorithms {
+		if hmac.Equal(leafHash, merkleTree.HashLeaf(algorithm, specBytes)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (client *Client) maxAge() time.Duration {
+	if client.MaxAge == 0 {
+		return DefaultMaxAge
+	}
+	return client.MaxAge
+}
+
+func httpClientOrDefault(httpClient *http.Client) *http.Client {
+	if httpClient == nil {
+		return http.DefaultClient
+	}
+	return httpClient
+}
@@ -0,0 +1,324 @@
+package trust_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/TruFaaS/TruFaaS/constants"
+	functionSpec "github.com/TruFaaS/TruFaaS/function_spec"
+	"github.com/TruFaaS/TruFaaS/identity"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	trustProtocol "github.com/TruFaaS/TruFaaS/trust_protocol"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRoot is the merkle root the fake component verifies against
+var testRoot = bytes.Repeat([]byte{0xab}, 32)
+
+func TestMain(m *testing.M) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err == nil {
+		err = identity.InitializeWithSigner(key)
+	}
+	if err != nil {
+		fmt.Println("failed to initialize identity key:", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// functionJSON returns the request body of the function with the given name in the default namespace and build command
+func functionJSON(name string, buildcmd string) string {
+	return fmt.Sprintf(`{"function_information":{"function_name":%q,"function_namespace":"default"},"package_information":{"package_spec":{"buildcmd":%q}}}`, name, buildcmd)
+}
+
+// fakeComponent verifies functions against the leaf hashes of registered specs, and signs and authenticates its
+// verdicts with the trust protocol as the component does
+type fakeComponent struct {
+	registered map[string][]byte // registered maps the identity of a function to the leaf hash of its spec
+}
+
+// newFakeComponent returns a component with the functions of the bodies registered
+func newFakeComponent(t *testing.T, bodies ...string) *fakeComponent {
+	component := &fakeComponent{registered: make(map[string][]byte)}
+	for _, body := range bodies {
+		var function functionSpec.Function
+		if err := json.Unmarshal([]byte(body), &function); err != nil {
+			t.Fatalf("invalid function: %v", err)
+		}
+		fnByteArr, err := function.CanonicalBytes()
+		if err != nil {
+			t.Fatalf("failed to encode canonical bytes: %v", err)
+		}
+		component.registered[function.Identity()] = merkleTree.HashLeaf(merkleTree.SHA256, fnByteArr)
+	}
+	return component
+}
+
+// verify verifies the function with the trust protocol headers of the request and sets the headers of the verdict
+func (component *fakeComponent) verify(respWriter http.ResponseWriter, header http.Header, body []byte) bool {
+	suite, err := trustProtocol.NegotiateSuite(header.Get(constants.InvokerSuitesHeader))
+	if err != nil {
+		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	clientPublicKey, err := trustProtocol.ParsePublicKey(header.Get(constants.InvokerPublicKeyHeader), suite.KeyAgreement)
+	if err != nil {
+		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	tp, err := (&trustProtocol.TrustProtocol{}).GetProtocolInstance(suite, clientPublicKey)
+	if err != nil {
+		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	nonce, _ := trustProtocol.ParseNonce(header.Get(constants.InvokerNonceHeader))
+
+	var function functionSpec.Function
+	if err = json.Unmarshal(body, &function); err != nil {
+		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	fnByteArr, _ := function.CanonicalBytes()
+	specHash := merkleTree.HashLeaf(merkleTree.SHA256, fnByteArr)
+	registered, found := component.registered[function.Identity()]
+	tp.GenerateMAC(&trustProtocol.Transcript{
+		TrustVerified: found && bytes.Equal(registered, specHash),
+		Function:      function.Identity(),
+		SpecHash:      specHash,
+		MerkleRoot:    testRoot,
+		Nonce:         nonce,
+		Timestamp:     time.Now().UnixMilli(),
+	})
+	tp.SetResponseHeaders(respWriter)
+	return tp.Transcript.TrustVerified
+}
+
+// ServeHTTP verifies the function of a request to /fn/verify, other paths /<name> are invocations of the function name
+// with the spec holding no build command, which respond with the verdict headers and the response of the function
+func (component *fakeComponent) ServeHTTP(respWriter http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/fn/verify" {
+		body, _ := io.ReadAll(req.Body)
+		if !component.verify(respWriter, req.Header, body) {
+			respWriter.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	component.verify(respWriter, req.Header, []byte(functionJSON(strings.TrimPrefix(req.URL.Path, "/"), "")))
+	io.WriteString(respWriter, "hello from the function")
+}
+
+// proxyServer serves the component, the request is changed by tamperRequest and the headers of its responses by
+// tamperHeader first if they are not nil
+func proxyServer(t *testing.T, component http.Handler, tamperRequest func(req *http.Request), tamperHeader func(header http.Header)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		if tamperRequest != nil {
+			tamperRequest(req)
+		}
+		recorder := httptest.NewRecorder()
+		component.ServeHTTP(recorder, req)
+		if tamperHeader != nil {
+			tamperHeader(recorder.Header())
+		}
+		for name, values := range recorder.Header() {
+			respWriter.Header()[name] = values
+		}
+		respWriter.WriteHeader(recorder.Code)
+		respWriter.Write(recorder.Body.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestClient returns a client of the server pinning the identity key of the component
+func newTestClient(server *httptest.Server) *Client {
+	return NewClient(server.URL, identity.GetSigner().Public())
+}
+
+// verify verifies the function with the client
+func verify(client *Client, body string) (*Verdict, error) {
+	return client.Verify(context.Background(), json.RawMessage(body))
+}
+
+func TestVerify(t *testing.T) {
+	body := functionJSON("hello", "./build.sh")
+	client := newTestClient(proxyServer(t, newFakeComponent(t, body), nil, nil))
+
+	verdict, err := verify(client, body)
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if !verdict.TrustVerified || verdict.Function != "default/hello" || !bytes.Equal(verdict.MerkleRoot, testRoot) {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+
+	// a spec that was not registered fails verification with an authenticated verdict
+	verdict, err = verify(client, functionJSON("hello", "./other.sh"))
+	if err != nil || verdict.TrustVerified {
+		t.Fatalf("unexpected verdict for a changed spec: %v %+v", err, verdict)
+	}
+
+	// a function without a name cannot be identified
+	if _, err = verify(client, `{"function_information":{}}`); err == nil {
+		t.Fatalf("function without a name was sent")
+	}
+}
+
+func TestVerifyRejectsForgedVerdicts(t *testing.T) {
+	body := functionJSON("forged", "./build.sh")
+	component := newFakeComponent(t, body)
+
+	// a verdict of another verification, whose signature and MAC are valid for another invoker key
+	var captured http.Header
+	verify(newTestClient(proxyServer(t, component, nil, func(header http.Header) { captured = header.Clone() })), body)
+	otherKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		tamper   func(header http.Header)
+		expected error
+	}{
+		{"tampered MAC", func(header http.Header) {
+			mac := []byte(header.Get(constants.MACHeader))
+			mac[len(mac)-1] ^= 1
+			header.Set(constants.MACHeader, string(mac))
+		}, ErrInvalidMAC},
+		{"flipped verdict", func(header http.Header) {
+			header.Set(constants.TrustVerificationHeader, "false")
+		}, ErrInvalidMAC},
+		{"replaced merkle root", func(header http.Header) {
+			header.Set(constants.MerkleRootHeader, strings.Repeat("00", 32))
+		}, ErrInvalidMAC},
+		{"replaced spec hash", func(header http.Header) {
+			header.Set(constants.SpecHashHeader, strings.Repeat("00", 32))
+		}, ErrInvalidMAC},
+		{"swapped ephemeral key", func(header http.Header) {
+			header.Set(constants.ExternalComponentPublicKeyHeader, hex.EncodeToString(trustProtocol.EncodePublicKey(otherKey.PublicKey())))
+		}, ErrInvalidSignature},
+		{"replayed ephemeral key and signature", func(header http.Header) {
+			for _, name := range []string{constants.ExternalComponentPublicKeyHeader, constants.KeySignatureHeader, constants.MACHeader, constants.TimestampHeader} {
+				header.Set(name, captured.Get(name))
+			}
+		}, ErrInvalidSignature},
+		{"swapped signature", func(header http.Header) {
+			header.Set(constants.KeySignatureHeader, captured.Get(constants.KeySignatureHeader))
+		}, ErrInvalidSignature},
+		{"suite not offered", func(header http.Header) {
+			header.Set(constants.SuiteHeader, "P-256+HMAC-SHA512")
+		}, ErrUnexpectedSuite},
+		{"missing MAC", func(header http.Header) {
+			header.Del(constants.MACHeader)
+			header.Set(constants.TrustVerificationHeader, "true")
+		}, ErrMissingHeaders},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict, err := verify(newTestClient(proxyServer(t, component, nil, test.tamper)), body)
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("expected %v, found %v %+v", test.expected, err, verdict)
+			}
+		})
+	}
+
+	// a verdict signed by another identity key than the pinned one
+	client := newTestClient(proxyServer(t, component, nil, nil))
+	otherIdentityKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	client.IdentityKey = otherIdentityKey.Public()
+	if _, err = verify(client, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected %v for another identity key, found %v", ErrInvalidSignature, err)
+	}
+
+	// a verdict delivered later than the accepted age, e.g. a delayed or replayed response
+	client = newTestClient(proxyServer(t, component, nil, func(http.Header) { time.Sleep(20 * time.Millisecond) }))
+	client.MaxAge = 10 * time.Millisecond
+	if _, err = verify(client, body); !errors.Is(err, ErrStaleVerdict) {
+		t.Fatalf("expected %v, found %v", ErrStaleVerdict, err)
+	}
+}
+
+func TestVerifyRejectsVerdictForSwappedSpec(t *testing.T) {
+	// the registered spec of the function runs another build than the spec the invoker expects
+	malicious := functionJSON("swapped", "./malicious.sh")
+	expected := functionJSON("swapped", "./build.sh")
+
+	// the proxy replaces the spec of the request by the registered one, whose verdict is trusted and authenticated
+	client := newTestClient(proxyServer(t, newFakeComponent(t, malicious), func(req *http.Request) {
+		req.Body = io.NopCloser(strings.NewReader(malicious))
+		req.ContentLength = int64(len(malicious))
+	}, nil))
+	verdict, err := verify(client, expected)
+	if !errors.Is(err, ErrSpecMismatch) {
+		t.Fatalf("expected %v for a swapped spec, found %v %+v", ErrSpecMismatch, err, verdict)
+	}
+
+	// the hash algorithm of the tree is not known to the invoker, a verdict of any supported algorithm is accepted
+	fnByteArr, _ := decodeFunction(t, expected).CanonicalBytes()
+	for _, algorithm := range merkleTree.HashAlgorithms {
+		if !isLeafHashOf(merkleTree.HashLeaf(algorithm, fnByteArr), fnByteArr) {
+			t.Errorf("leaf hash of %s not accepted", algorithm)
+		}
+	}
+	if isLeafHashOf(merkleTree.HashLeaf(merkleTree.SHA256, []byte(malicious)), fnByteArr) {
+		t.Errorf("leaf hash of another spec accepted")
+	}
+}
+
+// decodeFunction decodes the request body of a function
+func decodeFunction(t *testing.T, body string) functionSpec.Function {
+	var function functionSpec.Function
+	if err := json.Unmarshal([]byte(body), &function); err != nil {
+		t.Fatalf("failed to decode function: %v", err)
+	}
+	return function
+}
+
+func TestTransport(t *testing.T) {
+	server := proxyServer(t, newFakeComponent(t, functionJSON("invoked", "")), nil, nil)
+	transport := NewTransport(newTestClient(server), func(req *http.Request) (string, string) {
+		return "default", strings.TrimPrefix(req.URL.Path, "/")
+	})
+	httpClient := &http.Client{Transport: transport}
+
+	resp, err := httpClient.Get(server.URL + "/invoked")
+	if err != nil {
+		t.Fatalf("invocation failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	verdict := VerdictOf(resp)
+	if string(body) != "hello from the function" || verdict == nil || !verdict.TrustVerified || verdict.Function != "default/invoked" {
+		t.Fatalf("unexpected response %q with verdict %+v", body, verdict)
+	}
+
+	// the response of a function that fails verification is not returned
+	_, err = httpClient.Get(server.URL + "/not-registered")
+	var untrusted *UntrustedError
+	if !errors.As(err, &untrusted) || untrusted.Verdict.TrustVerified || untrusted.Verdict.Function != "default/not-registered" {
+		t.Fatalf("expected an untrusted error, found %v", err)
+	}
+
+	// the verdict of another function is not accepted for the invoked one
+	transport.Function = func(req *http.Request) (string, string) { return "default", "other" }
+	if _, err = httpClient.Get(server.URL + "/invoked"); !errors.Is(err, ErrInvalidMAC) {
+		t.Fatalf("expected %v for the verdict of another function, found %v", ErrInvalidMAC, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/identity"
+	trustClient "github.com/TruFaaS/TruFaaS/trust_client"
+	trustProtocol "github.com/TruFaaS/TruFaaS/trust_protocol"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// proxyServer serves the router, the headers of its responses are changed by tamper first if it is not nil
+func proxyServer(t *testing.T, tamper func(header http.Header)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		recorder := httptest.NewRecorder()
+		testRouter.Router.ServeHTTP(recorder, req)
+		if tamper != nil {
+			tamper(recorder.Header())
+		}
+		for name, values := range recorder.Header() {
+			respWriter.Header()[name] = values
+		}
+		respWriter.WriteHeader(recorder.Code)
+		respWriter.Write(recorder.Body.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// registerFunction registers the function with the router
+func registerFunction(t *testing.T, name string) {
+	server := proxyServer(t, nil)
+	if resp, err := post(server, "/fn/create", functionJSON(name)); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create of %s failed: %v %v", name, resp, err)
+	}
+}
+
+// newTrustClient returns a client of the server pinning the identity key of the component
+func newTrustClient(server *httptest.Server) *trustClient.Client {
+	return trustClient.NewClient(server.URL, identity.GetSigner().Public())
+}
+
+// verify verifies the function with the client
+func verify(client *trustClient.Client, name string) (*trustClient.Verdict, error) {
+	return client.Verify(context.Background(), json.RawMessage(functionJSON(name)))
+}
+
+func TestTrustClientVerify(t *testing.T) {
+	registerFunction(t, "client-hello")
+	client := newTrustClient(proxyServer(t, nil))
+	keyID, _ := identity.KeyID()
+
+	verdict, err := verify(client, "client-hello")
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if !verdict.TrustVerified || verdict.Function != "default/client-hello" || verdict.KeyID != keyID || verdict.Suite != trustProtocol.DefaultSuite {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+	if len(verdict.SpecHash) == 0 || len(verdict.MerkleRoot) == 0 {
+		t.Fatalf("verdict without spec hash or merkle root %+v", verdict)
+	}
+
+	// a failed verification has an authenticated verdict as well
+	verdict, err = verify(client, "client-unknown")
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if verdict.TrustVerified || verdict.ErrorCode != constants.ErrCodeUnknownFunction {
+		t.Fatalf("unexpected verdict for an unregistered function %+v", verdict)
+	}
+
+	// the suite is negotiated in the order of preference of the invoker
+	for _, name := range []string{"X25519+HMAC-SHA256", "P-384+HMAC-SHA384", "P-521+HMAC-SHA512"} {
+		suite, _ := trustProtocol.ParseSuite(name)
+		client.Suites = []trustProtocol.Suite{suite}
+		if verdict, err = verify(client, "client-hello"); err != nil || !verdict.TrustVerified || verdict.Suite != suite {
+			t.Fatalf("verification with %s failed: %v %+v", name, err, verdict)
+		}
+	}
+}
+
+// TestTrustClientRejectsSwappedSpec checks that the verdict of the router for a spec replaced on the way is refused,
+// the cases of forged verdicts are tested in the trust_client package
+func TestTrustClientRejectsSwappedSpec(t *testing.T) {
+	registerFunction(t, "client-swapped")
+	swapped := functionJSON("client-swapped")
+	server := httptest.NewServer(http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		req.Body = io.NopCloser(strings.NewReader(swapped))
+		req.ContentLength = int64(len(swapped))
+		testRouter.Router.ServeHTTP(respWriter, req)
+	}))
+	t.Cleanup(server.Close)
+
+	// the router verifies the registered spec, which is not the spec the invoker sent
+	expected := `{"function_information":{"function_name":"client-swapped","function_namespace":"default"},"package_information":{"package_spec":{"buildcmd":"./build.sh"}}}`
+	verdict, err := newTrustClient(server).Verify(context.Background(), json.RawMessage(expected))
+	if !errors.Is(err, trustClient.ErrSpecMismatch) {
+		t.Fatalf("expected %v, found %v %+v", trustClient.ErrSpecMismatch, err, verdict)
+	}
+}
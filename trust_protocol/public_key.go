@@ -0,0 +1,126 @@
+package trust_protocol
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPublicKey is returned when the public key of an invoker is malformed or not a point of the curve
+var ErrInvalidPublicKey = errors.New("invalid invoker public key")
+
+// ParsePublicKey parses the ECDH public key of an invoker for the key agreement, which is either a PEM encoded PKIX
+// public key or hex encoded as a PKIX public key or as the raw key: the X | Y coordinates or an uncompressed or
+// compressed SEC1 point for the NIST curves, the 32 byte u-coordinate for X25519. Points of the NIST curves are checked
+// to be on the curve, so that an invoker cannot learn the ephemeral private key with invalid points, and X25519 keys of
+// low order are refused, as no secret is agreed on with them
+func ParsePublicKey(encoded string, keyAgreement KeyAgreement) (*ecdh.PublicKey, error) {
+	curve := keyAgreement.Curve()
+	if curve == nil {
+		return nil, fmt.Errorf("unsupported key agreement %q", keyAgreement)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if strings.HasPrefix(encoded, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(encoded))
+		if block == nil || block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("%w: no PEM encoded public key found", ErrInvalidPublicKey)
+		}
+		return parsePKIXPublicKey(block.Bytes, keyAgreement)
+	}
+
+	keyBytes, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not hex encoded", ErrInvalidPublicKey)
+	}
+	if keyAgreement == X25519 {
+		if len(keyBytes) == 32 {
+			return newPublicKey(keyAgreement, keyBytes)
+		}
+	} else {
+		ellipticCurve := keyAgreement.ellipticCurve()
+		size := (ellipticCurve.Params().BitSize + 7) / 8
+		switch {
+		case len(keyBytes) == 2*size:
+			// the X | Y coordinates are an uncompressed SEC1 point without its prefix
+			return newPublicKey(keyAgreement, append([]byte{4}, keyBytes...))
+		case len(keyBytes) == 1+2*size && keyBytes[0] == 4:
+			return newPublicKey(keyAgreement, keyBytes)
+		case len(keyBytes) == 1+size && (keyBytes[0] == 2 || keyBytes[0] == 3):
+			x, y := elliptic.UnmarshalCompressed(ellipticCurve, keyBytes)
+			if x == nil {
+				return nil, fmt.Errorf("%w: not a point on %s", ErrInvalidPublicKey, keyAgreement)
+			}
+			return newPublicKey(keyAgreement, elliptic.Marshal(ellipticCurve, x, y))
+		}
+	}
+	if len(keyBytes) > 0 && keyBytes[0] == 0x30 {
+		// an ASN.1 SEQUENCE, the PKIX SubjectPublicKeyInfo
+		return parsePKIXPublicKey(keyBytes, keyAgreement)
+	}
+	return nil, fmt.Errorf("%w: unsupported encoding of %d bytes for %s", ErrInvalidPublicKey, len(keyBytes), keyAgreement)
+}
+
+// lowOrderCheckKey detects X25519 keys of low order, the shared secret of such a key is all zero for every private
+// key, which ECDH refuses
+var lowOrderCheckKey, _ = ecdh.X25519().NewPrivateKey(bytes.Repeat([]byte{0x5a}, 32))
+
+// newPublicKey returns the public key of the raw key, which must be a point of the curve
+func newPublicKey(keyAgreement KeyAgreement, rawKey []byte) (*ecdh.PublicKey, error) {
+	publicKey, err := keyAgreement.Curve().NewPublicKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a point on %s", ErrInvalidPublicKey, keyAgreement)
+	}
+	return checkOrder(publicKey)
+}
+
+// checkOrder refuses an X25519 key of low order, e.g. the all-zero key, with which no secret is agreed on
+func checkOrder(publicKey *ecdh.PublicKey) (*ecdh.PublicKey, error) {
+	if publicKey.Curve() != ecdh.X25519() {
+		return publicKey, nil
+	}
+	if _, err := lowOrderCheckKey.ECDH(publicKey); err != nil {
+		return nil, fmt.Errorf("%w: X25519 key of low order", ErrInvalidPublicKey)
+	}
+	return publicKey, nil
+}
+
+// parsePKIXPublicKey returns the ECDH public key of the PKIX encoding, which must be a point of the curve
+func parsePKIXPublicKey(der []byte, keyAgreement KeyAgreement) (*ecdh.PublicKey, error) {
+	// the point is checked to be on the curve when it is parsed
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	var ecdhPublicKey *ecdh.PublicKey
+	switch key := publicKey.(type) {
+	case *ecdh.PublicKey:
+		ecdhPublicKey = key
+	case *ecdsa.PublicKey:
+		if ecdhPublicKey, err = key.ECDH(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: not an elliptic curve key", ErrInvalidPublicKey)
+	}
+	if ecdhPublicKey.Curve() != keyAgreement.Curve() {
+		return nil, fmt.Errorf("%w: key on %s, expected %s", ErrInvalidPublicKey, ecdhPublicKey.Curve(), keyAgreement)
+	}
+	return checkOrder(ecdhPublicKey)
+}
+
+// EncodePublicKey returns the raw public key, the X | Y coordinates for the NIST curves, each padded to the byte size
+// of the curve, and the u-coordinate for X25519
+func EncodePublicKey(publicKey *ecdh.PublicKey) []byte {
+	if publicKey.Curve() == ecdh.X25519() {
+		return publicKey.Bytes()
+	}
+	// the uncompressed SEC1 point without its prefix
+	return publicKey.Bytes()[1:]
+}
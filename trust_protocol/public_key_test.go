@@ -0,0 +1,129 @@
+package trust_protocol
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// offCurveX returns the smallest x coordinate that is not the x coordinate of any point of the curve
+func offCurveX(curve elliptic.Curve) *big.Int {
+	params := curve.Params()
+	for x := big.NewInt(1); ; x.Add(x, big.NewInt(1)) {
+		// y² = x³ - 3x + b has no solution if the right side is not a square
+		rhs := new(big.Int).Exp(x, big.NewInt(3), params.P)
+		rhs.Sub(rhs, new(big.Int).Mul(big.NewInt(3), x))
+		rhs.Add(rhs, params.B)
+		rhs.Mod(rhs, params.P)
+		if new(big.Int).ModSqrt(rhs, params.P) == nil {
+			return x
+		}
+	}
+}
+
+// pkixKey returns the PKIX encoding of the public key
+func pkixKey(t *testing.T, publicKey interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("failed to encode the public key: %v", err)
+	}
+	return der
+}
+
+func TestParsePublicKey(t *testing.T) {
+	p256Key, _ := ecdh.P256().GenerateKey(rand.Reader)
+	p384Key, _ := ecdh.P384().GenerateKey(rand.Reader)
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	uncompressed := p256Key.PublicKey().Bytes()
+	x, y := elliptic.Unmarshal(elliptic.P256(), uncompressed)
+	compressed := elliptic.MarshalCompressed(elliptic.P256(), x, y)
+	offCurve := append([]byte{}, uncompressed...)
+	offCurve[len(offCurve)-1] ^= 0x01
+	offCurveCompressed := append([]byte{2}, offCurveX(elliptic.P256()).FillBytes(make([]byte, 32))...)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixKey(t, p256Key.PublicKey())}))
+
+	// a point of order 8 and the points 0 and 1 of Curve25519, with which every shared secret is all zero
+	lowOrder := "e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800"
+	zero := strings.Repeat("00", 32)
+	one := "01" + strings.Repeat("00", 31)
+
+	valid := []struct {
+		name         string
+		encoded      string
+		keyAgreement KeyAgreement
+		expected     *ecdh.PublicKey
+	}{
+		{"X | Y coordinates", hex.EncodeToString(uncompressed[1:]), P256, p256Key.PublicKey()},
+		{"uncompressed SEC1", hex.EncodeToString(uncompressed), P256, p256Key.PublicKey()},
+		{"compressed SEC1", hex.EncodeToString(compressed), P256, p256Key.PublicKey()},
+		{"PKIX of an ECDH key", hex.EncodeToString(pkixKey(t, p256Key.PublicKey())), P256, p256Key.PublicKey()},
+		{"PEM", pemKey, P256, p256Key.PublicKey()},
+		{"PEM with surrounding whitespace", "\n  " + pemKey + "  \n", P256, p256Key.PublicKey()},
+		{"upper case hex", strings.ToUpper(hex.EncodeToString(uncompressed)), P256, p256Key.PublicKey()},
+		{"P-384 X | Y coordinates", hex.EncodeToString(p384Key.PublicKey().Bytes()[1:]), P384, p384Key.PublicKey()},
+		{"X25519 u-coordinate", hex.EncodeToString(x25519Key.PublicKey().Bytes()), X25519, x25519Key.PublicKey()},
+		{"X25519 PKIX", hex.EncodeToString(pkixKey(t, x25519Key.PublicKey())), X25519, x25519Key.PublicKey()},
+	}
+	for _, test := range valid {
+		t.Run(test.name, func(t *testing.T) {
+			publicKey, err := ParsePublicKey(test.encoded, test.keyAgreement)
+			if err != nil {
+				t.Fatalf("expected the key to be parsed, found %v", err)
+			}
+			if !publicKey.Equal(test.expected) {
+				t.Fatalf("expected %x, found %x", test.expected.Bytes(), publicKey.Bytes())
+			}
+		})
+	}
+
+	// the ECDSA encoding of a P-256 key is accepted for the key agreement as well
+	if _, err := ParsePublicKey(hex.EncodeToString(pkixKey(t, &ecdsaKey.PublicKey)), P256); err != nil {
+		t.Fatalf("expected the PKIX ECDSA key to be parsed, found %v", err)
+	}
+
+	invalid := []struct {
+		name         string
+		encoded      string
+		keyAgreement KeyAgreement
+	}{
+		{"empty", "", P256},
+		{"short", "04ab", P256},
+		{"odd length hex", hex.EncodeToString(uncompressed)[1:], P256},
+		{"not hex", "zz" + hex.EncodeToString(uncompressed)[2:], P256},
+		{"off-curve X | Y coordinates", hex.EncodeToString(offCurve[1:]), P256},
+		{"off-curve uncompressed SEC1", hex.EncodeToString(offCurve), P256},
+		{"off-curve compressed SEC1", hex.EncodeToString(offCurveCompressed), P256},
+		{"unknown SEC1 prefix", "05" + hex.EncodeToString(uncompressed[1:]), P256},
+		{"truncated PKIX", hex.EncodeToString(pkixKey(t, p256Key.PublicKey()))[:60], P256},
+		{"PEM of another type", strings.ReplaceAll(pemKey, "PUBLIC KEY", "CERTIFICATE"), P256},
+		{"P-384 key for P-256", hex.EncodeToString(pkixKey(t, p384Key.PublicKey())), P256},
+		{"P-384 point for P-256", hex.EncodeToString(p384Key.PublicKey().Bytes()), P256},
+		{"X25519 key for P-256", hex.EncodeToString(pkixKey(t, x25519Key.PublicKey())), P256},
+		{"P-256 key for X25519", hex.EncodeToString(pkixKey(t, p256Key.PublicKey())), X25519},
+		{"short X25519", hex.EncodeToString(x25519Key.PublicKey().Bytes()[1:]), X25519},
+		{"all-zero X25519", zero, X25519},
+		{"X25519 point one", one, X25519},
+		{"low order X25519", lowOrder, X25519},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParsePublicKey(test.encoded, test.keyAgreement); !errors.Is(err, ErrInvalidPublicKey) {
+				t.Fatalf("expected %v, found %v", ErrInvalidPublicKey, err)
+			}
+		})
+	}
+
+	if _, err := ParsePublicKey(hex.EncodeToString(uncompressed), KeyAgreement("P-192")); err == nil {
+		t.Fatal("expected an unsupported key agreement to be refused")
+	}
+}
@@ -0,0 +1,137 @@
+package trust_protocol
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"hash"
+	"io"
+	"strings"
+)
+
+// KeyAgreement represents the ECDH function the invoker and the component agree on the shared secret with
+type KeyAgreement string
+
+// Supported key agreements
+const (
+	P256   KeyAgreement = "P-256"
+	P384   KeyAgreement = "P-384"
+	P521   KeyAgreement = "P-521"
+	X25519 KeyAgreement = "X25519"
+)
+
+// MACAlgorithm represents the HMAC the verdict is authenticated with, its hash is the hash of the key derivation as well
+type MACAlgorithm string
+
+// Supported MAC algorithms
+const (
+	HMACSHA256 MACAlgorithm = "HMAC-SHA256"
+	HMACSHA384 MACAlgorithm = "HMAC-SHA384"
+	HMACSHA512 MACAlgorithm = "HMAC-SHA512"
+)
+
+// Suite is a key agreement and MAC algorithm pair, named <key agreement>+<mac algorithm>, e.g. X25519+HMAC-SHA256
+type Suite struct {
+	KeyAgreement KeyAgreement
+	MAC          MACAlgorithm
+}
+
+// DefaultSuite is used when the invoker does not offer any suite, it is the suite of invokers predating negotiation
+var DefaultSuite = Suite{KeyAgreement: P256, MAC: HMACSHA256}
+
+// ErrUnsupportedSuite is returned when none of the suites offered by an invoker is supported
+var ErrUnsupportedSuite = errors.New("no supported suite offered")
+
+func (suite Suite) String() string {
+	return string(suite.KeyAgreement) + "+" + string(suite.MAC)
+}
+
+// ParseSuite returns the suite with the given name
+func ParseSuite(name string) (Suite, error) {
+	keyAgreement, mac, found := strings.Cut(strings.TrimSpace(name), "+")
+	suite := Suite{KeyAgreement: KeyAgreement(keyAgreement), MAC: MACAlgorithm(mac)}
+	if !found || suite.KeyAgreement.Curve() == nil || suite.MAC.hashFunc() == nil {
+		return Suite{}, fmt.Errorf("unsupported suite %q", name)
+	}
+	return suite, nil
+}
+
+// NegotiateSuite returns the first supported suite of the comma separated suites offered by the invoker, in the order of
+// its preference. DefaultSuite is returned if the invoker did not offer any suite
+func NegotiateSuite(offered string) (Suite, error) {
+	if strings.TrimSpace(offered) == "" {
+		return DefaultSuite, nil
+	}
+	for _, name := range strings.Split(offered, ",") {
+		if suite, err := ParseSuite(name); err == nil {
+			return suite, nil
+		}
+	}
+	return Suite{}, fmt.Errorf("%w in %q", ErrUnsupportedSuite, offered)
+}
+
+// Curve returns the ECDH curve of the key agreement, nil if it is not supported
+func (keyAgreement KeyAgreement) Curve() ecdh.Curve {
+	switch keyAgreement {
+	case P256:
+		return ecdh.P256()
+	case P384:
+		return ecdh.P384()
+	case P521:
+		return ecdh.P521()
+	case X25519:
+		return ecdh.X25519()
+	default:
+		return nil
+	}
+}
+
+// ellipticCurve returns the curve of a NIST key agreement, nil for X25519
+func (keyAgreement KeyAgreement) ellipticCurve() elliptic.Curve {
+	switch keyAgreement {
+	case P256:
+		return elliptic.P256()
+	case P384:
+		return elliptic.P384()
+	case P521:
+		return elliptic.P521()
+	default:
+		return nil
+	}
+}
+
+// hashFunc returns the hash of the MAC algorithm, nil if it is not supported
+func (mac MACAlgorithm) hashFunc() func() hash.Hash {
+	switch mac {
+	case HMACSHA256:
+		return sha256.New
+	case HMACSHA384:
+		return sha512.New384
+	case HMACSHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+// DeriveMACKey derives the MAC key from the ECDH shared secret with HKDF over the hash of the MAC algorithm, without
+// salt and with the context label as info. The key is as long as the hash
+func (suite Suite) DeriveMACKey(sharedSecret []byte) []byte {
+	hashFunc := suite.MAC.hashFunc()
+	macKey := make([]byte, hashFunc().Size())
+	// the reader only fails after 255 blocks of output
+	_, _ = io.ReadFull(hkdf.New(hashFunc, sharedSecret, nil, []byte(macKeyLabel)), macKey)
+	return macKey
+}
+
+// ComputeMAC returns the MAC of the transcript under the MAC key
+func (suite Suite) ComputeMAC(macKey []byte, transcript *Transcript) []byte {
+	hMac := hmac.New(suite.MAC.hashFunc(), macKey)
+	hMac.Write(transcript.Bytes())
+	return hMac.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package trust_protocol
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MACVersion is the version of the MAC key derivation and transcript, the MAC header holds it as the prefix of the tag
+const MACVersion = "v1"
+
+// MaxNonceSize is the largest invoker nonce accepted in a verification request
+const MaxNonceSize = 64
+
+// macKeyLabel is the HKDF context label of the MAC key, so that the key is only ever used for verdict MACs
+const macKeyLabel = "trufaas-mac-key-v1"
+
+// Transcript holds what the MAC of a verification response authenticates, so that a captured MAC cannot be
+// replayed for another function, spec, tree or request
+type Transcript struct {
+	TrustVerified bool   // TrustVerified is the verdict of the verification
+	Function      string // Function is the identity of the verified function, namespace/name
+	SpecHash      []byte // SpecHash is the leaf hash of the verified spec
+	MerkleRoot    []byte // MerkleRoot is the root of the tree the function was verified against
+	Nonce         []byte // Nonce is the nonce of the invoker, empty if it did not send one
+	Timestamp     int64  // Timestamp is the time of the verification in unix milliseconds
+}
+
+// Bytes returns the encoding of the transcript the MAC is computed over, with byte values hex encoded:
+//
+//	trufaas-verdict-v1\n<true|false>\n<function>\n<hex spec hash>\n<hex merkle root>\n<hex nonce>\n<timestamp>\n
+func (transcript *Transcript) Bytes() []byte {
+	return []byte(fmt.Sprintf("trufaas-verdict-%s\n%s\n%s\n%x\n%x\n%x\n%d\n", MACVersion,
+		strconv.FormatBool(transcript.TrustVerified), transcript.Function, transcript.SpecHash, transcript.MerkleRoot,
+		transcript.Nonce, transcript.Timestamp))
+}
+
+// ParseNonce decodes the hex encoded nonce of an invoker, which may be empty or at most MaxNonceSize bytes
+func ParseNonce(hexNonce string) ([]byte, error) {
+	nonce, err := hex.DecodeString(hexNonce)
+	if err != nil {
+		return nil, fmt.Errorf("nonce is not hex encoded: %w", err)
+	}
+	if len(nonce) > MaxNonceSize {
+		return nil, fmt.Errorf("nonce must be at most %d bytes", MaxNonceSize)
+	}
+	return nonce, nil
+}
+
+// ParseMACHeader decodes the tag of a MAC header, which must be of the version MACVersion
+func ParseMACHeader(value string) ([]byte, error) {
+	version, hexMAC, found := strings.Cut(value, ":")
+	if !found || version != MACVersion {
+		return nil, fmt.Errorf("unsupported MAC version in %q", value)
+	}
+	return hex.DecodeString(hexMAC)
+}
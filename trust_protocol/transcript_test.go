@@ -0,0 +1,150 @@
+package trust_protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// macVector is a test vector of testdata/mac_v1.json, byte values are hex encoded
+type macVector struct {
+	Description       string `json:"description"`
+	Suite             string `json:"suite"`
+	InvokerPrivateKey string `json:"invoker_private_key"`
+	InvokerPublicKey  string `json:"invoker_public_key"`
+	ServerPrivateKey  string `json:"server_private_key"`
+	ServerPublicKey   string `json:"server_public_key"`
+	SharedSecret      string `json:"shared_secret"`
+	MACKey            string `json:"mac_key"`
+	TrustVerified     bool   `json:"trust_verified"`
+	Function          string `json:"function"`
+	SpecHash          string `json:"spec_hash"`
+	MerkleRoot        string `json:"merkle_root"`
+	Nonce             string `json:"nonce"`
+	Timestamp         int64  `json:"timestamp"`
+	Transcript        string `json:"transcript"`
+	MACHeader         string `json:"mac_header"`
+}
+
+// decodeHex decodes a hex encoded value of a vector
+func decodeHex(t *testing.T, name string, value string) []byte {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", name, err)
+	}
+	return decoded
+}
+
+// TestMACVectors recomputes every value of the MAC test vectors from their private keys and transcript values, as an
+// invoker implementing the protocol does
+func TestMACVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/mac_v1.json")
+	if err != nil {
+		t.Fatalf("failed to read test vectors: %v", err)
+	}
+	var vectors []macVector
+	if err = json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("invalid test vectors: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatalf("no test vectors found")
+	}
+
+	suites := make(map[string]bool)
+	for _, vector := range vectors {
+		suites[vector.Suite] = true
+		t.Run(vector.Description, func(t *testing.T) {
+			suite, err := ParseSuite(vector.Suite)
+			if err != nil {
+				t.Fatalf("unsupported suite: %v", err)
+			}
+			curve := suite.KeyAgreement.Curve()
+			invokerKey, err := curve.NewPrivateKey(decodeHex(t, "invoker private key", vector.InvokerPrivateKey))
+			if err != nil {
+				t.Fatalf("invalid invoker private key: %v", err)
+			}
+			serverKey, err := curve.NewPrivateKey(decodeHex(t, "server private key", vector.ServerPrivateKey))
+			if err != nil {
+				t.Fatalf("invalid server private key: %v", err)
+			}
+
+			// the public keys are sent in the headers as raw keys of the suite
+			if encoded := hex.EncodeToString(EncodePublicKey(invokerKey.PublicKey())); encoded != vector.InvokerPublicKey {
+				t.Errorf("invoker public key %s, expected %s", encoded, vector.InvokerPublicKey)
+			}
+			if encoded := hex.EncodeToString(EncodePublicKey(serverKey.PublicKey())); encoded != vector.ServerPublicKey {
+				t.Errorf("server public key %s, expected %s", encoded, vector.ServerPublicKey)
+			}
+			invokerPublicKey, err := ParsePublicKey(vector.InvokerPublicKey, suite.KeyAgreement)
+			if err != nil || !invokerPublicKey.Equal(invokerKey.PublicKey()) {
+				t.Fatalf("invoker public key not parsed: %v", err)
+			}
+			serverPublicKey, err := ParsePublicKey(vector.ServerPublicKey, suite.KeyAgreement)
+			if err != nil || !serverPublicKey.Equal(serverKey.PublicKey()) {
+				t.Fatalf("server public key not parsed: %v", err)
+			}
+
+			// both sides agree on the shared secret
+			tp := &TrustProtocol{Suite: suite, ServerPrivateKey: serverKey, ServerPublicKey: serverKey.PublicKey(), ClientPublicKey: invokerPublicKey}
+			if err = tp.generateSharedSecret(); err != nil {
+				t.Fatalf("no shared secret agreed on: %v", err)
+			}
+			invokerSecret, err := invokerKey.ECDH(serverPublicKey)
+			if err != nil {
+				t.Fatalf("no shared secret agreed on by the invoker: %v", err)
+			}
+			expectedSecret := decodeHex(t, "shared secret", vector.SharedSecret)
+			if !bytes.Equal(tp.SharedSecret, expectedSecret) || !bytes.Equal(invokerSecret, expectedSecret) {
+				t.Fatalf("shared secret %x and %x, expected %x", tp.SharedSecret, invokerSecret, expectedSecret)
+			}
+
+			tp.MACKey = suite.DeriveMACKey(tp.SharedSecret)
+			if macKey := hex.EncodeToString(tp.MACKey); macKey != vector.MACKey {
+				t.Fatalf("MAC key %s, expected %s", macKey, vector.MACKey)
+			}
+
+			transcript := &Transcript{
+				TrustVerified: vector.TrustVerified,
+				Function:      vector.Function,
+				SpecHash:      decodeHex(t, "spec hash", vector.SpecHash),
+				MerkleRoot:    decodeHex(t, "merkle root", vector.MerkleRoot),
+				Nonce:         decodeHex(t, "nonce", vector.Nonce),
+				Timestamp:     vector.Timestamp,
+			}
+			if encoded := string(transcript.Bytes()); encoded != vector.Transcript {
+				t.Fatalf("transcript %q, expected %q", encoded, vector.Transcript)
+			}
+
+			tp.GenerateMAC(transcript)
+			if header := MACVersion + ":" + hex.EncodeToString(tp.MAC); header != vector.MACHeader {
+				t.Fatalf("MAC header %s, expected %s", header, vector.MACHeader)
+			}
+			mac, err := ParseMACHeader(vector.MACHeader)
+			if err != nil || !bytes.Equal(mac, tp.MAC) {
+				t.Fatalf("MAC header not parsed: %v", err)
+			}
+		})
+	}
+
+	// every key agreement has a vector
+	for _, keyAgreement := range []KeyAgreement{P256, P384, P521, X25519} {
+		found := false
+		for name := range suites {
+			suite, _ := ParseSuite(name)
+			found = found || suite.KeyAgreement == keyAgreement
+		}
+		if !found {
+			t.Errorf("no test vector of %s", keyAgreement)
+		}
+	}
+}
+
+func TestParseMACHeaderRejectsOtherVersions(t *testing.T) {
+	for _, header := range []string{"", "26faac2f", "v0:26faac2f", "v2:26faac2f", "v1:not-hex"} {
+		if _, err := ParseMACHeader(header); err == nil {
+			t.Errorf("header %q was accepted", header)
+		}
+	}
+}
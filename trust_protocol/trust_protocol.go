@@ -1,88 +1,113 @@
 package trust_protocol
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/hmac"
+	"crypto/ecdh"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"github.com/TruFaaS/TruFaaS/constants"
-	"hash"
-	"math/big"
+	"github.com/TruFaaS/TruFaaS/identity"
 	"net/http"
+	"strconv"
 )
 
 type TrustProtocol struct {
-	ServerPrivateKey ecdsa.PrivateKey
-	ServerPublicKey  ecdsa.PublicKey
-	ClientPublicKey  ecdsa.PublicKey
-	SharedSecret     big.Int
-	curve            elliptic.Curve
-	MAC              hash.Hash
+	Suite            Suite // Suite is the key agreement and MAC algorithm negotiated with the invoker
+	ServerPrivateKey *ecdh.PrivateKey
+	ServerPublicKey  *ecdh.PublicKey
+	ClientPublicKey  *ecdh.PublicKey
+	SharedSecret     []byte // SharedSecret is the ECDH shared secret, the X coordinate of the shared point for the NIST curves
+	MACKey           []byte // MACKey is derived from the shared secret with HKDF
+	MAC              []byte
+	Transcript       *Transcript // Transcript is what the MAC authenticates
 }
 
-func (tp *TrustProtocol) GetProtocolInstance(clientPubKeyInBytes []byte) *TrustProtocol {
-	// set the default curve
-	tp.curve = elliptic.P256()
+// GetProtocolInstance sets up the protocol of the suite with the public key of the invoker, parsed with ParsePublicKey
+// for the key agreement of the suite. An error is returned if no shared secret can be agreed on with the key, e.g. an
+// X25519 key of low order
+func (tp *TrustProtocol) GetProtocolInstance(suite Suite, clientPublicKey *ecdh.PublicKey) (*TrustProtocol, error) {
+	tp.Suite = suite
 	// set client public key
-	tp.setClientPublicKey(clientPubKeyInBytes)
+	tp.ClientPublicKey = clientPublicKey
 	//generate server keys
-	tp.generateServerKeys()
+	if err := tp.generateServerKeys(); err != nil {
+		return nil, err
+	}
 	// generate secret key
-	tp.generateSharedSecret()
-
-	return tp
-}
-
-func (tp *TrustProtocol) setClientPublicKey(clientPubKeyInBytes []byte) {
-	clientPubKey := &ecdsa.PublicKey{
-		Curve: tp.curve,
-		X:     new(big.Int).SetBytes(clientPubKeyInBytes[:32]),
-		Y:     new(big.Int).SetBytes(clientPubKeyInBytes[32:]),
+	if err := tp.generateSharedSecret(); err != nil {
+		return nil, err
 	}
-	tp.ClientPublicKey = *clientPubKey
+	tp.MACKey = suite.DeriveMACKey(tp.SharedSecret)
+
+	return tp, nil
 }
 
-func (tp *TrustProtocol) generateServerKeys() {
+func (tp *TrustProtocol) generateServerKeys() error {
 	// Generate a private key
-	serverPrivKey, _ := ecdsa.GenerateKey(tp.curve, rand.Reader)
-
-	// Get the public key from the private key
-	serverPubKey := serverPrivKey.PublicKey
+	serverPrivKey, err := tp.Suite.KeyAgreement.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
 
-	tp.ServerPrivateKey = *serverPrivKey
-	tp.ServerPublicKey = serverPubKey
+	tp.ServerPrivateKey = serverPrivKey
+	tp.ServerPublicKey = serverPrivKey.PublicKey()
+	return nil
 }
 
-func (tp *TrustProtocol) generateSharedSecret() {
-	clientPubKey := tp.ClientPublicKey
-	serverPrivKey := tp.ServerPrivateKey
-	sharedSecret, _ := clientPubKey.Curve.ScalarMult(clientPubKey.X, clientPubKey.Y, serverPrivKey.D.Bytes())
-	tp.SharedSecret = *sharedSecret
-
+func (tp *TrustProtocol) generateSharedSecret() error {
+	// the secret keeps its leading zero bytes, so that both sides derive the MAC key from the same bytes
+	sharedSecret, err := tp.ServerPrivateKey.ECDH(tp.ClientPublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	tp.SharedSecret = sharedSecret
+	return nil
 }
 
-func (tp *TrustProtocol) GenerateMAC(trustValue string) {
-
-	hMac := hmac.New(sha256.New, tp.SharedSecret.Bytes())
-	hMac.Write([]byte(trustValue))
-	tp.MAC = hMac
+// GenerateMAC authenticates the transcript of the verification with the MAC key
+func (tp *TrustProtocol) GenerateMAC(transcript *Transcript) {
+	tp.Transcript = transcript
+	tp.MAC = tp.Suite.ComputeMAC(tp.MACKey, transcript)
 }
 
-func (tp *TrustProtocol) SetResponseHeaders(w http.ResponseWriter, trustValue string) http.ResponseWriter {
+func (tp *TrustProtocol) SetResponseHeaders(w http.ResponseWriter) http.ResponseWriter {
 
 	// add trust ca
-	w.Header().Set(constants.TrustVerificationHeader, trustValue)
+	w.Header().Set(constants.TrustVerificationHeader, strconv.FormatBool(tp.Transcript.TrustVerified))
 
-	// Add the MAC tag to the response headers
-	macTag := hex.EncodeToString(tp.MAC.Sum(nil))
-	w.Header().Set(constants.MACHeader, macTag)
+	// Add the versioned MAC tag and the transcript values the invoker does not know to the response headers
+	w.Header().Set(constants.MACHeader, MACVersion+":"+hex.EncodeToString(tp.MAC))
+	w.Header().Set(constants.TimestampHeader, strconv.FormatInt(tp.Transcript.Timestamp, 10))
+	w.Header().Set(constants.SpecHashHeader, hex.EncodeToString(tp.Transcript.SpecHash))
+	w.Header().Set(constants.MerkleRootHeader, hex.EncodeToString(tp.Transcript.MerkleRoot))
 
-	// Add server's public key to the response headers
-	serverPubKeyBytes := append(tp.ServerPublicKey.X.Bytes(), tp.ServerPublicKey.Y.Bytes()...)
+	// Add the negotiated suite and server's public key to the response headers
+	w.Header().Set(constants.SuiteHeader, tp.Suite.String())
+	serverPubKeyBytes := EncodePublicKey(tp.ServerPublicKey)
 	serverPubKeyHex := hex.EncodeToString(serverPubKeyBytes)
 	w.Header().Set(constants.ExternalComponentPublicKeyHeader, serverPubKeyHex)
 
+	// Sign the ephemeral public key with the identity key, so that invokers can authenticate who produced the verdict
+	signature, err := identity.Sign(EphemeralKeySignedBytes(tp.Suite, serverPubKeyBytes, EncodePublicKey(tp.ClientPublicKey)))
+	keyID, keyIDErr := identity.KeyID()
+	if err != nil || keyIDErr != nil {
+		fmt.Println("failed to sign the ephemeral public key:", err, keyIDErr)
+		return w
+	}
+	w.Header().Set(constants.KeySignatureHeader, hex.EncodeToString(signature))
+	w.Header().Set(constants.KeyIDHeader, keyID)
+
 	return w
 }
+
+// ephemeralKeyLabel separates the signatures of ephemeral public keys from the other messages the identity key signs
+const ephemeralKeyLabel = "trufaas-ephemeral-key-v1"
+
+// EphemeralKeySignedBytes returns the message the identity key signs for an ephemeral public key, which binds the
+// ephemeral key to the negotiated suite and to the public key of the invoker it was generated for, both as hex encoded
+// raw keys of the suite, so that a signed key cannot be replayed for another suite or invoker:
+//
+//	trufaas-ephemeral-key-v1\n<suite>\n<hex server public key>\n<hex invoker public key>\n
+func EphemeralKeySignedBytes(suite Suite, serverPubKey []byte, clientPubKey []byte) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%x\n%x\n", ephemeralKeyLabel, suite, serverPubKey, clientPubKey))
+}
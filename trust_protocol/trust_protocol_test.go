@@ -0,0 +1,88 @@
+package trust_protocol
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/TruFaaS/TruFaaS/constants"
+	"github.com/TruFaaS/TruFaaS/identity"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEphemeralKeySignedBytes(t *testing.T) {
+	suite := Suite{KeyAgreement: X25519, MAC: HMACSHA256}
+	signed := EphemeralKeySignedBytes(suite, []byte{0x01, 0x02}, []byte{0xab})
+	if expected := "trufaas-ephemeral-key-v1\nX25519+HMAC-SHA256\n0102\nab\n"; string(signed) != expected {
+		t.Fatalf("expected %q, found %q", expected, signed)
+	}
+
+	// the message differs for another suite, server key or invoker key
+	others := [][]byte{
+		EphemeralKeySignedBytes(Suite{KeyAgreement: X25519, MAC: HMACSHA512}, []byte{0x01, 0x02}, []byte{0xab}),
+		EphemeralKeySignedBytes(Suite{KeyAgreement: P256, MAC: HMACSHA256}, []byte{0x01, 0x02}, []byte{0xab}),
+		EphemeralKeySignedBytes(suite, []byte{0x01, 0x03}, []byte{0xab}),
+		EphemeralKeySignedBytes(suite, []byte{0x01, 0x02}, []byte{0xac}),
+		EphemeralKeySignedBytes(suite, []byte{0x01}, []byte{0x02, 0xab}),
+	}
+	for _, other := range others {
+		if bytes.Equal(signed, other) {
+			t.Fatalf("expected %q to differ from %q", other, signed)
+		}
+	}
+}
+
+func TestSetResponseHeadersSignsEphemeralKey(t *testing.T) {
+	identityKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err == nil {
+		err = identity.InitializeWithSigner(identityKey)
+	}
+	if err != nil {
+		t.Fatalf("failed to initialize the identity key: %v", err)
+	}
+
+	for _, suite := range []Suite{DefaultSuite, {KeyAgreement: X25519, MAC: HMACSHA256}, {KeyAgreement: P384, MAC: HMACSHA384}} {
+		t.Run(suite.String(), func(t *testing.T) {
+			clientKey, err := suite.KeyAgreement.Curve().GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("failed to generate key: %v", err)
+			}
+			tp, err := (&TrustProtocol{}).GetProtocolInstance(suite, clientKey.PublicKey())
+			if err != nil {
+				t.Fatalf("failed to set up the protocol: %v", err)
+			}
+			tp.GenerateMAC(&Transcript{Function: "default/fn", TrustVerified: true})
+			recorder := httptest.NewRecorder()
+			tp.SetResponseHeaders(recorder)
+
+			header := recorder.Header()
+			signature, err := hex.DecodeString(header.Get(constants.KeySignatureHeader))
+			if err != nil || len(signature) == 0 {
+				t.Fatalf("expected a hex encoded key signature, found %q", header.Get(constants.KeySignatureHeader))
+			}
+			if keyID, _ := identity.KeyID(); header.Get(constants.KeyIDHeader) != keyID {
+				t.Fatalf("expected the key id %s, found %s", keyID, header.Get(constants.KeyIDHeader))
+			}
+			serverKey, err := ParsePublicKey(header.Get(constants.ExternalComponentPublicKeyHeader), suite.KeyAgreement)
+			if err != nil || !serverKey.Equal(tp.ServerPublicKey) {
+				t.Fatalf("expected the ephemeral key of the protocol, found %v", err)
+			}
+
+			// the signature is of the negotiated suite, the ephemeral key and the key of the invoker
+			serverKeyBytes, clientKeyBytes := EncodePublicKey(serverKey), EncodePublicKey(clientKey.PublicKey())
+			if !identity.Verify(&identityKey.PublicKey, EphemeralKeySignedBytes(suite, serverKeyBytes, clientKeyBytes), signature) {
+				t.Fatal("expected the signature to be verified for the negotiated suite")
+			}
+			otherSuite := Suite{KeyAgreement: suite.KeyAgreement, MAC: HMACSHA512}
+			if identity.Verify(&identityKey.PublicKey, EphemeralKeySignedBytes(otherSuite, serverKeyBytes, clientKeyBytes), signature) {
+				t.Fatal("expected the signature not to be verified for another suite")
+			}
+			otherClientKey, _ := suite.KeyAgreement.Curve().GenerateKey(rand.Reader)
+			if identity.Verify(&identityKey.PublicKey, EphemeralKeySignedBytes(suite, serverKeyBytes, EncodePublicKey(otherClientKey.PublicKey())), signature) {
+				t.Fatal("expected the signature not to be verified for another invoker key")
+			}
+		})
+	}
+}
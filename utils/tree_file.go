@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+)
+
+// treeFileMagic identifies a stored tree with a header, files without it are gob encoded trees stored before the header existed
+var treeFileMagic = []byte("TRUFAAS\x00")
+
+// TreeFileVersion is the version of the header of the stored tree
+const TreeFileVersion uint32 = 1
+
+// treeFileHeaderSize is the size of magic, version, payload length and SHA-256 checksum of the payload
+var treeFileHeaderSize = len(treeFileMagic) + 4 + 8 + sha256.Size
+
+// ErrCorruptTreeFile is returned when the stored tree does not match the length or checksum of its header
+var ErrCorruptTreeFile = errors.New("stored merkle tree is corrupt")
+
+// ErrUnkeyedTree is returned when the stored tree holds functions registered before they were keyed by their
+// identity, which no verification finds and which cannot be keyed as their hashes are of another encoding
+var ErrUnkeyedTree = errors.New("stored merkle tree holds functions registered before functions were keyed by their identity")
+
+// encodeTreeFile : to encode the tree with gob, preceded by a header holding the length and checksum of the encoding
+func encodeTreeFile(tree *merkleTree.MerkleTree) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(tree); err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(payload.Bytes())
+
+	data := make([]byte, 0, treeFileHeaderSize+payload.Len())
+	data = append(data, treeFileMagic...)
+	data = binary.BigEndian.AppendUint32(data, TreeFileVersion)
+	data = binary.BigEndian.AppendUint64(data, uint64(payload.Len()))
+	data = append(data, checksum[:]...)
+	return append(data, payload.Bytes()...), nil
+}
+
+// decodeTreeFile : to decode a tree encoded by encodeTreeFile and convert it to the current format, the length and
+// checksum of the header are checked first. Whether the tree was stored in an older layout or format is returned as well
+func decodeTreeFile(data []byte) (*merkleTree.MerkleTree, bool, error) {
+	payload := data
+	if bytes.HasPrefix(data, treeFileMagic) {
+		if len(data) < treeFileHeaderSize {
+			return nil, false, fmt.Errorf("%w: truncated header", ErrCorruptTreeFile)
+		}
+		header := data[len(treeFileMagic):treeFileHeaderSize]
+		if version := binary.BigEndian.Uint32(header[:4]); version != TreeFileVersion {
+			return nil, false, fmt.Errorf("unsupported merkle tree file version %d", version)
+		}
+		length := binary.BigEndian.Uint64(header[4:12])
+		payload = data[treeFileHeaderSize:]
+		if uint64(len(payload)) != length {
+			return nil, false, fmt.Errorf("%w: expected %d bytes, found %d", ErrCorruptTreeFile, length, len(payload))
+		}
+		if checksum := sha256.Sum256(payload); !bytes.Equal(checksum[:], header[12:]) {
+			return nil, false, fmt.Errorf("%w: checksum mismatch", ErrCorruptTreeFile)
+		}
+	}
+
+	var mt *merkleTree.MerkleTree
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&mt); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrCorruptTreeFile, err)
+	}
+	// the layout and format are converted first, the keys are checked on the layout the tree was stored in
+	predatesKeys, upgraded := mt.PredatesKeys(), mt.NeedsUpgrade()
+	mt = mt.Upgrade()
+	if predatesKeys {
+		return nil, false, ErrUnkeyedTree
+	}
+	// the checksum does not cover a tenant tree that was changed before the tree was stored
+	if err := mt.VerifyTenants(); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrCorruptTreeFile, err)
+	}
+	return mt, upgraded, nil
+}
+
+// DecodeMerkleTree : to decode a stored merkle tree and convert it to the current format, the tree is not stored again
+func DecodeMerkleTree(data []byte) (*merkleTree.MerkleTree, error) {
+	mt, _, err := decodeTreeFile(data)
+	return mt, err
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"github.com/TruFaaS/TruFaaS/constants"
+	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// gobEncode encodes the tree without a header, as trees were stored before the header existed
+func gobEncode(t *testing.T, tree *merkleTree.MerkleTree) []byte {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(tree); err != nil {
+		t.Fatalf("failed to encode tree: %v", err)
+	}
+	return data.Bytes()
+}
+
+func TestDecodeTreeFileRefusesUnkeyedTree(t *testing.T) {
+	leaf := []byte{0x01, 0x02}
+
+	// a tree of the node slice layout stored before leafs were keyed, whose functions no verification finds
+	nodes := &merkleTree.MerkleTree{
+		LeafCount:      1,
+		MerkleRootHash: leaf,
+		Nodes:          []*merkleTree.Node{{Parent: -1, Left: -1, Right: -1, Leaf: true, Hash: leaf}},
+	}
+	if _, _, err := decodeTreeFile(gobEncode(t, nodes)); !errors.Is(err, ErrUnkeyedTree) {
+		t.Fatalf("expected %v, found %v", ErrUnkeyedTree, err)
+	}
+	// the header does not make an unkeyed tree usable
+	data, err := encodeTreeFile(nodes)
+	if err != nil {
+		t.Fatalf("failed to encode tree: %v", err)
+	}
+	if _, err = DecodeMerkleTree(data); !errors.Is(err, ErrUnkeyedTree) {
+		t.Fatalf("expected %v with a header, found %v", ErrUnkeyedTree, err)
+	}
+
+	// a tree without functions has nothing to key
+	empty := &merkleTree.MerkleTree{Nodes: []*merkleTree.Node{{Parent: -1, Left: -1, Right: -1}}}
+	if _, _, err = decodeTreeFile(gobEncode(t, empty)); err != nil {
+		t.Fatalf("empty legacy tree refused: %v", err)
+	}
+
+	// an append-only tree keeps its leafs after every key was removed, which gob does not store
+	appendOnly := &merkleTree.MerkleTree{
+		Version:        merkleTree.CurrentFormatVersion,
+		HashAlgorithm:  merkleTree.DefaultHashAlgorithm,
+		Mode:           merkleTree.AppendOnlyMode,
+		LeafCount:      1,
+		MerkleRootHash: leaf,
+		Levels:         [][][]byte{{leaf}},
+		LeafPositions:  map[string]int{"0102": 0},
+	}
+	if _, _, err = decodeTreeFile(gobEncode(t, appendOnly)); err != nil {
+		t.Fatalf("append-only tree without keys refused: %v", err)
+	}
+}
+
+// readFixture reads and decodes the tree stored by an earlier release without converting it
+func readFixture(t *testing.T, fileName string) ([]byte, *merkleTree.MerkleTree) {
+	data, err := os.ReadFile(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", fileName, err)
+	}
+	var mt *merkleTree.MerkleTree
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&mt); err != nil {
+		t.Fatalf("failed to decode %s: %v", fileName, err)
+	}
+	return data, mt
+}
+
+// TestDecodeKeyedUnprefixedTree decodes the tree.gob stored by the release keying functions by their identity, before
+// leaf and node hashes were domain separated, whose leafs were default/fn-a, default/fn-b and default/fn-c
+func TestDecodeKeyedUnprefixedTree(t *testing.T) {
+	data, stored := readFixture(t, "keyed_unprefixed_tree.gob")
+	storedRoot, _ := hex.DecodeString("0aa1cbd3c22edc7783a500789c94862c2977c3f14f40b17bc7bbf3c2c948dfbb")
+	if stored.Version != 0 || !bytes.Equal(stored.GetMerkleRoot(), storedRoot) || !stored.NeedsUpgrade() || stored.PredatesKeys() {
+		t.Fatal("fixture is not a keyed tree of the unprefixed format")
+	}
+
+	mt, upgraded, err := decodeTreeFile(data)
+	if err != nil {
+		t.Fatalf("failed to decode the keyed unprefixed tree: %v", err)
+	}
+	if !upgraded || mt.Version != merkleTree.FormatDomainSeparated || mt.NeedsUpgrade() {
+		t.Fatalf("expected the tree to be migrated to format %d, found %d", merkleTree.FormatDomainSeparated, mt.Version)
+	}
+
+	// an unprefixed leaf hash is H(content), so the migrated tree is the tree the functions are registered in now
+	expected := merkleTree.NewTree()
+	for _, name := range []string{"fn-a", "fn-b", "fn-c"} {
+		key := "default/" + name
+		expected = expected.AppendKeyedContent(key, []byte("spec-"+name))
+		if leafHash, ok := mt.GetKeyedLeafHash(key); !ok || !bytes.Equal(leafHash, merkleTree.HashLeaf(merkleTree.SHA256, []byte("spec-"+name))) {
+			t.Fatalf("expected the leaf of %s to be migrated, found %x", key, leafHash)
+		}
+	}
+	if !bytes.Equal(mt.GetMerkleRoot(), expected.GetMerkleRoot()) || mt.KeyCount() != 3 {
+		t.Fatalf("expected the migrated root %x, found %x", expected.GetMerkleRoot(), mt.GetMerkleRoot())
+	}
+	if bytes.Equal(mt.GetMerkleRoot(), storedRoot) {
+		t.Fatal("expected the root to change with the format")
+	}
+
+	// the migrated tree is stored with a header and decoded without being migrated again
+	encoded, err := encodeTreeFile(mt)
+	if err != nil {
+		t.Fatalf("failed to encode the migrated tree: %v", err)
+	}
+	decoded, upgraded, err := decodeTreeFile(encoded)
+	if err != nil || upgraded || !bytes.Equal(decoded.GetMerkleRoot(), mt.GetMerkleRoot()) {
+		t.Fatalf("expected the migrated tree to decode unchanged, found %v (%v)", upgraded, err)
+	}
+}
+
+// TestDecodeBaselineTree decodes the tree.gob stored by the first release, whose leafs fn-a, fn-b and fn-c were
+// sorted by their unprefixed hash and not keyed
+func TestDecodeBaselineTree(t *testing.T) {
+	data, stored := readFixture(t, "baseline_tree.gob")
+	storedRoot, _ := hex.DecodeString("5c4d637c80e143b8eb3fb22a5613c4e23d15ee134d9386a661400ea68d51a39a")
+	if !bytes.Equal(stored.GetMerkleRoot(), storedRoot) || !stored.PredatesKeys() {
+		t.Fatal("fixture is not an unkeyed tree of the baseline format")
+	}
+	if _, _, err := decodeTreeFile(data); !errors.Is(err, ErrUnkeyedTree) {
+		t.Fatalf("expected %v, found %v", ErrUnkeyedTree, err)
+	}
+
+	// its layout and format are migrated all the same, the leafs keep their order sorted by the unprefixed hash
+	contents := []string{"fn-a", "fn-b", "fn-c"}
+	sort.Slice(contents, func(i, j int) bool {
+		first, second := sha256.Sum256([]byte(contents[i])), sha256.Sum256([]byte(contents[j]))
+		return bytes.Compare(first[:], second[:]) < 0
+	})
+	expected := merkleTree.NewTree()
+	for _, content := range contents {
+		expected = expected.AppendKeyedLeafHash(content, merkleTree.HashLeaf(merkleTree.SHA256, []byte(content)))
+	}
+	mt := stored.Upgrade()
+	if mt.Version != merkleTree.FormatDomainSeparated || mt.LeafCount != 3 || !bytes.Equal(mt.GetMerkleRoot(), expected.GetMerkleRoot()) {
+		t.Fatalf("expected the migrated root %x, found %x", expected.GetMerkleRoot(), mt.GetMerkleRoot())
+	}
+}
+
+// keyedTreeFile returns a tree holding the functions and its encoding with a header
+func keyedTreeFile(t *testing.T, names ...string) (*merkleTree.MerkleTree, []byte) {
+	mt := merkleTree.NewTree()
+	for _, name := range names {
+		mt = mt.AppendKeyedContent("default/"+name, []byte("spec-"+name))
+	}
+	data, err := encodeTreeFile(mt)
+	if err != nil {
+		t.Fatalf("failed to encode tree: %v", err)
+	}
+	return mt, data
+}
+
+// corrupted returns a copy of the data changed by corrupt
+func corrupted(data []byte, corrupt func(data []byte) []byte) []byte {
+	return corrupt(append([]byte{}, data...))
+}
+
+func TestDecodeTreeFileChecksHeader(t *testing.T) {
+	mt, data := keyedTreeFile(t, "fn-a", "fn-b")
+	decoded, upgraded, err := decodeTreeFile(data)
+	if err != nil || upgraded || !bytes.Equal(decoded.GetMerkleRoot(), mt.GetMerkleRoot()) {
+		t.Fatalf("expected the encoded tree to decode unchanged, found %v (%v)", upgraded, err)
+	}
+	versionOffset := len(treeFileMagic)
+	lengthOffset := versionOffset + 4
+	checksumOffset := lengthOffset + 8
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"changed magic", func(data []byte) []byte { data[0] ^= 0xff; return data }},
+		{"truncated header", func(data []byte) []byte { return data[:treeFileHeaderSize-1] }},
+		{"changed length", func(data []byte) []byte {
+			binary.BigEndian.PutUint64(data[lengthOffset:], uint64(len(data)-treeFileHeaderSize-1))
+			return data
+		}},
+		{"changed checksum", func(data []byte) []byte { data[checksumOffset] ^= 0x01; return data }},
+		{"truncated body", func(data []byte) []byte { return data[:len(data)-1] }},
+		{"appended body", func(data []byte) []byte { return append(data, 0x00) }},
+		{"changed body", func(data []byte) []byte { data[len(data)-1] ^= 0x01; return data }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := decodeTreeFile(corrupted(data, test.corrupt)); !errors.Is(err, ErrCorruptTreeFile) {
+				t.Fatalf("expected %v, found %v", ErrCorruptTreeFile, err)
+			}
+		})
+	}
+
+	// a file of a later version is refused instead of being read as the current version
+	later := corrupted(data, func(data []byte) []byte {
+		binary.BigEndian.PutUint32(data[versionOffset:], TreeFileVersion+1)
+		return data
+	})
+	if _, _, err = decodeTreeFile(later); err == nil {
+		t.Fatal("expected a file of an unsupported version to be refused")
+	}
+}
+
+func TestRetrieveMerkleTreeFallsBackToPreviousSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := store.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	defer SetTreeStore(GetTreeStore())
+	SetTreeStore(fileStore)
+	treeFile := filepath.Join(dir, constants.TreeStoreFileName)
+	previousTreeFile := filepath.Join(dir, constants.PreviousTreeStoreFileName)
+
+	if mt, err := RetrieveMerkleTree(); err != nil || mt.LeafCount != 0 {
+		t.Fatalf("expected a new tree for an empty store, found %v", err)
+	}
+	previous, _ := keyedTreeFile(t, "fn-a")
+	current, data := keyedTreeFile(t, "fn-a", "fn-b")
+	for _, mt := range []*merkleTree.MerkleTree{previous, current} {
+		if err = StoreMerkleTree(mt); err != nil {
+			t.Fatalf("failed to store tree: %v", err)
+		}
+	}
+	assertRetrieved(t, current)
+
+	// a stored tree whose header or body is corrupt is replaced by the previous snapshot
+	for name, corrupt := range map[string]func(data []byte) []byte{
+		"header": func(data []byte) []byte { data[len(treeFileMagic)+12] ^= 0x01; return data },
+		"body":   func(data []byte) []byte { data[len(data)-1] ^= 0x01; return data },
+	} {
+		if err = os.WriteFile(treeFile, corrupted(data, corrupt), 0644); err != nil {
+			t.Fatalf("failed to corrupt the %s: %v", name, err)
+		}
+		assertRetrieved(t, previous)
+	}
+
+	// a crash between the renames of a store leaves only the previous snapshot
+	if err = os.Remove(treeFile); err != nil {
+		t.Fatalf("failed to remove the stored tree: %v", err)
+	}
+	assertRetrieved(t, previous)
+
+	// without a snapshot to fall back to, a corrupt tree is an error instead of a new tree
+	if err = os.WriteFile(previousTreeFile, []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("failed to corrupt the previous snapshot: %v", err)
+	}
+	if err = os.WriteFile(treeFile, data[:len(data)-1], 0644); err != nil {
+		t.Fatalf("failed to corrupt the stored tree: %v", err)
+	}
+	if _, err = RetrieveMerkleTree(); !errors.Is(err, ErrCorruptTreeFile) {
+		t.Fatalf("expected %v, found %v", ErrCorruptTreeFile, err)
+	}
+}
+
+// assertRetrieved checks that the retrieved tree is the expected tree
+func assertRetrieved(t *testing.T, expected *merkleTree.MerkleTree) {
+	mt, err := RetrieveMerkleTree()
+	if err != nil {
+		t.Fatalf("failed to retrieve the tree: %v", err)
+	}
+	if !bytes.Equal(mt.GetMerkleRoot(), expected.GetMerkleRoot()) {
+		t.Fatalf("expected the tree with root %x, found %x", expected.GetMerkleRoot(), mt.GetMerkleRoot())
+	}
+}
@@ -1,82 +1,222 @@
 package utils
 
 import (
-	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/TruFaaS/TruFaaS/checkpoint"
 	commonTypes "github.com/TruFaaS/TruFaaS/common_types"
 	"github.com/TruFaaS/TruFaaS/constants"
 	merkleTree "github.com/TruFaaS/TruFaaS/merkle_tree"
+	"github.com/TruFaaS/TruFaaS/store"
 	"github.com/TruFaaS/TruFaaS/trust_protocol"
 	"net/http"
-	"os"
+	"strconv"
 )
 
-// StoreMerkleTree : to store the updated merkle tree
+// newTreeHashAlgorithm is the hash algorithm of the tree created when no tree is stored yet
+var newTreeHashAlgorithm = merkleTree.DefaultHashAlgorithm
+
+// newTreeMode is the mode of the tree created when no tree is stored yet
+var newTreeMode = merkleTree.DefaultTreeMode
+
+// newTreeTenancy is the tenancy of the tree created when no tree is stored yet
+var newTreeTenancy = merkleTree.DefaultTenancy
+
+// SetNewTreeTenancy : to set the tenancy used when a new merkle tree is created, a stored tree keeps the tenancy it was created with
+func SetNewTreeTenancy(tenancy merkleTree.Tenancy) {
+	newTreeTenancy = tenancy
+}
+
+// SetNewTreeMode : to set the mode used when a new merkle tree is created, a stored tree keeps the mode it was created with
+func SetNewTreeMode(mode merkleTree.TreeMode) {
+	newTreeMode = mode
+}
+
+// SetNewTreeHashAlgorithm : to set the hash algorithm used when a new merkle tree is created,
+// a stored tree keeps the algorithm it was created with
+func SetNewTreeHashAlgorithm(algorithm merkleTree.HashAlgorithm) {
+	newTreeHashAlgorithm = algorithm
+}
+
+// treeStore persists the merkle tree and its checkpoint
+var treeStore store.TreeStore = &store.FileStore{Dir: store.DefaultFileDirectory}
+
+// SetTreeStore : to set the store the merkle tree and its checkpoint are persisted in
+func SetTreeStore(s store.TreeStore) {
+	treeStore = s
+}
+
+// GetTreeStore : to get the store the merkle tree and its checkpoint are persisted in
+func GetTreeStore() store.TreeStore {
+	return treeStore
+}
+
+// StoreMerkleTree : to store the updated merkle tree, the stored tree is replaced atomically and the replaced tree
+// is kept as the previous snapshot
 func StoreMerkleTree(tree *merkleTree.MerkleTree) error {
 
-	file, err := os.Create(constants.TreeStoreFileName)
+	data, err := encodeTreeFile(tree)
 	if err != nil {
-		fmt.Println("Failed to create file, ERROR:", err)
+		fmt.Println("Failed to encode tree into binary, ERROR:", err.Error())
 		return err
 	}
-	defer file.Close()
-
-	encoder := gob.NewEncoder(file)
-	if err = encoder.Encode(tree); err != nil {
-		fmt.Println("Failed to encode tree into binary, ERROR:", err.Error())
+	if err = treeStore.StoreTree(data); err != nil {
+		fmt.Println("Failed to store tree, ERROR:", err)
 		return err
 	}
 
-	fmt.Println("Merkle Tree saved to", constants.TreeStoreFileName)
+	fmt.Println("Merkle Tree saved to", treeStore.Name())
 	return nil
 }
 
-// RetrieveMerkleTree : to retrieve the existing merkle tree, or return a new tree if it doesn't exist
+// RetrieveMerkleTree : to retrieve the existing merkle tree, or return a new tree if it doesn't exist,
+// requests are served from the tree kept in memory by the tree manager, which loads it once on startup.
+// The previous snapshot is returned if the stored tree is missing or corrupt.
 func RetrieveMerkleTree() (*merkleTree.MerkleTree, error) {
-	_, err := os.Stat(constants.TreeStoreFileName)
-	if os.IsNotExist(err) {
+	mt, err := retrieveStoredTree(treeStore.LoadTree, true)
+	if err == nil {
+		return mt, nil
+	}
+	if errors.Is(err, ErrUnkeyedTree) {
+		// the tree is not corrupt, an older snapshot would not be keyed either
+		return nil, err
+	}
+
+	previous, prevErr := retrieveStoredTree(treeStore.LoadPreviousTree, false)
+	if errors.Is(err, store.ErrNotFound) && errors.Is(prevErr, store.ErrNotFound) {
 		fmt.Println("No exiting merkle tree found")
-		return merkleTree.NewTree(), nil
+		return NewMerkleTree(), nil
+	}
+	if prevErr != nil {
+		fmt.Println("Error loading merkle tree:", err)
+		return nil, err
+	}
+	fmt.Println("Stored merkle tree could not be loaded, falling back to the previous snapshot:", err)
+	return previous, nil
+}
 
-	} else {
-		file, err := os.Open(constants.TreeStoreFileName)
-		if err != nil {
-			fmt.Println("Error opening file:", err)
-			return nil, err
-		}
-		defer file.Close()
+// NewMerkleTree : to create an empty merkle tree with the configured hash algorithm, mode and tenancy
+func NewMerkleTree() *merkleTree.MerkleTree {
+	return merkleTree.NewTreeWithTenancy(newTreeHashAlgorithm, newTreeMode, newTreeTenancy)
+}
+
+// ReloadMerkleTree : to retrieve the stored tree again after another replica sharing the store replaced it
+func ReloadMerkleTree() (*merkleTree.MerkleTree, error) {
+	return retrieveStoredTree(treeStore.LoadTree, false)
+}
+
+// RetrievePreviousMerkleTree : to retrieve the tree stored before the last mutation
+func RetrievePreviousMerkleTree() (*merkleTree.MerkleTree, error) {
+	return retrieveStoredTree(treeStore.LoadPreviousTree, false)
+}
 
-		decoder := gob.NewDecoder(file)
-		var mt *merkleTree.MerkleTree
-		if err = decoder.Decode(&mt); err != nil {
-			fmt.Println("Error decoding binary into tree:", err)
+// retrieveStoredTree : to decode the tree returned by load, a current tree is stored again if it had to be upgraded
+func retrieveStoredTree(load func() ([]byte, error), current bool) (*merkleTree.MerkleTree, error) {
+	data, err := load()
+	if err != nil {
+		return nil, err
+	}
+	// trees stored in an older layout or format are converted on load, and stored again once converted
+	mt, upgraded, err := decodeTreeFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if upgraded && current {
+		fmt.Println("Merkle tree migrated to format version", mt.Version)
+		if err = StoreMerkleTree(mt); err != nil {
 			return nil, err
 		}
-		return mt, nil
 	}
+	if mt.HashAlgorithm != newTreeHashAlgorithm {
+		fmt.Println("Stored merkle tree uses", mt.HashAlgorithm, "instead of the configured", newTreeHashAlgorithm)
+	}
+	if mt.Mode != newTreeMode {
+		fmt.Println("Stored merkle tree is", mt.Mode, "instead of the configured", newTreeMode)
+	}
+	if mt.Tenancy != newTreeTenancy {
+		fmt.Println("Stored merkle tree has", mt.Tenancy, "tenancy instead of the configured", newTreeTenancy)
+	}
+	return mt, nil
 }
 
-// SendSuccessResponse SendResponse : tos send the success response back to the client
-func SendSuccessResponse(respWriter http.ResponseWriter, body commonTypes.SuccessResponse) {
-
-	jsonResponse, err := json.Marshal(body)
+// StoreCheckpoint : to sign the root of the anchored merkle tree and store it next to the tree, the signed checkpoint is returned
+func StoreCheckpoint(tree *merkleTree.MerkleTree) (*checkpoint.Checkpoint, error) {
+	cp, err := checkpoint.New(tree)
 	if err != nil {
-		fmt.Printf("failed to marshal body, Error:%s", err)
-		return
+		fmt.Println("Failed to sign checkpoint, ERROR:", err)
+		return nil, err
 	}
-	respWriter.Header().Set("Content-Type", constants.ContentTypeJSON)
-	respWriter.WriteHeader(body.StatusCode)
-	_, err = respWriter.Write(jsonResponse)
-	if err != nil {
-		fmt.Printf("failed to marshal body, Error:%s", err)
-		return
+	if err = checkpoint.Store(cp, treeStore); err != nil {
+		fmt.Println("Failed to store checkpoint, ERROR:", err)
+		return nil, err
 	}
+	return cp, nil
+}
 
+// ConvertInclusionProof : to convert a merkle inclusion proof into its hex encoded response representation
+func ConvertInclusionProof(proof *merkleTree.InclusionProof, merkleRoot []byte) *commonTypes.InclusionProof {
+	path := make([]commonTypes.ProofStep, 0, len(proof.Path))
+	for _, step := range proof.Path {
+		position := "right"
+		if step.Left {
+			position = "left"
+		}
+		path = append(path, commonTypes.ProofStep{Hash: hex.EncodeToString(step.Hash), Position: position})
+	}
+
+	return &commonTypes.InclusionProof{
+		HashAlgorithm: string(proof.HashAlgorithm),
+		LeafIndex:     proof.LeafIndex,
+		LeafHash:      hex.EncodeToString(proof.LeafHash),
+		Path:          path,
+		MerkleRoot:    hex.EncodeToString(merkleRoot),
+	}
+}
+
+// ConvertConsistencyProof : to convert the consistency proof of the merkle tree to its hex encoded response
+func ConvertConsistencyProof(proof *merkleTree.ConsistencyProof) commonTypes.ConsistencyProofResponse {
+	path := make([]string, 0, len(proof.Path))
+	for _, hash := range proof.Path {
+		path = append(path, hex.EncodeToString(hash))
+	}
+
+	return commonTypes.ConsistencyProofResponse{
+		StatusCode:    http.StatusOK,
+		HashAlgorithm: string(proof.HashAlgorithm),
+		From:          proof.From,
+		To:            proof.To,
+		FromRoot:      hex.EncodeToString(proof.FromRoot),
+		ToRoot:        hex.EncodeToString(proof.ToRoot),
+		Path:          path,
+	}
+}
+
+// SendSuccessResponse SendResponse : tos send the success response back to the client
+func SendSuccessResponse(respWriter http.ResponseWriter, body commonTypes.SuccessResponse) {
+	SendJSONResponse(respWriter, body.StatusCode, body)
 }
 
 func SendErrorResponse(respWriter http.ResponseWriter, body commonTypes.ErrorResponse) {
+	SendJSONResponse(respWriter, body.StatusCode, body)
+}
+
+// SendBadRequestResponse : to send a bad request error with the message back to the client
+func SendBadRequestResponse(respWriter http.ResponseWriter, errMsg string) {
+	SendErrorResponse(respWriter, commonTypes.ErrorResponse{StatusCode: http.StatusBadRequest, ErrorMsg: errMsg})
+}
+
+// ParseQueryInt : to parse an integer query parameter, the default value is returned if the parameter is empty
+func ParseQueryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// SendJSONResponse : to send any json body back to the client with the given status code
+func SendJSONResponse(respWriter http.ResponseWriter, statusCode int, body interface{}) {
 
 	jsonResponse, err := json.Marshal(body)
 	if err != nil {
@@ -84,7 +224,7 @@ func SendErrorResponse(respWriter http.ResponseWriter, body commonTypes.ErrorRes
 		return
 	}
 	respWriter.Header().Set("Content-Type", constants.ContentTypeJSON)
-	respWriter.WriteHeader(body.StatusCode)
+	respWriter.WriteHeader(statusCode)
 	_, err = respWriter.Write(jsonResponse)
 	if err != nil {
 		fmt.Printf("failed to marshal body, Error:%s", err)
@@ -93,57 +233,53 @@ func SendErrorResponse(respWriter http.ResponseWriter, body commonTypes.ErrorRes
 
 }
 
-func SendVerificationSuccessResponse(respWriter http.ResponseWriter, fnName string, clientPubKey string) {
+func SendVerificationSuccessResponse(respWriter http.ResponseWriter, fnName string, tp *trust_protocol.TrustProtocol, transcript *trust_protocol.Transcript, proof *commonTypes.InclusionProof) {
 
 	successResponse := commonTypes.SuccessResponse{
-		StatusCode:    http.StatusOK,
-		Msg:           "Function verification is successful",
-		FnName:        fnName,
-		TrustVerified: true,
+		StatusCode:     http.StatusOK,
+		Msg:            "Function verification is successful",
+		FnName:         fnName,
+		TrustVerified:  true,
+		InclusionProof: proof,
 	}
 
-	if clientPubKey != "" {
-		trustVal := "true"
-		tp := trust_protocol.TrustProtocol{}
-
-		clientPubKeyBytes, _ := hex.DecodeString(clientPubKey)
-		// populate necessary keys
-		tp.GetProtocolInstance(clientPubKeyBytes)
-
+	if tp != nil {
 		// generate MAC for the response
-		tp.GenerateMAC(trustVal)
+		transcript.TrustVerified = true
+		tp.GenerateMAC(transcript)
 
 		// add necessary headers
-		respWriter = tp.SetResponseHeaders(respWriter, trustVal)
+		respWriter = tp.SetResponseHeaders(respWriter)
 
 	}
 	SendSuccessResponse(respWriter, successResponse)
 }
 
-func SendVerificationFailureErrorResponse(respWriter http.ResponseWriter, fnName string, clientPubKey string) {
+func SendVerificationFailureErrorResponse(respWriter http.ResponseWriter, fnName string, tp *trust_protocol.TrustProtocol, transcript *trust_protocol.Transcript, errCode string) {
 
 	falseVal := false
 
 	errResponse := commonTypes.ErrorResponse{
 		StatusCode:    http.StatusNotFound,
 		ErrorMsg:      "Function verification failed",
+		ErrorCode:     errCode,
 		FnName:        fnName,
 		TrustVerified: &falseVal,
 	}
+	switch errCode {
+	case constants.ErrCodeUnknownFunction:
+		errResponse.ErrorMsg = "Function verification failed, no trust value registered for the function"
+	case constants.ErrCodeSpecChanged:
+		errResponse.ErrorMsg = "Function verification failed, function spec changed since registration"
+	}
 
-	if clientPubKey != "" {
-		trustVal := "false"
-		tp := trust_protocol.TrustProtocol{}
-
-		clientPubKeyBytes, _ := hex.DecodeString(clientPubKey)
-		// populate necessary keys
-		tp.GetProtocolInstance(clientPubKeyBytes)
-
+	if tp != nil {
 		// generate MAC for the response
-		tp.GenerateMAC(trustVal)
+		transcript.TrustVerified = false
+		tp.GenerateMAC(transcript)
 
 		// add necessary headers
-		respWriter = tp.SetResponseHeaders(respWriter, trustVal)
+		respWriter = tp.SetResponseHeaders(respWriter)
 
 	}
 